@@ -0,0 +1,40 @@
+// Package api holds the messages of the REST API shared by the bell server
+// and bellctl, so the client doesn't depend on the server.
+package api
+
+import (
+	"github.com/restanrm/bell/history"
+	"github.com/restanrm/bell/job"
+	"github.com/restanrm/bell/policy"
+)
+
+// PlayResponse is the answer to an accepted playback: the decision of the
+// policy and the job following the playback
+type PlayResponse struct {
+	policy.Decision
+	Job job.Job `json:"job"`
+}
+
+// StopResponse lists the destinations where the playbacks were interrupted
+type StopResponse struct {
+	Stopped []string `json:"stopped"`
+}
+
+// ClientsList is the list of the registered clients
+type ClientsList struct {
+	Clients []string `json:"clients"`
+}
+
+// TagsUpdate is the response of the endpoints modifying tags
+type TagsUpdate struct {
+	Updated int `json:"updated"`
+}
+
+// HistoryPage is a page of the entries of the history
+type HistoryPage struct {
+	// Total is the number of entries matching the filters
+	Total   int             `json:"total"`
+	Offset  int             `json:"offset"`
+	Limit   int             `json:"limit"`
+	Entries []history.Entry `json:"entries"`
+}
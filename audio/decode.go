@@ -0,0 +1,161 @@
+package audio
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/jfreymuth/oggvorbis"
+)
+
+const (
+	// MinSampleRate and MaxSampleRate bound the sample rates of the decoded
+	// contents
+	MinSampleRate = 8000
+	MaxSampleRate = 384000
+	// decodeBuffer is the number of samples read at once by the decoders
+	decodeBuffer = 4096
+)
+
+var (
+	// ErrBadStream is returned when the sample rate or the number of channels
+	// of a content are implausible
+	ErrBadStream = errors.New("Unsupported sample rate or number of channels")
+)
+
+// Decoder decodes an audio content on the fly
+type Decoder interface {
+	SampleRate() int
+	Channels() int
+	// Read decodes the next interleaved samples into p, scaled between -1
+	// and 1. It returns io.EOF at the end of the content.
+	Read(p []float64) (int, error)
+}
+
+// NewDecoder returns the decoder of a content of the given format. Mp3, ogg
+// vorbis and wav contents are decoded in pure go.
+func NewDecoder(r io.Reader, f Format) (Decoder, error) {
+	var d Decoder
+	var err error
+	switch f {
+	case MP3:
+		d, err = newMP3Decoder(r)
+	case OGG:
+		d, err = newOGGDecoder(r)
+	case WAV:
+		d, err = newWAVDecoder(r)
+	default:
+		return nil, fmt.Errorf("Decoding %v contents is not supported", f)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if d.Channels() < 1 || d.SampleRate() < MinSampleRate || d.SampleRate() > MaxSampleRate {
+		return nil, ErrBadStream
+	}
+	return d, nil
+}
+
+// Decode decodes a whole audio content of the given format
+func Decode(r io.Reader, f Format) (*PCM, error) {
+	d, err := NewDecoder(r, f)
+	if err != nil {
+		return nil, err
+	}
+	return readAll(d)
+}
+
+// FileDecoder decodes an audio file, which must be closed once read
+type FileDecoder struct {
+	Decoder
+	file *os.File
+}
+
+// Close closes the file
+func (d *FileDecoder) Close() error {
+	return d.file.Close()
+}
+
+// OpenFile returns the decoder of the audio file at fp. Its format is
+// detected from its content.
+func OpenFile(fp string) (*FileDecoder, error) {
+	file, err := os.Open(fp)
+	if err != nil {
+		return nil, err
+	}
+	r := bufio.NewReader(file)
+	header, err := r.Peek(SniffLen)
+	if err != nil && err != io.EOF {
+		file.Close()
+		return nil, err
+	}
+	f, err := Detect(header)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	d, err := NewDecoder(r, f)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &FileDecoder{Decoder: d, file: file}, nil
+}
+
+// DecodeFile decodes the whole audio file at fp
+func DecodeFile(fp string) (*PCM, error) {
+	d, err := OpenFile(fp)
+	if err != nil {
+		return nil, err
+	}
+	defer d.Close()
+	return readAll(d)
+}
+
+// readAll reads the samples of a decoder up to the end
+func readAll(d Decoder) (*PCM, error) {
+	pcm := &PCM{SampleRate: d.SampleRate(), Channels: d.Channels()}
+	buf := make([]float64, decodeBuffer)
+	for {
+		n, err := d.Read(buf)
+		pcm.Samples = append(pcm.Samples, buf[:n]...)
+		if err == io.EOF {
+			return pcm, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// DecodeOGG decodes an ogg vorbis content
+func DecodeOGG(r io.Reader) (*PCM, error) {
+	return Decode(r, OGG)
+}
+
+// oggDecoder converts the samples of an ogg vorbis reader
+type oggDecoder struct {
+	*oggvorbis.Reader
+	buf []float32
+}
+
+func newOGGDecoder(r io.Reader) (*oggDecoder, error) {
+	or, err := oggvorbis.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return &oggDecoder{Reader: or}, nil
+}
+
+func (d *oggDecoder) Read(p []float64) (int, error) {
+	if cap(d.buf) < len(p) {
+		d.buf = make([]float32, len(p))
+	}
+	n, err := d.Reader.Read(d.buf[:len(p)])
+	for i, s := range d.buf[:n] {
+		p[i] = float64(s)
+	}
+	return n, err
+}
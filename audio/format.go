@@ -0,0 +1,190 @@
+// Package audio knows about the audio formats handled by bell. It detects the
+// format of a file from its content, decodes it and converts files from one
+// format to another.
+package audio
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"strings"
+)
+
+// Format is an audio container format
+type Format int
+
+const (
+	// Unknown is the format of content that isn't recognized as audio
+	Unknown Format = iota
+	// MP3 is the mpeg audio layer III format
+	MP3
+	// OGG is an ogg container, usually with vorbis content
+	OGG
+	// Opus is an ogg container with opus content
+	Opus
+	// WAV is the RIFF wave format
+	WAV
+	// FLAC is the free lossless audio codec native format
+	FLAC
+)
+
+var (
+	// ErrUnknownFormat is returned when the content isn't a known audio format
+	ErrUnknownFormat = errors.New("Content is not a supported audio format (mp3, ogg, opus, wav, flac)")
+)
+
+// String convert Format to string
+func (f Format) String() string {
+	switch f {
+	case MP3:
+		return "mp3"
+	case OGG:
+		return "ogg"
+	case Opus:
+		return "opus"
+	case WAV:
+		return "wav"
+	case FLAC:
+		return "flac"
+	}
+	return ""
+}
+
+// Ext returns the file extension of the format, including the dot
+func (f Format) Ext() string {
+	if f == Unknown {
+		return ""
+	}
+	return "." + f.String()
+}
+
+// Decodable returns true if the contents of the format can be decoded in
+// pure go by Decode
+func (f Format) Decodable() bool {
+	return f == MP3 || f == OGG || f == WAV
+}
+
+// MIMEType returns the media type of the format
+func (f Format) MIMEType() string {
+	switch f {
+	case MP3:
+		return "audio/mpeg"
+	case OGG:
+		return "audio/ogg"
+	case Opus:
+		return "audio/ogg; codecs=opus"
+	case WAV:
+		return "audio/wav"
+	case FLAC:
+		return "audio/flac"
+	}
+	return "application/octet-stream"
+}
+
+// ParseMIMEType returns the format of a media type, like the Content-Type of
+// the sounds served by bell. The unknown media types are the Unknown format.
+func ParseMIMEType(s string) Format {
+	mt, params, err := mime.ParseMediaType(s)
+	if err != nil {
+		return Unknown
+	}
+	switch mt {
+	case "audio/mpeg", "audio/mp3":
+		return MP3
+	case "audio/ogg", "application/ogg":
+		if params["codecs"] == "opus" {
+			return Opus
+		}
+		return OGG
+	case "audio/opus":
+		return Opus
+	case "audio/wav", "audio/wave", "audio/x-wav", "audio/vnd.wave":
+		return WAV
+	case "audio/flac", "audio/x-flac":
+		return FLAC
+	}
+	return Unknown
+}
+
+// ParseFormat returns the format matching the given name. An empty name is
+// the Unknown format.
+func ParseFormat(s string) (Format, error) {
+	switch strings.ToLower(strings.TrimPrefix(s, ".")) {
+	case "":
+		return Unknown, nil
+	case "mp3":
+		return MP3, nil
+	case "ogg":
+		return OGG, nil
+	case "opus":
+		return Opus, nil
+	case "wav":
+		return WAV, nil
+	case "flac":
+		return FLAC, nil
+	}
+	return Unknown, fmt.Errorf("Unknown audio format %q", s)
+}
+
+// SniffLen is the number of bytes needed by Detect to recognize a format
+const SniffLen = 64
+
+// Detect returns the format of the audio content starting with header
+func Detect(header []byte) (Format, error) {
+	switch {
+	case bytes.HasPrefix(header, []byte("ID3")):
+		return MP3, nil
+	case bytes.HasPrefix(header, []byte("fLaC")):
+		return FLAC, nil
+	case len(header) >= 12 && bytes.HasPrefix(header, []byte("RIFF")) && bytes.Equal(header[8:12], []byte("WAVE")):
+		return WAV, nil
+	case bytes.HasPrefix(header, []byte("OggS")):
+		// the first page contains the identification header of the codec
+		if len(header) >= 36 && bytes.Equal(header[28:36], []byte("OpusHead")) {
+			return Opus, nil
+		}
+		return OGG, nil
+	case isMP3Frame(header):
+		return MP3, nil
+	}
+	return Unknown, ErrUnknownFormat
+}
+
+// isMP3Frame returns true if header starts with a valid mpeg audio frame header
+func isMP3Frame(h []byte) bool {
+	if len(h) < 4 || h[0] != 0xFF || h[1]&0xE0 != 0xE0 {
+		return false
+	}
+	version := (h[1] >> 3) & 0x03
+	layer := (h[1] >> 1) & 0x03
+	bitrate := h[2] >> 4
+	sampleRate := (h[2] >> 2) & 0x03
+	return version != 1 && layer != 0 && bitrate != 0x0F && sampleRate != 0x03
+}
+
+// DetectReader reads the beginning of r to detect its format. The returned
+// reader yields the whole content, including the bytes read for detection.
+func DetectReader(r io.Reader) (Format, io.Reader, error) {
+	header := make([]byte, SniffLen)
+	n, err := io.ReadFull(r, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return Unknown, nil, err
+	}
+	header = header[:n]
+	f, err := Detect(header)
+	return f, io.MultiReader(bytes.NewReader(header), r), err
+}
+
+// DetectFile returns the format of the file at fp
+func DetectFile(fp string) (Format, error) {
+	f, err := os.Open(fp)
+	if err != nil {
+		return Unknown, err
+	}
+	defer f.Close()
+	format, _, err := DetectReader(f)
+	return format, err
+}
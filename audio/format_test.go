@@ -0,0 +1,29 @@
+package audio
+
+import "testing"
+
+func TestParseMIMEType(t *testing.T) {
+	tests := []struct {
+		mt   string
+		want Format
+	}{
+		{"audio/mpeg", MP3},
+		{"audio/ogg", OGG},
+		{"audio/ogg; codecs=opus", Opus},
+		{"audio/WAV", WAV},
+		{"audio/x-flac", FLAC},
+		{"application/octet-stream", Unknown},
+		{"", Unknown},
+	}
+	for _, tt := range tests {
+		if got := ParseMIMEType(tt.mt); got != tt.want {
+			t.Errorf("%q: got %v, want %v", tt.mt, got, tt.want)
+		}
+	}
+	// the media types of the formats are parsed back
+	for _, f := range []Format{MP3, OGG, Opus, WAV, FLAC} {
+		if got := ParseMIMEType(f.MIMEType()); got != f {
+			t.Errorf("%q: got %v, want %v", f.MIMEType(), got, f)
+		}
+	}
+}
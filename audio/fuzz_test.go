@@ -0,0 +1,37 @@
+//go:build go1.18
+// +build go1.18
+
+package audio
+
+import (
+	"bytes"
+	"testing"
+)
+
+func FuzzDecodeMP3(f *testing.F) {
+	for _, fp := range mp3Sounds {
+		data := readSound(f, fp)
+		if len(data) > 4096 {
+			data = data[:4096]
+		}
+		f.Add(data)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		pcm, err := DecodeMP3(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+		if len(pcm.Samples)%pcm.Channels != 0 {
+			t.Errorf("decoded %d samples for %d channels", len(pcm.Samples), pcm.Channels)
+		}
+	})
+}
+
+func FuzzDecodeWAV(f *testing.F) {
+	var buf bytes.Buffer
+	EncodeWAV(&buf, &PCM{SampleRate: 8000, Channels: 2, Samples: make([]float64, 64)})
+	f.Add(buf.Bytes())
+	f.Fuzz(func(t *testing.T, data []byte) {
+		DecodeWAV(bytes.NewReader(data))
+	})
+}
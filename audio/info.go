@@ -0,0 +1,291 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"time"
+)
+
+var (
+	// ErrBadHeader is returned when the headers of an audio content can't be
+	// parsed
+	ErrBadHeader = errors.New("Invalid audio headers")
+)
+
+// Info describes an audio content
+type Info struct {
+	Format     Format
+	Duration   time.Duration
+	SampleRate int
+	Channels   int
+}
+
+// Probe parses the headers of an audio content to describe it. The whole
+// content is needed to compute the duration of mp3 and ogg contents.
+func Probe(data []byte) (Info, error) {
+	format, err := Detect(data)
+	if err != nil {
+		return Info{}, err
+	}
+	var info Info
+	switch format {
+	case MP3:
+		info, err = probeMP3(data)
+	case OGG, Opus:
+		info, err = probeOGG(data)
+	case WAV:
+		info, err = probeWAV(data)
+	case FLAC:
+		info, err = probeFLAC(data)
+	}
+	info.Format = format
+	return info, err
+}
+
+// ProbeFile describes the audio file at fp
+func ProbeFile(fp string) (Info, error) {
+	data, err := ioutil.ReadFile(fp)
+	if err != nil {
+		return Info{}, err
+	}
+	return Probe(data)
+}
+
+// duration returns the duration of the given number of samples per channel
+func duration(samples int64, rate int) time.Duration {
+	if rate == 0 {
+		return 0
+	}
+	return time.Duration(samples * int64(time.Second) / int64(rate))
+}
+
+func probeWAV(data []byte) (Info, error) {
+	r := bytes.NewReader(data)
+	wav, err := readWAVHeader(r)
+	if err != nil {
+		return Info{}, err
+	}
+	info := Info{SampleRate: wav.SampleRate, Channels: wav.Channels}
+	frame := int64(wav.Channels * wav.BitsPerSample / 8)
+	if frame == 0 {
+		return info, ErrBadWAV
+	}
+	// streamed files don't know the size of their samples
+	size := wav.DataSize
+	if remaining := int64(r.Len()); size == 0 || size > remaining {
+		size = remaining
+	}
+	info.Duration = duration(size/frame, wav.SampleRate)
+	return info, nil
+}
+
+var (
+	mp3Bitrates = map[[2]int][]int{
+		{1, 1}: {0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448},
+		{1, 2}: {0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384},
+		{1, 3}: {0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320},
+		{2, 1}: {0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256},
+		{2, 2}: {0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+		{2, 3}: {0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+	}
+	mp3SampleRates = map[int][]int{
+		1: {44100, 48000, 32000},
+		2: {22050, 24000, 16000},
+		3: {11025, 12000, 8000},
+	}
+)
+
+// mp3Mono is the channel mode of the single channel frames
+const mp3Mono = 3
+
+// mp3Frame is a parsed mpeg audio frame header
+type mp3Frame struct {
+	// version is 1 for mpeg 1, 2 for mpeg 2 and 3 for mpeg 2.5
+	version    int
+	layer      int
+	sampleRate int
+	channels   int
+	samples    int
+	length     int
+	// crc is true when the header is followed by a checksum
+	crc bool
+	// mode is the channel mode: stereo, joint stereo, dual channel or mono,
+	// and modeExt the stereo coding of joint stereo frames
+	mode    int
+	modeExt int
+}
+
+// parseMP3Frame parses the frame header at the beginning of h
+func parseMP3Frame(h []byte) (mp3Frame, bool) {
+	if !isMP3Frame(h) {
+		return mp3Frame{}, false
+	}
+	f := mp3Frame{
+		version: [4]int{3, 0, 2, 1}[(h[1]>>3)&0x03],
+		layer:   4 - int((h[1]>>1)&0x03),
+	}
+	table := f.version
+	if table == 3 {
+		table = 2
+	}
+	bitrate := mp3Bitrates[[2]int{table, f.layer}][h[2]>>4] * 1000
+	f.sampleRate = mp3SampleRates[f.version][(h[2]>>2)&0x03]
+	padding := int((h[2] >> 1) & 0x01)
+	f.crc = h[1]&0x01 == 0
+	f.mode = int(h[3] >> 6)
+	f.modeExt = int(h[3]>>4) & 0x03
+	f.channels = 2
+	if f.mode == mp3Mono {
+		f.channels = 1
+	}
+	// free format frames can't be measured
+	if bitrate == 0 {
+		return f, false
+	}
+	switch {
+	case f.layer == 1:
+		f.samples = 384
+		f.length = (12*bitrate/f.sampleRate + padding) * 4
+	case f.layer == 3 && f.version != 1:
+		f.samples = 576
+		f.length = 72*bitrate/f.sampleRate + padding
+	default:
+		f.samples = 1152
+		f.length = 144*bitrate/f.sampleRate + padding
+	}
+	return f, f.length > 4
+}
+
+// xingOffset returns the offset in the first frame of a Xing or Info header
+func xingOffset(f mp3Frame) int {
+	switch {
+	case f.version == 1 && f.channels == 1, f.version != 1 && f.channels == 2:
+		return 4 + 17
+	case f.version != 1:
+		return 4 + 9
+	}
+	return 4 + 32
+}
+
+// hasXing returns true if the first frame is a Xing or Info header, which
+// carries no audio
+func hasXing(frame []byte, f mp3Frame) bool {
+	offset := xingOffset(f)
+	if len(frame) < offset+4 {
+		return false
+	}
+	tag := string(frame[offset : offset+4])
+	return tag == "Xing" || tag == "Info"
+}
+
+// xingFrames returns the number of frames announced by the Xing or Info
+// header of the first frame of a variable bitrate file
+func xingFrames(frame []byte, f mp3Frame) (int64, bool) {
+	offset := xingOffset(f)
+	if !hasXing(frame, f) || len(frame) < offset+12 {
+		return 0, false
+	}
+	flags := binary.BigEndian.Uint32(frame[offset+4 : offset+8])
+	if flags&0x01 == 0 {
+		return 0, false
+	}
+	return int64(binary.BigEndian.Uint32(frame[offset+8 : offset+12])), true
+}
+
+// mp3Frames returns the content starting at the first frame, after the
+// ID3v2 tag
+func mp3Frames(data []byte) ([]byte, error) {
+	if len(data) >= 10 && bytes.HasPrefix(data, []byte("ID3")) {
+		size := int(data[6])<<21 | int(data[7])<<14 | int(data[8])<<7 | int(data[9])
+		size += 10
+		if data[5]&0x10 != 0 {
+			size += 10
+		}
+		if size > len(data) {
+			return nil, ErrBadHeader
+		}
+		data = data[size:]
+	}
+	// some encoders pad the tag with zeros
+	start := bytes.IndexByte(data, 0xFF)
+	if start < 0 {
+		return nil, ErrBadHeader
+	}
+	return data[start:], nil
+}
+
+func probeMP3(data []byte) (Info, error) {
+	data, err := mp3Frames(data)
+	if err != nil {
+		return Info{}, err
+	}
+	first, ok := parseMP3Frame(data)
+	if !ok {
+		return Info{}, ErrBadHeader
+	}
+	info := Info{SampleRate: first.sampleRate, Channels: first.channels}
+	if frames, ok := xingFrames(data, first); ok {
+		info.Duration = duration(frames*int64(first.samples), first.sampleRate)
+		return info, nil
+	}
+	var samples int64
+	for len(data) >= 4 {
+		f, ok := parseMP3Frame(data)
+		// the end of the stream, or an ID3v1 tag
+		if !ok || f.sampleRate != first.sampleRate || f.length > len(data) {
+			break
+		}
+		samples += int64(f.samples)
+		data = data[f.length:]
+	}
+	info.Duration = duration(samples, first.sampleRate)
+	return info, nil
+}
+
+func probeOGG(data []byte) (Info, error) {
+	if len(data) < 27 {
+		return Info{}, ErrBadHeader
+	}
+	// the first page contains the identification header of the codec
+	packet := data[27+int(data[26]):]
+	var info Info
+	var preSkip int64
+	switch {
+	case len(packet) >= 16 && bytes.HasPrefix(packet, []byte("\x01vorbis")):
+		info.Channels = int(packet[11])
+		info.SampleRate = int(binary.LittleEndian.Uint32(packet[12:16]))
+	case len(packet) >= 12 && bytes.HasPrefix(packet, []byte("OpusHead")):
+		info.Channels = int(packet[9])
+		preSkip = int64(binary.LittleEndian.Uint16(packet[10:12]))
+		// opus is always decoded at 48kHz
+		info.SampleRate = 48000
+	default:
+		return Info{}, ErrBadHeader
+	}
+	// the granule position of the last page is the number of samples
+	last := bytes.LastIndex(data, []byte("OggS"))
+	if last < 0 || len(data) < last+14 {
+		return info, ErrBadHeader
+	}
+	granule := int64(binary.LittleEndian.Uint64(data[last+6 : last+14]))
+	if granule > preSkip {
+		info.Duration = duration(granule-preSkip, info.SampleRate)
+	}
+	return info, nil
+}
+
+func probeFLAC(data []byte) (Info, error) {
+	// the STREAMINFO block is always the first metadata block
+	if len(data) < 8+34 || data[4]&0x7F != 0 {
+		return Info{}, ErrBadHeader
+	}
+	bits := binary.BigEndian.Uint64(data[8+10 : 8+18])
+	info := Info{
+		SampleRate: int(bits >> 44),
+		Channels:   int((bits>>41)&0x07) + 1,
+	}
+	info.Duration = duration(int64(bits&(1<<36-1)), info.SampleRate)
+	return info, nil
+}
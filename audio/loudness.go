@@ -0,0 +1,197 @@
+package audio
+
+import (
+	"math"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Silence is the loudness reported for a content without any audible block
+const Silence = -70.0
+
+// biquad is a second order IIR filter
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+	x1, x2, y1, y2     float64
+}
+
+func (f *biquad) process(x float64) float64 {
+	y := f.b0*x + f.b1*f.x1 + f.b2*f.x2 - f.a1*f.y1 - f.a2*f.y2
+	f.x2, f.x1 = f.x1, x
+	f.y2, f.y1 = f.y1, y
+	return y
+}
+
+// kWeighting returns the two stages of the K-weighting filter of ITU-R
+// BS.1770 for the given sample rate
+func kWeighting(rate float64) (*biquad, *biquad) {
+	// high shelf
+	f0, g, q := 1681.974450955533, 3.999843853973347, 0.7071752369554196
+	k := math.Tan(math.Pi * f0 / rate)
+	vh := math.Pow(10, g/20)
+	vb := math.Pow(vh, 0.4996667741545416)
+	a0 := 1 + k/q + k*k
+	shelf := &biquad{
+		b0: (vh + vb*k/q + k*k) / a0,
+		b1: 2 * (k*k - vh) / a0,
+		b2: (vh - vb*k/q + k*k) / a0,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+	}
+	// high pass
+	f0, q = 38.13547087602444, 0.5003270373238773
+	k = math.Tan(math.Pi * f0 / rate)
+	a0 = 1 + k/q + k*k
+	pass := &biquad{
+		b0: 1,
+		b1: -2,
+		b2: 1,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+	}
+	return shelf, pass
+}
+
+// channelWeight returns the weight of a channel in the loudness computation.
+// Layouts with 6 channels or more are considered as 5.1: the LFE channel is
+// ignored and the surround channels are weighted.
+func channelWeight(channel, channels int) float64 {
+	if channels < 6 {
+		return 1
+	}
+	switch channel {
+	case 3:
+		return 0
+	case 4, 5:
+		return 1.41
+	}
+	return 1
+}
+
+// Loudness returns the integrated loudness of the samples in LUFS, as defined
+// by EBU R128 (ITU-R BS.1770 with gating)
+func Loudness(pcm *PCM) float64 {
+	if pcm.Channels == 0 || pcm.SampleRate == 0 {
+		return Silence
+	}
+	frames := pcm.Frames()
+	// filtered squared samples of every channel
+	squared := make([][]float64, pcm.Channels)
+	for c := 0; c < pcm.Channels; c++ {
+		shelf, pass := kWeighting(float64(pcm.SampleRate))
+		squared[c] = make([]float64, frames)
+		for i := 0; i < frames; i++ {
+			y := pass.process(shelf.process(pcm.Samples[i*pcm.Channels+c]))
+			squared[c][i] = y * y
+		}
+	}
+
+	// 400ms blocks with an overlap of 75%
+	block := int(0.4 * float64(pcm.SampleRate))
+	step := block / 4
+	if block == 0 || frames < block {
+		block, step = frames, frames
+	}
+	var powers []float64
+	for start := 0; step > 0 && start+block <= frames; start += step {
+		power := 0.0
+		for c := 0; c < pcm.Channels; c++ {
+			sum := 0.0
+			for _, v := range squared[c][start : start+block] {
+				sum += v
+			}
+			power += channelWeight(c, pcm.Channels) * sum / float64(block)
+		}
+		powers = append(powers, power)
+	}
+
+	loudness := func(power float64) float64 { return -0.691 + 10*math.Log10(power) }
+	gated := func(threshold float64) (float64, int) {
+		sum, n := 0.0, 0
+		for _, p := range powers {
+			if p > 0 && loudness(p) > threshold {
+				sum += p
+				n++
+			}
+		}
+		if n == 0 {
+			return 0, 0
+		}
+		return sum / float64(n), n
+	}
+
+	// absolute gate, then relative gate 10 LU below
+	mean, n := gated(Silence)
+	if n == 0 {
+		return Silence
+	}
+	mean, n = gated(loudness(mean) - 10)
+	if n == 0 {
+		return Silence
+	}
+	return loudness(mean)
+}
+
+// LoudnessMeter measures the integrated loudness of audio files
+type LoudnessMeter struct {
+	FFmpeg *FFmpeg
+}
+
+// Loudness returns the integrated loudness in LUFS of the audio file at fp.
+// Wav files are measured in pure go, other formats need ffmpeg.
+func (m *LoudnessMeter) Loudness(fp string) (float64, error) {
+	format, err := DetectFile(fp)
+	if err != nil {
+		return 0, err
+	}
+	if format == WAV {
+		f, err := os.Open(fp)
+		if err != nil {
+			return 0, err
+		}
+		defer f.Close()
+		pcm, err := DecodeWAV(f)
+		if err != nil {
+			return 0, err
+		}
+		return Loudness(pcm), nil
+	}
+	if m.FFmpeg == nil || !m.FFmpeg.Available() {
+		return 0, errors.Wrapf(ErrUnsupportedConversion, "ffmpeg is needed to measure the loudness of %v files", format)
+	}
+	return m.FFmpeg.Loudness(fp)
+}
+
+var rxIntegratedLoudness = regexp.MustCompile(`I:\s+(-?[0-9.]+|-inf) LUFS`)
+
+// Loudness measures the integrated loudness of the file with the ebur128
+// filter of ffmpeg
+func (f *FFmpeg) Loudness(fp string) (float64, error) {
+	cmd := exec.Command(
+		f.binary(),
+		"-nostats",
+		"-i", fp,
+		"-filter_complex", "ebur128",
+		"-f", "null",
+		"-",
+	)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return 0, errors.Wrapf(err, "Failed to run the command: %q: %s", strings.Join(cmd.Args, " "), out)
+	}
+	// the summary is at the end of the output
+	matches := rxIntegratedLoudness.FindAllStringSubmatch(string(out), -1)
+	if len(matches) == 0 {
+		return 0, errors.New("Failed to find integrated loudness in ffmpeg output")
+	}
+	value := matches[len(matches)-1][1]
+	if value == "-inf" {
+		return Silence, nil
+	}
+	return strconv.ParseFloat(value, 64)
+}
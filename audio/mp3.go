@@ -0,0 +1,139 @@
+package audio
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"github.com/hajimehoshi/go-mp3"
+)
+
+var (
+	// ErrUnsupportedMP3 is returned for the mpeg audio contents which are not
+	// layer III, like mp2 files, or which are mpeg 2.5
+	ErrUnsupportedMP3 = errors.New("Only mpeg 1 and 2 audio layer III contents can be decoded")
+	// ErrCorruptMP3 is returned when the frames of an mp3 content can't be
+	// decoded
+	ErrCorruptMP3 = errors.New("Corrupted mp3 content")
+)
+
+// DecodeMP3 decodes an mpeg 1 or 2 audio layer III content
+func DecodeMP3(r io.Reader) (*PCM, error) {
+	return Decode(r, MP3)
+}
+
+// mp3Decoder converts the samples of go-mp3, which are always 16 bits
+// stereo, even for the single channel contents
+type mp3Decoder struct {
+	d   *mp3.Decoder
+	buf []byte
+}
+
+func newMP3Decoder(r io.Reader) (*mp3Decoder, error) {
+	br := bufio.NewReader(r)
+	if err := checkMP3(br); err != nil {
+		return nil, err
+	}
+	// the content must have a whole audio frame
+	var d *mp3.Decoder
+	err := recoverMP3(func() error {
+		var err error
+		d, err = mp3.NewDecoder(br)
+		return err
+	})
+	if err == ErrCorruptMP3 {
+		return nil, err
+	}
+	if err != nil {
+		return nil, ErrBadHeader
+	}
+	return &mp3Decoder{d: d}, nil
+}
+
+// recoverMP3 runs fn and returns ErrCorruptMP3 if go-mp3 panics on a
+// corrupted frame
+func recoverMP3(fn func() error) (err error) {
+	defer func() {
+		if recover() != nil {
+			err = ErrCorruptMP3
+		}
+	}()
+	return fn()
+}
+
+// checkMP3 skips the ID3v2 tag, the padding and the Xing header of the
+// content, and checks that it starts with a whole layer III frame
+func checkMP3(r *bufio.Reader) error {
+	if h, err := r.Peek(10); err == nil && bytes.HasPrefix(h, []byte("ID3")) {
+		size := int(h[6])<<21 | int(h[7])<<14 | int(h[8])<<7 | int(h[9])
+		size += 10
+		if h[5]&0x10 != 0 {
+			size += 10
+		}
+		if n, _ := r.Discard(size); n < size {
+			return ErrBadHeader
+		}
+	}
+	// some encoders pad the tag with zeros
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return ErrBadHeader
+		}
+		if b == 0xFF {
+			r.UnreadByte()
+			break
+		}
+	}
+	h, err := r.Peek(4)
+	if err != nil {
+		return ErrBadHeader
+	}
+	first, ok := parseMP3Frame(h)
+	if !ok {
+		return ErrBadHeader
+	}
+	if first.layer != 3 || first.version == 3 {
+		return ErrUnsupportedMP3
+	}
+	frame, err := r.Peek(first.length)
+	if err != nil {
+		return ErrBadHeader
+	}
+	// the Xing and Info headers carry no audio
+	if hasXing(frame, first) {
+		r.Discard(first.length)
+	}
+	return nil
+}
+
+func (m *mp3Decoder) SampleRate() int { return m.d.SampleRate() }
+
+func (m *mp3Decoder) Channels() int { return 2 }
+
+func (m *mp3Decoder) Read(p []float64) (int, error) {
+	size := 2 * len(p)
+	if cap(m.buf) < size {
+		m.buf = make([]byte, size)
+	}
+	buf := m.buf[:size]
+	var k int
+	err := recoverMP3(func() error {
+		var err error
+		k, err = io.ReadFull(m.d, buf)
+		return err
+	})
+	n := k / 2
+	for i := 0; i < n; i++ {
+		p[i] = float64(int16(binary.LittleEndian.Uint16(buf[2*i:]))) / (1 << 15)
+	}
+	if err == io.ErrUnexpectedEOF || err == io.EOF {
+		if n > 0 {
+			return n, nil
+		}
+		return 0, io.EOF
+	}
+	return n, err
+}
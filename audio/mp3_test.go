@@ -0,0 +1,139 @@
+package audio
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math"
+	"testing"
+)
+
+// the sounds of the repository cover the Xing and Info headers, the ID3v2
+// tags and the mpeg 1 and 2 contents
+var mp3Sounds = []string{
+	"../data/sounds/crowd_boo.mp3",
+	"../data/sounds/sonnerie.mp3",
+	"../data/sounds/coins.mp3",
+	"../data/sounds/its-a-very-nice.mp3",
+	"../data/sounds/pikachu-thunderbolt.mp3",
+}
+
+func readSound(t testing.TB, fp string) []byte {
+	data, err := ioutil.ReadFile(fp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestDecodeMP3(t *testing.T) {
+	for _, fp := range mp3Sounds {
+		data := readSound(t, fp)
+		info, err := Probe(data)
+		if err != nil {
+			t.Fatalf("%v: %v", fp, err)
+		}
+		pcm, err := DecodeMP3(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("%v: %v", fp, err)
+		}
+		// the single channel contents are decoded in stereo
+		if pcm.SampleRate != info.SampleRate || pcm.Channels != 2 {
+			t.Errorf("%v: decoded %d Hz %d channels, want %d Hz 2 channels", fp, pcm.SampleRate, pcm.Channels, info.SampleRate)
+		}
+		if d := duration(int64(pcm.Frames()), pcm.SampleRate); d != info.Duration {
+			t.Errorf("%v: decoded %v, probed %v", fp, d, info.Duration)
+		}
+		var peak float64
+		for _, s := range pcm.Samples {
+			peak = math.Max(peak, math.Abs(s))
+		}
+		if peak < 0.01 || peak > 2 {
+			t.Errorf("%v: peak of %v", fp, peak)
+		}
+	}
+}
+
+func TestDecodeMP3Truncated(t *testing.T) {
+	data := readSound(t, "../data/sounds/crowd_boo.mp3")
+	first, ok := parseMP3Frame(data)
+	if !ok || !hasXing(data, first) {
+		t.Fatal("crowd_boo.mp3 should start with a Xing header")
+	}
+	tests := []struct {
+		size int
+		err  error
+	}{
+		{0, ErrBadHeader},
+		{3, ErrBadHeader},
+		{first.length - 1, ErrBadHeader},
+		// the Xing header alone carries no audio
+		{first.length, ErrBadHeader},
+		{first.length + 10, ErrBadHeader},
+		{3*first.length + 7, nil},
+	}
+	for _, tt := range tests {
+		pcm, err := DecodeMP3(bytes.NewReader(data[:tt.size]))
+		if err != tt.err {
+			t.Errorf("%d bytes: got error %v, want %v", tt.size, err, tt.err)
+		}
+		if err == nil && pcm.Frames()%first.samples != 0 {
+			t.Errorf("%d bytes: decoded %d samples, not whole frames", tt.size, pcm.Frames())
+		}
+	}
+}
+
+func TestDecodeMP3ID3(t *testing.T) {
+	data := readSound(t, "../data/sounds/coins.mp3")
+	if !bytes.HasPrefix(data, []byte("ID3")) {
+		t.Fatal("coins.mp3 should start with an ID3v2 tag")
+	}
+	// the tag announces more bytes than the content
+	if _, err := DecodeMP3(bytes.NewReader(data[:20])); err != ErrBadHeader {
+		t.Errorf("got error %v, want %v", err, ErrBadHeader)
+	}
+}
+
+func TestDecodeUnsupportedMP3(t *testing.T) {
+	headers := map[string][]byte{
+		// a 128kbps 44.1kHz layer II frame
+		"mp2": {0xFF, 0xFD, 0x90, 0x00},
+		// a 64kbps 11.025kHz mpeg 2.5 layer III frame
+		"mpeg 2.5": {0xFF, 0xE3, 0x80, 0x00},
+	}
+	for name, h := range headers {
+		frame := append(h, make([]byte, 1000)...)
+		if _, err := DecodeMP3(bytes.NewReader(frame)); err != ErrUnsupportedMP3 {
+			t.Errorf("%v: got error %v, want %v", name, err, ErrUnsupportedMP3)
+		}
+	}
+}
+
+func TestMP3Decoder(t *testing.T) {
+	data := readSound(t, "../data/sounds/sonnerie.mp3")
+	pcm, err := DecodeMP3(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// reading odd sizes gives the same samples as reading everything
+	d, err := NewDecoder(bytes.NewReader(data), MP3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var samples []float64
+	buf := make([]float64, 1001)
+	for {
+		n, err := d.Read(buf)
+		samples = append(samples, buf[:n]...)
+		if err != nil {
+			break
+		}
+	}
+	if len(samples) != len(pcm.Samples) {
+		t.Fatalf("read %d samples, want %d", len(samples), len(pcm.Samples))
+	}
+	for i := range samples {
+		if samples[i] != pcm.Samples[i] {
+			t.Fatalf("sample %d is %v, want %v", i, samples[i], pcm.Samples[i])
+		}
+	}
+}
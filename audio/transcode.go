@@ -0,0 +1,165 @@
+package audio
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+
+	pkgerrors "github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	// ErrUnsupportedConversion is returned when a transcoder can't convert
+	// between two formats
+	ErrUnsupportedConversion = errors.New("Unsupported audio conversion")
+)
+
+// Transcoder converts an audio file from a format to another
+type Transcoder interface {
+	Transcode(src string, from Format, dst string, to Format) error
+}
+
+// FFmpeg is a transcoder using the ffmpeg command
+type FFmpeg struct {
+	// Binary is the path of the ffmpeg command. Default to "ffmpeg".
+	Binary string
+}
+
+var ffmpegCodecs = map[Format]string{
+	MP3:  "libmp3lame",
+	OGG:  "libvorbis",
+	Opus: "libopus",
+	WAV:  "pcm_s16le",
+	FLAC: "flac",
+}
+
+func (f *FFmpeg) binary() string {
+	if f.Binary == "" {
+		return "ffmpeg"
+	}
+	return f.Binary
+}
+
+// Available returns true if the ffmpeg command can be found
+func (f *FFmpeg) Available() bool {
+	_, err := exec.LookPath(f.binary())
+	return err == nil
+}
+
+// Transcode converts src to dst with ffmpeg
+func (f *FFmpeg) Transcode(src string, from Format, dst string, to Format) error {
+	codec, ok := ffmpegCodecs[to]
+	if !ok {
+		return ErrUnsupportedConversion
+	}
+	cmd := exec.Command(
+		f.binary(),
+		"-y",
+		"-loglevel", "error",
+		"-i", src,
+		"-vn",
+		"-c:a", codec,
+		"-f", format(to),
+		dst,
+	)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return pkgerrors.Wrapf(err, "Failed to run the command: %q: %s", strings.Join(cmd.Args, " "), out)
+	}
+	return nil
+}
+
+// format returns the name of the ffmpeg muxer of the format
+func format(f Format) string {
+	if f == Opus {
+		return "ogg"
+	}
+	return f.String()
+}
+
+// WAVTranscoder is a pure go transcoder. It only rewrites wav files as 16
+// bits PCM wav files.
+type WAVTranscoder struct{}
+
+// Transcode converts a wav file to a 16 bits PCM wav file
+func (WAVTranscoder) Transcode(src string, from Format, dst string, to Format) error {
+	if from != WAV || to != WAV {
+		return ErrUnsupportedConversion
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	pcm, err := DecodeWAV(in)
+	if err != nil {
+		return err
+	}
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	err = EncodeWAV(out, pcm)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Chain is a transcoder trying each of its transcoders until one succeed
+type Chain []Transcoder
+
+// Transcode converts src to dst with the first transcoder able to do it
+func (c Chain) Transcode(src string, from Format, dst string, to Format) error {
+	err := ErrUnsupportedConversion
+	for _, t := range c {
+		err = t.Transcode(src, from, dst, to)
+		if err == nil {
+			return nil
+		}
+		logrus.WithError(err).WithFields(logrus.Fields{
+			"src":  src,
+			"from": from,
+			"to":   to,
+		}).Debug("Transcoder failed, trying next one")
+	}
+	return err
+}
+
+// NewTranscoder returns the default transcoder: ffmpeg when it is available,
+// with the pure go wav transcoder as fallback
+func NewTranscoder(ffmpeg string) Transcoder {
+	f := &FFmpeg{Binary: ffmpeg}
+	if !f.Available() {
+		logrus.WithField("ffmpeg", f.binary()).Warn("ffmpeg not found, only wav files can be transcoded")
+		return Chain{WAVTranscoder{}}
+	}
+	return Chain{f, WAVTranscoder{}}
+}
+
+// Converter converts audio files to a canonical format
+type Converter struct {
+	// Target is the canonical format. Files are not converted if it's Unknown.
+	Target     Format
+	Transcoder Transcoder
+}
+
+// Convert converts the file at fp of the given format to the target format.
+// The converted file is written next to fp with the extension of the target
+// format and fp is removed. It returns the path and the format of the
+// resulting file. Files already in the target format are left untouched.
+func (c *Converter) Convert(fp string, from Format) (string, Format, error) {
+	if c == nil || c.Target == Unknown || (from == c.Target && from != WAV) {
+		return fp, from, nil
+	}
+	dst := strings.TrimSuffix(fp, from.Ext()) + ".converted" + c.Target.Ext()
+	err := c.Transcoder.Transcode(fp, from, dst, c.Target)
+	if err != nil {
+		os.Remove(dst)
+		return fp, from, pkgerrors.Wrapf(err, "Failed to convert %v to %v", from, c.Target)
+	}
+	os.Remove(fp)
+	return dst, c.Target, nil
+}
@@ -0,0 +1,218 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+)
+
+const (
+	wavFormatPCM        = 1
+	wavFormatFloat      = 3
+	wavFormatExtensible = 0xFFFE
+)
+
+var (
+	// ErrBadWAV is returned when a wav file can't be decoded
+	ErrBadWAV = errors.New("Invalid or unsupported wav content")
+)
+
+// PCM is decoded audio. Samples are interleaved and scaled between -1 and 1.
+type PCM struct {
+	SampleRate int
+	Channels   int
+	Samples    []float64
+}
+
+// Frames returns the number of samples per channel
+func (p *PCM) Frames() int {
+	if p.Channels == 0 {
+		return 0
+	}
+	return len(p.Samples) / p.Channels
+}
+
+// WAVInfo describes the stream of a wav file
+type WAVInfo struct {
+	Format        int
+	Channels      int
+	SampleRate    int
+	BitsPerSample int
+	// DataSize is the size in bytes of the samples
+	DataSize int64
+}
+
+// readWAVHeader reads the chunks of a wav file up to the beginning of the
+// samples
+func readWAVHeader(r io.Reader) (WAVInfo, error) {
+	var info WAVInfo
+	var riff [12]byte
+	if _, err := io.ReadFull(r, riff[:]); err != nil {
+		return info, ErrBadWAV
+	}
+	if !bytes.Equal(riff[0:4], []byte("RIFF")) || !bytes.Equal(riff[8:12], []byte("WAVE")) {
+		return info, ErrBadWAV
+	}
+	fmtFound := false
+	for {
+		var chunk [8]byte
+		if _, err := io.ReadFull(r, chunk[:]); err != nil {
+			return info, ErrBadWAV
+		}
+		size := int64(binary.LittleEndian.Uint32(chunk[4:8]))
+		switch string(chunk[0:4]) {
+		case "fmt ":
+			if size < 16 {
+				return info, ErrBadWAV
+			}
+			// the fields after the sub format are not needed
+			data := make([]byte, minInt64(size, 26))
+			if _, err := io.ReadFull(r, data); err != nil {
+				return info, ErrBadWAV
+			}
+			if _, err := io.CopyN(ioutil.Discard, r, size+size%2-int64(len(data))); err != nil {
+				return info, ErrBadWAV
+			}
+			info.Format = int(binary.LittleEndian.Uint16(data[0:2]))
+			info.Channels = int(binary.LittleEndian.Uint16(data[2:4]))
+			info.SampleRate = int(binary.LittleEndian.Uint32(data[4:8]))
+			info.BitsPerSample = int(binary.LittleEndian.Uint16(data[14:16]))
+			if info.Format == wavFormatExtensible && size >= 26 {
+				// the actual format is the beginning of the sub format guid
+				info.Format = int(binary.LittleEndian.Uint16(data[24:26]))
+			}
+			fmtFound = true
+		case "data":
+			if !fmtFound {
+				return info, ErrBadWAV
+			}
+			info.DataSize = size
+			return info, nil
+		default:
+			if _, err := io.CopyN(ioutil.Discard, r, size+size%2); err != nil {
+				return info, ErrBadWAV
+			}
+		}
+	}
+}
+
+// ReadWAVInfo returns the description of the wav stream read from r
+func ReadWAVInfo(r io.Reader) (WAVInfo, error) {
+	return readWAVHeader(r)
+}
+
+// DecodeWAV decodes a PCM or float wav content
+func DecodeWAV(r io.Reader) (*PCM, error) {
+	return Decode(r, WAV)
+}
+
+// wavDecoder converts the samples of a wav content
+type wavDecoder struct {
+	info   WAVInfo
+	r      io.Reader
+	width  int
+	sample func([]byte) float64
+	buf    []byte
+}
+
+func newWAVDecoder(r io.Reader) (*wavDecoder, error) {
+	info, err := readWAVHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	d := &wavDecoder{info: info, r: r, width: info.BitsPerSample / 8}
+	switch {
+	case info.Format == wavFormatPCM && d.width == 1:
+		d.sample = func(b []byte) float64 { return (float64(b[0]) - 128) / 128 }
+	case info.Format == wavFormatPCM && d.width == 2:
+		d.sample = func(b []byte) float64 { return float64(int16(binary.LittleEndian.Uint16(b))) / (1 << 15) }
+	case info.Format == wavFormatPCM && d.width == 3:
+		d.sample = func(b []byte) float64 {
+			v := int32(uint32(b[0])<<8|uint32(b[1])<<16|uint32(b[2])<<24) >> 8
+			return float64(v) / (1 << 23)
+		}
+	case info.Format == wavFormatPCM && d.width == 4:
+		d.sample = func(b []byte) float64 { return float64(int32(binary.LittleEndian.Uint32(b))) / (1 << 31) }
+	case info.Format == wavFormatFloat && d.width == 4:
+		d.sample = func(b []byte) float64 { return float64(math.Float32frombits(binary.LittleEndian.Uint32(b))) }
+	case info.Format == wavFormatFloat && d.width == 8:
+		d.sample = func(b []byte) float64 { return math.Float64frombits(binary.LittleEndian.Uint64(b)) }
+	default:
+		return nil, fmt.Errorf("Unsupported wav encoding: format %d, %d bits", info.Format, info.BitsPerSample)
+	}
+	// the size of the streamed contents is unknown, they end with the file
+	if info.DataSize > 0 {
+		d.r = io.LimitReader(r, info.DataSize)
+	}
+	return d, nil
+}
+
+func (d *wavDecoder) SampleRate() int { return d.info.SampleRate }
+
+func (d *wavDecoder) Channels() int { return d.info.Channels }
+
+func (d *wavDecoder) Read(p []float64) (int, error) {
+	size := len(p) * d.width
+	if cap(d.buf) < size {
+		d.buf = make([]byte, size)
+	}
+	buf := d.buf[:size]
+	m, err := io.ReadFull(d.r, buf)
+	n := m / d.width
+	for i := 0; i < n; i++ {
+		p[i] = d.sample(buf[i*d.width:])
+	}
+	// a truncated last sample is dropped
+	if err == io.ErrUnexpectedEOF || err == io.EOF {
+		if n > 0 {
+			return n, nil
+		}
+		return 0, io.EOF
+	}
+	return n, err
+}
+
+// EncodeWAV writes the samples as a 16 bits PCM wav content
+func EncodeWAV(w io.Writer, pcm *PCM) error {
+	dataSize := uint32(len(pcm.Samples) * 2)
+	header := []interface{}{
+		[]byte("RIFF"), 36 + dataSize, []byte("WAVE"),
+		[]byte("fmt "), uint32(16), uint16(wavFormatPCM), uint16(pcm.Channels),
+		uint32(pcm.SampleRate), uint32(pcm.SampleRate * pcm.Channels * 2),
+		uint16(pcm.Channels * 2), uint16(16),
+		[]byte("data"), dataSize,
+	}
+	for _, v := range header {
+		if err := binary.Write(w, binary.LittleEndian, v); err != nil {
+			return err
+		}
+	}
+	buf := make([]byte, 2*len(pcm.Samples))
+	for i, s := range pcm.Samples {
+		binary.LittleEndian.PutUint16(buf[2*i:], uint16(toInt16(s)))
+	}
+	_, err := w.Write(buf)
+	return err
+}
+
+func minInt64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func toInt16(s float64) int16 {
+	v := math.Round(s * (1 << 15))
+	if v > math.MaxInt16 {
+		return math.MaxInt16
+	}
+	if v < math.MinInt16 {
+		return math.MinInt16
+	}
+	return int16(v)
+}
@@ -0,0 +1,65 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestWAVRoundTrip(t *testing.T) {
+	in := &PCM{SampleRate: 8000, Channels: 2, Samples: []float64{0, 0.5, -0.5, 1, -1, 0.25}}
+	var buf bytes.Buffer
+	if err := EncodeWAV(&buf, in); err != nil {
+		t.Fatal(err)
+	}
+	out, err := DecodeWAV(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.SampleRate != in.SampleRate || out.Channels != in.Channels || len(out.Samples) != len(in.Samples) {
+		t.Fatalf("decoded %+v, want %+v", out, in)
+	}
+	for i, s := range in.Samples {
+		if d := out.Samples[i] - s; d > 1e-4 || d < -1e-4 {
+			t.Errorf("sample %d is %v, want %v", i, out.Samples[i], s)
+		}
+	}
+}
+
+func TestDecodeWAVBadStream(t *testing.T) {
+	tests := []struct {
+		rate, channels int
+	}{
+		{0, 1},
+		{5, 1},
+		{MaxSampleRate + 1, 2},
+		{44100, 0},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		if err := EncodeWAV(&buf, &PCM{SampleRate: 8000, Channels: 1, Samples: make([]float64, 10)}); err != nil {
+			t.Fatal(err)
+		}
+		data := buf.Bytes()
+		binary.LittleEndian.PutUint16(data[22:24], uint16(tt.channels))
+		binary.LittleEndian.PutUint32(data[24:28], uint32(tt.rate))
+		if _, err := DecodeWAV(bytes.NewReader(data)); err != ErrBadStream {
+			t.Errorf("%d Hz, %d channels: got error %v, want %v", tt.rate, tt.channels, err, ErrBadStream)
+		}
+	}
+}
+
+func TestDecodeWAVTruncated(t *testing.T) {
+	var buf bytes.Buffer
+	if err := EncodeWAV(&buf, &PCM{SampleRate: 8000, Channels: 1, Samples: make([]float64, 100)}); err != nil {
+		t.Fatal(err)
+	}
+	// the samples end in the middle of the last one
+	pcm, err := DecodeWAV(bytes.NewReader(buf.Bytes()[:44+51]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pcm.Samples) != 25 {
+		t.Errorf("decoded %d samples, want 25", len(pcm.Samples))
+	}
+}
@@ -0,0 +1,174 @@
+// Package auth authenticates the callers of the bell API with static tokens
+// or HTTP basic users, and authorizes them according to their role.
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Role is the level of access of a caller. Each role is granted the access
+// of the roles below it.
+type Role int
+
+const (
+	// None is the role of callers that can't access the API
+	None Role = iota
+	// Listener can list and download sounds
+	Listener
+	// Player can play sounds and texts
+	Player
+	// Uploader can add and edit sounds
+	Uploader
+	// Admin can do anything, including deleting sounds
+	Admin
+)
+
+// String convert Role to string
+func (r Role) String() string {
+	switch r {
+	case Listener:
+		return "listener"
+	case Player:
+		return "player"
+	case Uploader:
+		return "uploader"
+	case Admin:
+		return "admin"
+	}
+	return "none"
+}
+
+// ParseRole returns the role matching the given name
+func ParseRole(s string) (Role, error) {
+	switch strings.ToLower(s) {
+	case "", "none":
+		return None, nil
+	case "listener":
+		return Listener, nil
+	case "player":
+		return Player, nil
+	case "uploader":
+		return Uploader, nil
+	case "admin":
+		return Admin, nil
+	}
+	return None, fmt.Errorf("Unknown role %q, please use listener, player, uploader or admin", s)
+}
+
+// Identity is an authenticated caller
+type Identity struct {
+	Name string
+	Role Role
+}
+
+type contextKey struct{}
+
+// FromContext returns the identity of the caller stored in the context of a
+// request by the authenticator
+func FromContext(ctx context.Context) (Identity, bool) {
+	id, ok := ctx.Value(contextKey{}).(Identity)
+	return id, ok
+}
+
+// Authenticator identifies the callers of the API. A nil Authenticator
+// disables the authentication: every caller is an anonymous admin.
+type Authenticator struct {
+	// tokens are the identities with the sha256 of their token
+	tokens []token
+	// users are the basic users with the bcrypt hash of their password
+	users map[string]user
+	// anonymous is the role of the callers without credentials
+	anonymous Role
+}
+
+type token struct {
+	Identity
+	hash string
+}
+
+type user struct {
+	Identity
+	password []byte
+}
+
+// unknownUser is compared to the passwords of the unknown users, so they take
+// as long to be refused as the wrong passwords
+var unknownUser, _ = bcrypt.GenerateFromPassword([]byte("unknown"), bcrypt.DefaultCost)
+
+// hash returns the hex encoded sha256 of a token. The tokens are random
+// enough to not need a slow hash, unlike the passwords.
+func hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// Authenticate returns the identity of the caller of the request. It returns
+// false if the request has invalid credentials.
+func (a *Authenticator) Authenticate(r *http.Request) (Identity, bool) {
+	if a == nil {
+		return Identity{Role: Admin}, true
+	}
+	if name, password, ok := r.BasicAuth(); ok {
+		u, found := a.users[name]
+		if !found {
+			bcrypt.CompareHashAndPassword(unknownUser, []byte(password))
+			return Identity{}, false
+		}
+		if bcrypt.CompareHashAndPassword(u.password, []byte(password)) != nil {
+			return Identity{}, false
+		}
+		return u.Identity, true
+	}
+	if header := r.Header.Get("Authorization"); header != "" {
+		if !strings.HasPrefix(header, "Bearer ") {
+			return Identity{}, false
+		}
+		h := []byte(hash(strings.TrimPrefix(header, "Bearer ")))
+		for _, t := range a.tokens {
+			if subtle.ConstantTimeCompare([]byte(t.hash), h) == 1 {
+				return t.Identity, true
+			}
+		}
+		return Identity{}, false
+	}
+	return Identity{Role: a.anonymous}, true
+}
+
+// Require returns a handler allowing only the callers with at least the given
+// role to call h. The identity of the caller is stored in the context of the
+// request.
+func (a *Authenticator) Require(role Role, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := a.Authenticate(r)
+		if !ok || (id.Name == "" && id.Role < role) {
+			logrus.WithFields(logrus.Fields{
+				"client": r.RemoteAddr,
+				"URL":    r.URL.Path,
+			}).Warn("Unauthenticated request")
+			w.Header().Set("WWW-Authenticate", `Basic realm="bell"`)
+			http.Error(w, "Authentication required", http.StatusUnauthorized)
+			return
+		}
+		if id.Role < role {
+			logrus.WithFields(logrus.Fields{
+				"client":   r.RemoteAddr,
+				"URL":      r.URL.Path,
+				"name":     id.Name,
+				"role":     id.Role,
+				"required": role,
+			}).Warn("Unauthorized request")
+			http.Error(w, fmt.Sprintf("The %v role is required", role), http.StatusForbidden)
+			return
+		}
+		h(w, r.WithContext(context.WithValue(r.Context(), contextKey{}, id)))
+	}
+}
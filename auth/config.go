@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Config describes the callers allowed to use the API. Tokens are given in
+// clear or as "sha256:" followed by their hex encoded sha256, and passwords in
+// clear or as their bcrypt hash.
+type Config struct {
+	// Anonymous is the role of the callers without credentials
+	Anonymous string
+	Tokens    []Credential
+	Users     []Credential
+}
+
+// Credential is a static API token or a basic user
+type Credential struct {
+	Name     string
+	Token    string
+	Password string
+	Role     string
+}
+
+// tokenHash returns the sha256 of a token of the configuration
+func tokenHash(s string) string {
+	if strings.HasPrefix(s, "sha256:") {
+		return strings.ToLower(strings.TrimPrefix(s, "sha256:"))
+	}
+	return hash(s)
+}
+
+// passwordHash returns the bcrypt hash of a password of the configuration
+func passwordHash(s string) ([]byte, error) {
+	if strings.HasPrefix(s, "sha256:") {
+		return nil, errors.New("Passwords can't be given as sha256, please use their bcrypt hash (htpasswd -nbB user password)")
+	}
+	if _, err := bcrypt.Cost([]byte(s)); err == nil {
+		return []byte(s), nil
+	}
+	return bcrypt.GenerateFromPassword([]byte(s), bcrypt.DefaultCost)
+}
+
+// New returns an authenticator for the given configuration
+func New(c Config) (*Authenticator, error) {
+	var err error
+	a := &Authenticator{
+		users: make(map[string]user),
+	}
+	a.anonymous, err = ParseRole(c.Anonymous)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Invalid role of anonymous callers")
+	}
+	for _, t := range c.Tokens {
+		if t.Name == "" || t.Token == "" {
+			return nil, errors.New("Tokens must have a name and a token")
+		}
+		id := Identity{Name: t.Name}
+		id.Role, err = ParseRole(t.Role)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Invalid role of token %v", t.Name)
+		}
+		a.tokens = append(a.tokens, token{Identity: id, hash: tokenHash(t.Token)})
+	}
+	for _, u := range c.Users {
+		if u.Name == "" || u.Password == "" {
+			return nil, errors.New("Users must have a name and a password")
+		}
+		if _, ok := a.users[u.Name]; ok {
+			return nil, errors.Errorf("User %v is defined twice", u.Name)
+		}
+		id := Identity{Name: u.Name}
+		id.Role, err = ParseRole(u.Role)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Invalid role of user %v", u.Name)
+		}
+		password, err := passwordHash(u.Password)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Invalid password of user %v", u.Name)
+		}
+		a.users[u.Name] = user{Identity: id, password: password}
+	}
+	return a, nil
+}
+
+// Load returns an authenticator configured by the file at fp. The file can
+// be in any format known by viper (yaml, json, toml...).
+func Load(fp string) (*Authenticator, error) {
+	v := viper.New()
+	v.SetConfigFile(fp)
+	err := v.ReadInConfig()
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to read authentication file %v", fp)
+	}
+	var c Config
+	err = v.Unmarshal(&c)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to decode authentication file %v", fp)
+	}
+	return New(c)
+}
@@ -0,0 +1,32 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/restanrm/bell/audio"
+	"github.com/restanrm/bell/sound"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// backfillCmd analyzes the sounds of the library that were added before
+// their analysis was done at upload
+var backfillCmd = &cobra.Command{
+	Use:   "backfill",
+	Short: "Analyze the sounds of the library that have not been analyzed yet",
+	Long: `Parse the audio properties and measure the loudness of the sounds of the library
+that have not been analyzed yet.
+The bell server must be stopped when the bolt store is used.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		force, _ := cmd.Flags().GetBool("force")
+		meter := &audio.LoudnessMeter{FFmpeg: &audio.FFmpeg{Binary: viper.GetString("ffmpeg")}}
+		n, err := sound.Backfill(newSounder(), meter, force)
+		fmt.Printf("%d sounds analyzed\n", n)
+		return err
+	},
+}
+
+func init() {
+	backfillCmd.Flags().Bool("force", false, "Analyze every sound, even the ones already analyzed")
+	rootCmd.AddCommand(backfillCmd)
+}
@@ -16,21 +16,36 @@ package cmd
 
 import (
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 
 	"github.com/gorilla/mux"
 	"github.com/rakyll/statik/fs"
+	"github.com/restanrm/bell/audio"
+	"github.com/restanrm/bell/auth"
 	"github.com/restanrm/bell/connstore"
+	"github.com/restanrm/bell/health"
+	"github.com/restanrm/bell/history"
 	localHttp "github.com/restanrm/bell/http"
+	"github.com/restanrm/bell/job"
 	"github.com/restanrm/bell/metrics"
+	"github.com/restanrm/bell/player"
+	"github.com/restanrm/bell/policy"
+	"github.com/restanrm/bell/queue"
+	"github.com/restanrm/bell/ratelimit"
+	"github.com/restanrm/bell/schedule"
 	"github.com/restanrm/bell/sound"
 	_ "github.com/restanrm/bell/statik"
+	"github.com/restanrm/bell/tts"
+	"github.com/restanrm/bell/volume"
 	"github.com/rs/cors"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -39,6 +54,10 @@ import (
 
 var cfgFile string
 
+// pollyCheckPeriod is the minimum delay between two verifications of the
+// polly credentials by the readiness probe
+const pollyCheckPeriod = 5 * time.Minute
+
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use:   "bell [OPTIONS]",
@@ -46,8 +65,6 @@ var rootCmd = &cobra.Command{
 	Long: `Bell command can run a bell server or only the front interface, or both.
 By default, both the front and the API are run on the same server.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		viper.SetDefault("soundDir", filepath.Join(viper.GetString("dataDir"), "sounds"))
-		viper.SetDefault("TTSDir", filepath.Join(viper.GetString("dataDir"), "tts"))
 		if !viper.GetBool("flite") {
 			exitIfNotSetted("polly.accessKey")
 			exitIfNotSetted("polly.secretKey")
@@ -104,15 +121,132 @@ func init() {
 	rootCmd.Flags().BoolVarP(&serverOptions.api, "api", "a", false, "Allows to run the api as standalone service")
 	rootCmd.Flags().BoolVarP(&serverOptions.front, "front", "f", false, "Allows to run the front separatly from the backend")
 
-	rootCmd.Flags().StringP("dataDir", "d", "data", "Directory where all sounds and tts sounds are stored. The configuration file should also be located there.")
-	viper.BindPFlag("dataDir", rootCmd.Flags().Lookup("dataDir"))
+	rootCmd.PersistentFlags().StringP("dataDir", "d", "data", "Directory where all sounds and tts sounds are stored. The configuration file should also be located there.")
+	viper.BindPFlag("dataDir", rootCmd.PersistentFlags().Lookup("dataDir"))
+
+	rootCmd.PersistentFlags().StringP("config", "c", "store.json", "Configuration file where description of the sounds are stored")
+	viper.BindPFlag("storefile", rootCmd.PersistentFlags().Lookup("config"))
+
+	rootCmd.PersistentFlags().String("store", "json", "Storage backend of the sounds library (json|bolt)")
+	viper.BindPFlag("store.type", rootCmd.PersistentFlags().Lookup("store"))
+
+	rootCmd.PersistentFlags().Int("store-backups", 3, "Number of backup generations kept when the json store is saved")
+	viper.BindPFlag("store.backups", rootCmd.PersistentFlags().Lookup("store-backups"))
+
+	rootCmd.PersistentFlags().String("store-db", "store.db", "Database file of the bolt storage backend, relative to the data directory")
+	viper.BindPFlag("store.db", rootCmd.PersistentFlags().Lookup("store-db"))
+
+	rootCmd.PersistentFlags().Bool("store-blobs", false, "Store the audio content of the sounds in the bolt database")
+	viper.BindPFlag("store.blobs", rootCmd.PersistentFlags().Lookup("store-blobs"))
+
+	rootCmd.PersistentFlags().Duration("trash-retention", 7*24*time.Hour, "Duration during which deleted sounds can be restored")
+	viper.BindPFlag("trash.retention", rootCmd.PersistentFlags().Lookup("trash-retention"))
+
+	rootCmd.Flags().String("upload-format", "", "Convert uploaded sounds to this format (mp3|ogg|opus|wav|flac). Sounds are kept in their format if empty")
+	viper.BindPFlag("upload.format", rootCmd.Flags().Lookup("upload-format"))
+
+	rootCmd.Flags().Int64("upload-max-size", 10*1024*1024, "Maximum size in bytes of an uploaded sound, 0 for no limit")
+	viper.BindPFlag("upload.maxSize", rootCmd.Flags().Lookup("upload-max-size"))
+
+	rootCmd.Flags().Duration("upload-max-duration", 0, "Maximum duration of an uploaded sound, 0 for no limit")
+	viper.BindPFlag("upload.maxDuration", rootCmd.Flags().Lookup("upload-max-duration"))
+
+	rootCmd.Flags().Int64("upload-quota", 0, "Maximum size in bytes of the sounds uploaded by a user, 0 for no limit")
+	viper.BindPFlag("upload.quota", rootCmd.Flags().Lookup("upload-quota"))
+
+	rootCmd.Flags().Int64("library-max-size", 0, "Maximum size in bytes of all the sounds of the library, 0 for no limit")
+	viper.BindPFlag("library.maxSize", rootCmd.Flags().Lookup("library-max-size"))
+
+	rootCmd.PersistentFlags().String("ffmpeg", "ffmpeg", "Path of the ffmpeg command used to convert sounds")
+	viper.BindPFlag("ffmpeg", rootCmd.PersistentFlags().Lookup("ffmpeg"))
+
+	rootCmd.PersistentFlags().Float64("loudness-target", -16, "Loudness in LUFS to which the sounds are normalized")
+	viper.BindPFlag("loudness.target", rootCmd.PersistentFlags().Lookup("loudness-target"))
+
+	rootCmd.Flags().Bool("loudness-normalization", true, "Normalize the loudness of the sounds when they are played")
+	viper.BindPFlag("loudness.normalize", rootCmd.Flags().Lookup("loudness-normalization"))
 
-	rootCmd.Flags().StringP("config", "c", "store.json", "Configuration file where description of the sounds are stored")
-	viper.BindPFlag("storefile", rootCmd.Flags().Lookup("config"))
+	rootCmd.Flags().String("auth-file", "", "File describing the tokens and users allowed to use the API. The API is open to anyone if empty")
+	viper.BindPFlag("auth.file", rootCmd.Flags().Lookup("auth-file"))
+
+	rootCmd.Flags().String("ratelimit-caller", "", "Plays allowed per caller, as burst/period. Empty or 0 for no limit")
+	viper.BindPFlag("ratelimit.caller", rootCmd.Flags().Lookup("ratelimit-caller"))
+
+	rootCmd.Flags().String("ratelimit-sound", "", "Plays allowed per sound, as burst/period. Empty or 0 for no limit")
+	viper.BindPFlag("ratelimit.sound", rootCmd.Flags().Lookup("ratelimit-sound"))
+
+	rootCmd.Flags().String("ratelimit-global", "", "Plays allowed in total, as burst/period. Empty or 0 for no limit")
+	viper.BindPFlag("ratelimit.global", rootCmd.Flags().Lookup("ratelimit-global"))
+
+	rootCmd.Flags().Duration("ratelimit-cooldown", 0, "Minimum delay between two plays of a same sound")
+	viper.BindPFlag("ratelimit.cooldown", rootCmd.Flags().Lookup("ratelimit-cooldown"))
+
+	rootCmd.Flags().StringSlice("ratelimit-sound-cooldown", nil, "Cooldown of a sound overriding the default one, as sound=duration. Can be repeated")
+	viper.BindPFlag("ratelimit.cooldowns", rootCmd.Flags().Lookup("ratelimit-sound-cooldown"))
+
+	rootCmd.Flags().String("policy-file", "", "File describing the quiet hours of each destination. Sounds can be played at any time if empty")
+	viper.BindPFlag("policy.file", rootCmd.Flags().Lookup("policy-file"))
+
+	rootCmd.Flags().String("schedule-file", "schedules.json", "File in the data directory where the scheduled plays are stored")
+	viper.BindPFlag("schedule.file", rootCmd.Flags().Lookup("schedule-file"))
+
+	rootCmd.Flags().String("history-file", "history.jsonl", "File in the data directory where the history of the playbacks is stored")
+	viper.BindPFlag("history.file", rootCmd.Flags().Lookup("history-file"))
+
+	rootCmd.Flags().Duration("history-retention", 90*24*time.Hour, "How long the playbacks are kept in the history. 0 to keep them forever")
+	viper.BindPFlag("history.retention", rootCmd.Flags().Lookup("history-retention"))
+
+	rootCmd.Flags().Int("history-max-entries", 100000, "Maximum number of playbacks kept in the history. 0 for no limit")
+	viper.BindPFlag("history.maxEntries", rootCmd.Flags().Lookup("history-max-entries"))
 
 	rootCmd.Flags().Bool("disable-websocket-checkorigin", false, "Disable the check of the origin for the websockets")
 	viper.BindPFlag("websocket.checkorigin.disabled", rootCmd.Flags().Lookup("disable-websocket-checkorigin"))
 
+	rootCmd.Flags().Duration("job-retention", time.Hour, "How long the finished playback jobs can be retrieved")
+	viper.BindPFlag("jobs.retention", rootCmd.Flags().Lookup("job-retention"))
+
+	rootCmd.Flags().Duration("job-wait-timeout", 2*time.Minute, "Maximum time a request waits for the end of a playback with wait=true")
+	viper.BindPFlag("jobs.waitTimeout", rootCmd.Flags().Lookup("job-wait-timeout"))
+
+	rootCmd.Flags().String("player", "mpv", "Player of the sounds on the server (mpv|ffplay|aplay|paplay|command|pcm). pcm decodes the sounds in process and writes them to the player sink")
+	viper.BindPFlag("player.type", rootCmd.Flags().Lookup("player"))
+
+	rootCmd.Flags().String("player-command", "", "Binary of the player command, the one of the player if empty")
+	viper.BindPFlag("player.command", rootCmd.Flags().Lookup("player-command"))
+
+	rootCmd.Flags().StringSlice("player-args", nil, "Arguments of the player command, with the {file}, {gain}, {volume} and {pavolume} placeholders. The ones of the player if empty")
+	viper.BindPFlag("player.args", rootCmd.Flags().Lookup("player-args"))
+
+	rootCmd.Flags().StringSlice("player-env", nil, "Environment variables of the player command, as KEY=value. Can be repeated")
+	viper.BindPFlag("player.env", rootCmd.Flags().Lookup("player-env"))
+
+	rootCmd.Flags().Duration("player-timeout", 0, "Maximum duration of a sound played by the player command, 0 for no limit")
+	viper.BindPFlag("player.timeout", rootCmd.Flags().Lookup("player-timeout"))
+
+	rootCmd.Flags().String("player-sink", "alsa", "Output of the pcm player (alsa|pulse|file|null)")
+	viper.BindPFlag("player.sink", rootCmd.Flags().Lookup("player-sink"))
+
+	rootCmd.Flags().String("player-device", "", "Device of the alsa and pulse sinks, the default one if empty, or path of the wav file of the file sink")
+	viper.BindPFlag("player.device", rootCmd.Flags().Lookup("player-device"))
+
+	rootCmd.Flags().StringSlice("player-middlewares", []string{"logging", "metrics", "mute", "volume"}, "Middlewares applied to the sounds and texts played on the server, the outermost first (logging|metrics|volume|mute|dry-run)")
+	viper.BindPFlag("player.middlewares", rootCmd.Flags().Lookup("player-middlewares"))
+
+	rootCmd.Flags().Int("player-volume", 100, "Volume in percent of the sounds played on the server, with the volume middleware, until it is changed with the API")
+	viper.BindPFlag("player.volume", rootCmd.Flags().Lookup("player-volume"))
+
+	rootCmd.Flags().Bool("player-muted", false, "Refuse the plays on the server, until it is changed with the API")
+	viper.BindPFlag("player.muted", rootCmd.Flags().Lookup("player-muted"))
+
+	rootCmd.Flags().String("player-dry-run-file", "dry-run.jsonl", "File in the data directory where the dry-run middleware records the sounds instead of playing them")
+	viper.BindPFlag("player.dryRunFile", rootCmd.Flags().Lookup("player-dry-run-file"))
+
+	rootCmd.Flags().String("volume-file", "volume.json", "File in the data directory where the volume settings of the server and of the clients are stored")
+	viper.BindPFlag("volume.file", rootCmd.Flags().Lookup("volume-file"))
+
+	rootCmd.Flags().Bool("skip-startup-checks", false, "Start even if the checks of the readiness fail")
+	viper.BindPFlag("health.skipStartup", rootCmd.Flags().Lookup("skip-startup-checks"))
+
 	viper.AutomaticEnv() // read in environment variables that match
 
 }
@@ -124,6 +258,9 @@ var serverOptions struct {
 
 // initConfig reads in config file and ENV variables if set.
 func initConfig() {
+	viper.SetDefault("soundDir", filepath.Join(viper.GetString("dataDir"), "sounds"))
+	viper.SetDefault("TTSDir", filepath.Join(viper.GetString("dataDir"), "tts"))
+	viper.SetDefault("trashDir", filepath.Join(viper.GetString("dataDir"), "trash"))
 }
 
 func exitIfNotSetted(key string) {
@@ -134,33 +271,346 @@ func exitIfNotSetted(key string) {
 	}
 }
 
+// newAuthenticator returns the authenticator of the API callers configured
+// by the authentication file. The authentication is disabled without it.
+func newAuthenticator() *auth.Authenticator {
+	fp := viper.GetString("auth.file")
+	if fp == "" {
+		logrus.Warn("No authentication file, the API is open to anyone")
+		return nil
+	}
+	a, err := auth.Load(fp)
+	if err != nil {
+		logrus.WithError(err).Fatal("Failed to load the authentication file")
+	}
+	return a
+}
+
+// newLimiter returns the rate limiter of the plays configured by the
+// ratelimit options
+func newLimiter() *ratelimit.Limiter {
+	var c ratelimit.Config
+	var err error
+	for key, rule := range map[string]*ratelimit.Rule{
+		"ratelimit.caller": &c.Caller,
+		"ratelimit.sound":  &c.Sound,
+		"ratelimit.global": &c.Global,
+	} {
+		*rule, err = ratelimit.ParseRule(viper.GetString(key))
+		if err != nil {
+			logrus.WithError(err).Fatal("Invalid rate limit")
+		}
+	}
+	c.Cooldown = viper.GetDuration("ratelimit.cooldown")
+	c.Cooldowns, err = ratelimit.ParseCooldowns(viper.GetStringSlice("ratelimit.cooldowns"))
+	if err != nil {
+		logrus.WithError(err).Fatal("Invalid cooldown")
+	}
+	return ratelimit.New(c)
+}
+
+// newPolicy returns the quiet hours policy configured by the policy file. Sounds
+// can be played at any time without it. The muted destinations are denied.
+func newPolicy(m policy.Muter) *policy.Policy {
+	p, err := policy.New(policy.Config{})
+	if fp := viper.GetString("policy.file"); fp != "" {
+		p, err = policy.Load(fp)
+	}
+	if err != nil {
+		logrus.WithError(err).Fatal("Failed to load the policy file")
+	}
+	p.SetMuter(m)
+	return p
+}
+
+// newVolumeControls returns the volume settings of the destinations stored in
+// the volume file. The settings of the server default to the player volume
+// and muted options, and the clients receive theirs when they register or
+// when they change.
+func newVolumeControls(cs *connstore.ConnStore) *volume.Controls {
+	controls, err := volume.Load(filepath.Join(viper.GetString("dataDir"), viper.GetString("volume.file")))
+	if err != nil {
+		logrus.WithError(err).Fatal("Failed to load the volume file")
+	}
+	err = controls.SetDefault(policy.Server, volume.Settings{
+		Volume: viper.GetInt("player.volume"),
+		Muted:  viper.GetBool("player.muted"),
+	})
+	if err != nil {
+		logrus.WithError(err).Fatal("Invalid player volume")
+	}
+	controls.Watch(func(dest string, s volume.Settings) {
+		if dest == policy.Server {
+			return
+		}
+		if err := localHttp.VolumeOnClient(cs, dest, s); err != nil {
+			logrus.WithError(err).WithField("client", dest).Info("Volume applied when the client registers")
+		}
+	})
+	cs.OnRegister(func(name string) {
+		if err := localHttp.VolumeOnClient(cs, name, controls.Get(name)); err != nil {
+			logrus.WithError(err).WithField("client", name).Warn("Failed to send the volume to the client")
+		}
+	})
+	return controls
+}
+
+// healthChecks returns the checks of the liveness and of the readiness of
+// the server. The liveness only verifies the state of the process, the
+// readiness also verifies the binaries and the polly credentials when polly
+// is used, at most every pollyCheckPeriod. A failure of polly only warns, as
+// flite says the texts meanwhile.
+func healthChecks(sounds sound.Sounder) (live, ready []health.Check) {
+	live = []health.Check{
+		{Name: "datadir", Run: health.Writable(viper.GetString("dataDir"))},
+	}
+	if checker, ok := sounds.(sound.Checker); ok {
+		live = append(live, health.Check{Name: "store", Run: checker.Check})
+	}
+	ready = append(ready, live...)
+	ready = append(ready, health.Check{Name: "flite", Run: health.Binary("flite")})
+	c, err := player.CommandFromViper("player")
+	switch {
+	case viper.GetString("player.type") != "pcm":
+		if err == nil {
+			ready = append(ready, health.Check{Name: c.Name(), Run: health.Binary(c.Binary)})
+		}
+	case viper.GetString("player.sink") == "alsa":
+		ready = append(ready, health.Check{Name: "aplay", Run: health.Binary("aplay")})
+	case viper.GetString("player.sink") == "pulse":
+		ready = append(ready, health.Check{Name: "pacat", Run: health.Binary("pacat")})
+	case viper.GetString("player.sink") == "file":
+		ready = append(ready, health.Check{Name: "sink", Run: health.Writable(filepath.Dir(viper.GetString("player.device")))})
+	}
+	if !viper.GetBool("flite") {
+		t := tts.NewTTS(false, viper.GetString("polly.accessKey"), viper.GetString("polly.secretKey"))
+		ready = append(ready, health.Check{
+			Name:     "polly",
+			Run:      health.Cached(pollyCheckPeriod, t.CheckPolly),
+			Optional: true,
+		})
+	}
+	return live, ready
+}
+
+// checkPCMFormats stops the server when the pcm player is selected with
+// sounds it can't decode: the flac and opus ones of the library, or the
+// uploads converted to these formats
+func checkPCMFormats(sounds sound.Sounder, target audio.Format) {
+	if target != audio.Unknown && !target.Decodable() {
+		logrus.WithField("format", target).Fatal("The pcm player can't play this upload format, please use mp3, ogg or wav")
+	}
+	var names []string
+	for _, s := range sounds.GetSounds() {
+		f, err := audio.ParseFormat(filepath.Ext(s.FilePath))
+		if err == nil && f != audio.Unknown && !f.Decodable() {
+			names = append(names, s.Name)
+		}
+	}
+	if len(names) > 0 {
+		logrus.WithField("sounds", strings.Join(names, ", ")).Fatal("The pcm player can't play the flac and opus sounds of the library, please convert them or use another player")
+	}
+}
+
+// newPlayer returns the player of the sounds on the server selected with the
+// player options
+func newPlayer() player.Player {
+	if viper.GetString("player.type") == "pcm" {
+		sink, err := player.NewSink(viper.GetString("player.sink"), viper.GetString("player.device"))
+		if err != nil {
+			logrus.WithError(err).Fatal("Invalid player sink")
+		}
+		return player.NewPCMPlayer(sink)
+	}
+	c, err := player.CommandFromViper("player")
+	if err != nil {
+		logrus.WithError(err).Fatal("Invalid player, please use mpv, ffplay, aplay, paplay, command or pcm")
+	}
+	return player.NewCommandPlayer(c)
+}
+
+// withMiddlewares wraps p with the player middlewares option. The volume and
+// mute middlewares follow the settings of the server.
+func withMiddlewares(p player.Player, controls *volume.Controls) player.Player {
+	names := viper.GetStringSlice("player.middlewares")
+	var dryRun io.Writer
+	var err error
+	for _, name := range names {
+		if name != "dry-run" {
+			continue
+		}
+		fp := filepath.Join(viper.GetString("dataDir"), viper.GetString("player.dryRunFile"))
+		dryRun, err = os.OpenFile(fp, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			logrus.WithError(err).Fatal("Failed to open the dry-run file")
+		}
+		logrus.WithField("file", fp).Warn("Dry-run, the sounds are recorded instead of played")
+	}
+	mws, err := player.Middlewares(names, controls, policy.Server, dryRun)
+	if err != nil {
+		logrus.WithError(err).Fatal("Invalid player middlewares")
+	}
+	return player.Chain(p, mws...)
+}
+
+// newSounder returns the sound library using the storage backend selected
+// with the store option
+func newSounder() sound.Sounder {
+	jsonStore := filepath.Join(viper.GetString("dataDir"), viper.GetString("storefile"))
+	switch viper.GetString("store.type") {
+	case "json":
+		return sound.New(jsonStore, viper.GetInt("store.backups"))
+	case "bolt":
+		dbPath := filepath.Join(viper.GetString("dataDir"), viper.GetString("store.db"))
+		b, err := sound.NewBolt(dbPath, viper.GetBool("store.blobs"))
+		if err != nil {
+			logrus.WithError(err).Fatal("Failed to open the sound database")
+		}
+		// one-shot migration of an existing json store into a new database
+		if _, err := os.Stat(jsonStore); err == nil && b.Empty() {
+			n, err := b.ImportJSON(jsonStore)
+			if err != nil {
+				logrus.WithError(err).Fatal("Failed to migrate json store into the sound database")
+			}
+			logrus.WithFields(logrus.Fields{
+				"from":   jsonStore,
+				"to":     dbPath,
+				"sounds": n,
+			}).Info("Sounds library migrated into the database")
+		}
+		return b
+	}
+	logrus.Fatalf("Unknown store %q, please use json or bolt", viper.GetString("store.type"))
+	return nil
+}
+
 func prepareAPI(r *mux.Router) {
 	var sounds sound.Sounder
-	sounds = sound.New(filepath.Join(viper.GetString("dataDir"), viper.GetString("storefile")))
+	sounds = newSounder()
 	sounds = sound.NewLoggingSound(sounds)
+	prometheus.MustRegister(metrics.LibrarySize(func() (int, int64) {
+		var size int64
+		all := sounds.GetSounds()
+		for _, s := range all {
+			size += s.Size
+		}
+		return len(all), size
+	}))
+
+	live, ready := healthChecks(sounds)
+	if !viper.GetBool("health.skipStartup") {
+		report := health.Run(ready...)
+		for _, f := range report.Warnings() {
+			logrus.WithField("check", f.Name).Warn(f.Error)
+		}
+		for _, f := range report.Failures() {
+			logrus.WithField("check", f.Name).Error(f.Error)
+		}
+		if !report.Healthy() {
+			logrus.Fatal("The server is not ready, fix the failed checks or start with --skip-startup-checks")
+		}
+	}
+	r.HandleFunc("/healthz", localHttp.Health(live...)).Methods("GET")
+	r.HandleFunc("/readyz", localHttp.Health(ready...)).Methods("GET")
 
 	api := r.PathPrefix("/api/v1").Subrouter()
 
-	cs := connstore.New()
-
-	// register metrics endpoint
+	format, err := audio.ParseFormat(viper.GetString("upload.format"))
+	if err != nil {
+		logrus.WithError(err).Fatal("Invalid canonical format of the uploaded sounds")
+	}
+	conv := &audio.Converter{
+		Target:     format,
+		Transcoder: audio.NewTranscoder(viper.GetString("ffmpeg")),
+	}
+	up := &localHttp.Uploads{
+		Converter: conv,
+		Meter:     &audio.LoudnessMeter{FFmpeg: &audio.FFmpeg{Binary: viper.GetString("ffmpeg")}},
+		MaxSize:   viper.GetInt64("upload.maxSize"),
+		Limits: sound.Limits{
+			MaxDuration: viper.GetDuration("upload.maxDuration"),
+			LibrarySize: viper.GetInt64("library.maxSize"),
+			Quota:       viper.GetInt64("upload.quota"),
+		},
+	}
+	if viper.GetString("player.type") == "pcm" {
+		checkPCMFormats(sounds, format)
+		up.Playable = audio.Format.Decodable
+	}
 
-	api.HandleFunc("/", instProm("root", localHttp.ListSounds(sounds)))
-	api.HandleFunc("/play/{sound:[-a-zA-Z0-9]+}", instProm("play", localHttp.SoundPlayer(sounds, cs)))
-	api.HandleFunc("/sounds", instProm("add", localHttp.AddSound(sounds))).Methods("POST")
-	api.HandleFunc("/sounds", instProm("list", localHttp.ListSounds(sounds))).Methods("GET")
-	api.HandleFunc("/sounds/{sound:[-a-zA-Z0-9]+}", instProm("delete", localHttp.DeleteSound(sounds))).Methods("DELETE")
-	api.HandleFunc("/sounds/{sound:[-a-zA-Z0-9]+}", instProm("get", localHttp.GetSound(sounds))).Methods("GET")
+	authn := newAuthenticator()
+	limiter := newLimiter()
+	hist, err := history.New(
+		filepath.Join(viper.GetString("dataDir"), viper.GetString("history.file")),
+		viper.GetDuration("history.retention"),
+		viper.GetInt("history.maxEntries"),
+	)
+	if err != nil {
+		logrus.WithError(err).Fatal("Failed to load the history")
+	}
+	jobs := job.New(viper.GetDuration("jobs.retention"))
+	jobs.OnFinish(localHttp.FinishHistory(hist))
+	cs := connstore.New(jobs)
+	controls := newVolumeControls(cs)
+	pol := newPolicy(controls)
+	q := queue.New(withMiddlewares(newPlayer(), controls), jobs)
+
+	sch, err := schedule.New(
+		filepath.Join(viper.GetString("dataDir"), viper.GetString("schedule.file")),
+		localHttp.ScheduleRunner(sounds, q, cs, pol, hist, jobs),
+	)
+	if err != nil {
+		logrus.WithError(err).Fatal("Failed to load the schedules")
+	}
 
-	api.HandleFunc("/tts", instProm("say", localHttp.TtsPostHandler(cs))).Methods("POST")
-	api.HandleFunc("/tts/retrieve", instProm("getsay", localHttp.TtsGetPostHandler())).Methods("POST")
-	api.HandleFunc("/tts", instProm("sayform", localHttp.TtsGetHandler())).Methods("GET")
+	// register metrics endpoint
 
-	api.HandleFunc("/mattermost", instProm("mattermost", localHttp.MattermostHandler(sounds, cs))).Methods("POST")
+	api.HandleFunc("/", instProm("root", authn.Require(auth.Listener, localHttp.ListSounds(sounds))))
+	api.HandleFunc("/play/{sound:[-a-zA-Z0-9]+}", instProm("play", authn.Require(auth.Player, localHttp.RateLimit(limiter, "play", localHttp.PlayLimitKeys, localHttp.SoundPlayer(sounds, q, cs, pol, hist, jobs)))))
+	api.HandleFunc("/sounds", instProm("add", authn.Require(auth.Uploader, localHttp.AddSound(sounds, up)))).Methods("POST")
+	api.HandleFunc("/sounds", instProm("list", authn.Require(auth.Listener, localHttp.ListSounds(sounds)))).Methods("GET")
+	api.HandleFunc("/sounds/{sound:[-a-zA-Z0-9]+}", instProm("delete", authn.Require(auth.Admin, localHttp.DeleteSound(sounds, sch)))).Methods("DELETE")
+	api.HandleFunc("/sounds/{sound:[-a-zA-Z0-9]+}", instProm("get", authn.Require(auth.Listener, localHttp.GetSound(sounds)))).Methods("GET")
+	api.HandleFunc("/sounds/{sound:[-a-zA-Z0-9]+}", instProm("patch", authn.Require(auth.Uploader, localHttp.PatchSound(sounds, up, sch)))).Methods("PATCH")
+	api.HandleFunc("/sounds/{sound:[-a-zA-Z0-9]+}/restore", instProm("restore", authn.Require(auth.Uploader, localHttp.RestoreSound(sounds)))).Methods("POST")
+	api.HandleFunc("/tags", instProm("tags", authn.Require(auth.Listener, localHttp.ListTags(sounds)))).Methods("GET")
+	api.HandleFunc("/tags/{tag:[-a-zA-Z0-9]+}", instProm("tagSounds", authn.Require(auth.Listener, localHttp.ListTagSounds(sounds)))).Methods("GET")
+	api.HandleFunc("/tags/{tag:[-a-zA-Z0-9]+}", instProm("tagAdd", authn.Require(auth.Uploader, localHttp.AddTag(sounds)))).Methods("POST")
+	api.HandleFunc("/tags/{tag:[-a-zA-Z0-9]+}", instProm("tagDelete", authn.Require(auth.Admin, localHttp.DeleteTag(sounds)))).Methods("DELETE")
+	api.HandleFunc("/tags/{tag:[-a-zA-Z0-9]+}/rename", instProm("tagRename", authn.Require(auth.Uploader, localHttp.RenameTag(sounds)))).Methods("POST")
+	api.HandleFunc("/trash", instProm("trash", authn.Require(auth.Listener, localHttp.ListDeletedSounds(sounds)))).Methods("GET")
+
+	api.HandleFunc("/tts", instProm("say", authn.Require(auth.Player, localHttp.RateLimit(limiter, "say", localHttp.TtsLimitKeys, localHttp.TtsPostHandler(q, cs, pol, hist, jobs))))).Methods("POST")
+	api.HandleFunc("/tts/retrieve", instProm("getsay", authn.Require(auth.Listener, localHttp.TtsGetPostHandler()))).Methods("POST")
+	api.HandleFunc("/tts", instProm("sayform", authn.Require(auth.Listener, localHttp.TtsGetHandler()))).Methods("GET")
+
+	// mattermost authenticates its requests with its own token
+	api.HandleFunc("/mattermost", instProm("mattermost", localHttp.MattermostToken(localHttp.RateLimit(limiter, "mattermost", localHttp.MattermostLimitKeys, localHttp.MattermostHandler(sounds, q, cs, pol, hist, jobs))))).Methods("POST")
+
+	api.HandleFunc("/queue", instProm("queueList", authn.Require(auth.Listener, localHttp.ListQueue(q)))).Methods("GET")
+	api.HandleFunc("/queue/skip", instProm("queueSkip", authn.Require(auth.Player, localHttp.SkipQueue(q)))).Methods("POST")
+	api.HandleFunc("/queue/{id}", instProm("queueRemove", authn.Require(auth.Player, localHttp.RemoveFromQueue(q)))).Methods("DELETE")
+	api.HandleFunc("/stop", instProm("stop", authn.Require(auth.Player, localHttp.StopPlayback(q, cs, jobs)))).Methods("POST")
+	api.HandleFunc("/volume", instProm("volumeGet", authn.Require(auth.Listener, localHttp.GetVolume(controls)))).Methods("GET")
+	api.HandleFunc("/volume", instProm("volumeSet", authn.Require(auth.Admin, localHttp.SetVolume(controls)))).Methods("PUT")
+
+	api.HandleFunc("/sequences", instProm("sequenceList", authn.Require(auth.Listener, localHttp.ListSequences(sounds)))).Methods("GET")
+	api.HandleFunc("/sequences/{name:[-a-zA-Z0-9]+}", instProm("sequenceGet", authn.Require(auth.Listener, localHttp.GetSequence(sounds)))).Methods("GET")
+	api.HandleFunc("/sequences/{name:[-a-zA-Z0-9]+}", instProm("sequenceSave", authn.Require(auth.Uploader, localHttp.SaveSequence(sounds)))).Methods("PUT")
+	api.HandleFunc("/sequences/{name:[-a-zA-Z0-9]+}", instProm("sequenceDelete", authn.Require(auth.Uploader, localHttp.DeleteSequence(sounds)))).Methods("DELETE")
+	api.HandleFunc("/sequences/{name:[-a-zA-Z0-9]+}/play", instProm("sequencePlay", authn.Require(auth.Player, localHttp.RateLimit(limiter, "sequencePlay", localHttp.SequenceLimitKeys, localHttp.SequencePlayer(sounds, q, cs, pol, hist, jobs))))).Methods("POST")
+
+	api.HandleFunc("/history", instProm("history", authn.Require(auth.Listener, localHttp.ListHistory(hist)))).Methods("GET")
+	api.HandleFunc("/stats", instProm("stats", authn.Require(auth.Listener, localHttp.GetStats(sounds, hist)))).Methods("GET")
+	api.HandleFunc("/jobs/{id:[-a-f0-9]+}", instProm("job", authn.Require(auth.Listener, localHttp.GetJob(jobs)))).Methods("GET")
+
+	api.HandleFunc("/schedules", instProm("scheduleList", authn.Require(auth.Listener, localHttp.ListSchedules(sch)))).Methods("GET")
+	api.HandleFunc("/schedules", instProm("scheduleAdd", authn.Require(auth.Player, localHttp.AddSchedule(sounds, sch)))).Methods("POST")
+	api.HandleFunc("/schedules/{id}", instProm("scheduleRemove", authn.Require(auth.Player, localHttp.RemoveSchedule(sch)))).Methods("DELETE")
 
 	// websocket handler
-	api.HandleFunc("/clients", instProm("connStoreList", localHttp.ListClients(cs))).Methods("Get")
-	api.HandleFunc("/clients/register", instProm("connStoreRegister", localHttp.RegisterClients(cs))).Methods("GET")
+	api.HandleFunc("/clients", instProm("connStoreList", authn.Require(auth.Listener, localHttp.ListClients(cs)))).Methods("Get")
+	api.HandleFunc("/clients/register", instProm("connStoreRegister", authn.Require(auth.Player, localHttp.RegisterClients(cs)))).Methods("GET")
 
 }
 
@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"bytes"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"mime/multipart"
@@ -112,6 +113,7 @@ func add(file, name string, tags ...string) (err error) {
 			"body":        string(content),
 			"soundName":   name,
 		}).Info("Failed to add new sound to bell server")
+		err = fmt.Errorf("bell server answered %v", resp.StatusCode)
 		return
 	}
 	return
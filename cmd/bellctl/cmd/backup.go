@@ -33,7 +33,7 @@ var backupCmd = &cobra.Command{
 			sleepRate = time.Duration(0)
 		}
 
-		sounds, err := list()
+		sounds, err := list("")
 		if err != nil {
 			return
 		}
@@ -1,8 +1,10 @@
 package cmd
 
 import (
+	"io/ioutil"
 	"net/http"
 	"net/url"
+	"strings"
 
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -45,11 +47,14 @@ var deleteCmd = &cobra.Command{
 			}).Error("Failed to contact bell server")
 			return
 		}
+		defer resp.Body.Close()
 		if resp.StatusCode > 299 {
+			message, _ := ioutil.ReadAll(resp.Body)
 			logrus.WithFields(logrus.Fields{
 				"sound":       sound,
 				"status_code": resp.StatusCode,
-			}).Info("Failed to play the sound")
+				"message":     strings.TrimSpace(string(message)),
+			}).Info("Failed to delete the sound")
 		}
 	},
 }
@@ -0,0 +1,163 @@
+package cmd
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// editCmd represents the edit command
+var editCmd = &cobra.Command{
+	Use:   "edit",
+	Short: "Edit a sound of the library",
+	Long:  `Allows to rename a sound, change its tags or volume or replace its audio file.`,
+	Example: `
+  bellctl edit toto --rename titi
+  bellctl edit toto --file ./new.mp3 --add-tag fun --remove-tag bad
+  bellctl edit toto --volume -6
+	`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		values := url.Values{}
+		if name := cmd.Flag("rename").Value.String(); name != "" {
+			values.Set("rename", name)
+		}
+		if volume := cmd.Flag("volume").Value.String(); volume != "" {
+			values.Set("volume", volume)
+		}
+		for _, t := range editOptions.addTags {
+			values.Add("addTag", t)
+		}
+		for _, t := range editOptions.removeTags {
+			values.Add("removeTag", t)
+		}
+		file := cmd.Flag("file").Value.String()
+		if len(values) == 0 && file == "" {
+			logrus.Error("Nothing to edit, please use --rename, --file, --volume, --add-tag or --remove-tag")
+			return
+		}
+		err := patch(args[0], values, file)
+		if err != nil {
+			logrus.WithError(err).Error("Failed to edit the sound")
+			return
+		}
+		logrus.Info("Sound successfully edited")
+	},
+}
+
+// tagCmd represents the tag command
+var tagCmd = &cobra.Command{
+	Use:   "tag",
+	Short: "Add or remove tags of a sound",
+}
+
+var tagAddCmd = &cobra.Command{
+	Use:     "add SOUND TAG...",
+	Short:   "Add tags to a sound",
+	Example: `  bellctl tag add toto fun insulte`,
+	Args:    cobra.MinimumNArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		err := patch(args[0], url.Values{"addTag": args[1:]}, "")
+		if err != nil {
+			logrus.WithError(err).Error("Failed to add tags to the sound")
+		}
+	},
+}
+
+var tagRemoveCmd = &cobra.Command{
+	Use:     "rm SOUND TAG...",
+	Aliases: []string{"remove", "del"},
+	Short:   "Remove tags from a sound",
+	Example: `  bellctl tag rm toto insulte`,
+	Args:    cobra.MinimumNArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		err := patch(args[0], url.Values{"removeTag": args[1:]}, "")
+		if err != nil {
+			logrus.WithError(err).Error("Failed to remove tags from the sound")
+		}
+	},
+}
+
+var editOptions struct {
+	addTags    []string
+	removeTags []string
+}
+
+func init() {
+	rootCmd.AddCommand(editCmd)
+	editCmd.Flags().StringP("rename", "r", "", "New name of the sound")
+	editCmd.Flags().StringP("file", "f", "", "Filepath of the new audio file of the sound")
+	editCmd.Flags().String("volume", "", "Gain in dB applied when the sound is played, or \"auto\" to normalize its loudness")
+	editCmd.Flags().StringSliceVarP(&editOptions.addTags, "add-tag", "a", []string{}, "List of tags to add to the sound")
+	editCmd.Flags().StringSliceVarP(&editOptions.removeTags, "remove-tag", "d", []string{}, "List of tags to remove from the sound")
+
+	rootCmd.AddCommand(tagCmd)
+	tagCmd.AddCommand(tagAddCmd)
+	tagCmd.AddCommand(tagRemoveCmd)
+}
+
+// patch sends the edition of a sound to the bell server. If file is not
+// empty, it is sent as the new audio content of the sound.
+func patch(sound string, values url.Values, file string) error {
+	address, err := url.Parse(viper.GetString("bell.address") + GetSoundPath + sound)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to build url")
+	}
+
+	var body io.Reader
+	var contentType string
+	if file == "" {
+		body = strings.NewReader(values.Encode())
+		contentType = "application/x-www-form-urlencoded"
+	} else {
+		bodyBuf := &bytes.Buffer{}
+		bodyWriter := multipart.NewWriter(bodyBuf)
+		for k, vs := range values {
+			for _, v := range vs {
+				bodyWriter.WriteField(k, v)
+			}
+		}
+		fileWriter, err := bodyWriter.CreateFormFile("uploadFile", file)
+		if err != nil {
+			return errors.Wrapf(err, "Failed to create form file")
+		}
+		fh, err := os.Open(file)
+		if err != nil {
+			return errors.Wrapf(err, "Failed to read the given file")
+		}
+		defer fh.Close()
+		if _, err = io.Copy(fileWriter, fh); err != nil {
+			return errors.Wrapf(err, "Failed to copy content of file to request writer")
+		}
+		contentType = bodyWriter.FormDataContentType()
+		bodyWriter.Close()
+		body = bodyBuf
+	}
+
+	req, err := http.NewRequest(http.MethodPatch, address.String(), body)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to create request to edit resource")
+	}
+	req.Header.Set("Content-Type", contentType)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to contact bell server")
+	}
+	defer resp.Body.Close()
+	content, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode > 299 {
+		return errors.Errorf("bell server answered %v: %v", resp.StatusCode, strings.TrimSpace(string(content)))
+	}
+	logrus.WithField("sound", string(content)).Debug("Sound edited")
+	return nil
+}
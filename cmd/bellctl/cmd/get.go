@@ -24,6 +24,7 @@ import (
 	"path/filepath"
 
 	"github.com/pkg/errors"
+	"github.com/restanrm/bell/audio"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -43,7 +44,7 @@ var getCmd = &cobra.Command{
 
 		output := cmd.Flag("output").Value.String()
 
-		err := get(sound, output)
+		_, err := get(sound, output)
 		if err != nil {
 			return
 		}
@@ -56,7 +57,9 @@ func init() {
 	getCmd.Flags().StringP("output", "o", "-", "Filepath of where to save the file content")
 }
 
-func get(sound, output string) (err error) {
+// get writes the content of a sound to output, stdout for "-", and returns
+// its format announced by the server
+func get(sound, output string) (format audio.Format, err error) {
 	address, err := url.Parse(viper.GetString("bell.address") + GetSoundPath + sound)
 	if err != nil {
 		logrus.WithFields(logrus.Fields{
@@ -75,6 +78,10 @@ func get(sound, output string) (err error) {
 		return
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode > 299 {
+		return format, errors.Errorf("bell server answered %v to the retrieval of %v", resp.StatusCode, sound)
+	}
+	format = audio.ParseMIMEType(resp.Header.Get("Content-Type"))
 
 	var w io.WriteCloser
 	if output == "-" {
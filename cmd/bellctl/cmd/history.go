@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/restanrm/bell/api"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var historyOptions struct {
+	filters map[string]*string
+	limit   int
+	page    int
+}
+
+// historyCmd represents the history command
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "Show who played what, the most recent first",
+	Example: `
+  bellctl history --caller alice --since 24h
+  bellctl history --source mattermost --result denied --page 2
+	`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		q := url.Values{}
+		for name, v := range historyOptions.filters {
+			if *v != "" {
+				q.Set(name, *v)
+			}
+		}
+		if historyOptions.page < 1 {
+			historyOptions.page = 1
+		}
+		q.Set("limit", strconv.Itoa(historyOptions.limit))
+		q.Set("offset", strconv.Itoa((historyOptions.page-1)*historyOptions.limit))
+
+		var page api.HistoryPage
+		err := apiRequest(http.MethodGet, HistoryPath+"?"+q.Encode(), nil, &page)
+		if err != nil {
+			logrus.WithError(err).Error("Failed to retrieve the history")
+			return
+		}
+		if len(page.Entries) == 0 {
+			logrus.Infof("Nothing in the history (%d entries matching)", page.Total)
+			return
+		}
+		rows := [][]string{{"Time", "Caller", "Source", "Played", "Destination", "Result", "Reason"}}
+		for _, e := range page.Entries {
+			played := e.Sound
+			switch {
+			case e.Tag != "":
+				played = fmt.Sprintf("%v (tag %v)", e.Sound, e.Tag)
+			case e.Text != "":
+				played = fmt.Sprintf("say %q", e.Text)
+			case e.Sequence != "":
+				played = "sequence " + e.Sequence
+			}
+			rows = append(rows, []string{
+				e.Time.Local().Format("2006-01-02 15:04:05"),
+				e.Caller,
+				e.Source,
+				played,
+				e.Destination,
+				e.Result,
+				e.Reason,
+			})
+		}
+		sizes := getMaxColumnSizes(rows)
+		printHeader(sizes, rows[0])
+		for _, row := range rows[1:] {
+			printLine(sizes, row)
+		}
+		printFooter(sizes)
+		pages := (page.Total + page.Limit - 1) / page.Limit
+		fmt.Printf("Page %d of %d, %d entries\n", historyOptions.page, pages, page.Total)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(historyCmd)
+
+	historyOptions.filters = make(map[string]*string)
+	for _, f := range []struct{ name, usage string }{
+		{"caller", "Only the playbacks of this caller"},
+		{"source", "Only the playbacks from this source (rest|mattermost|schedule)"},
+		{"sound", "Only the playbacks of this sound"},
+		{"tag", "Only the playbacks of this tag"},
+		{"sequence", "Only the playbacks of this sequence"},
+		{"text", "Only the texts to speech containing this text"},
+		{"destination", "Only the playbacks on this destination (server for the server)"},
+		{"result", "Only the playbacks with this result (queued|played|denied|failed|removed|interrupted)"},
+		{"since", "Only the playbacks after this RFC 3339 time, or this duration ago like 24h"},
+		{"until", "Only the playbacks before this RFC 3339 time, or this duration ago like 24h"},
+	} {
+		historyOptions.filters[f.name] = historyCmd.Flags().String(f.name, "", f.usage)
+	}
+	historyCmd.Flags().IntVarP(&historyOptions.limit, "limit", "n", 20, "Number of playbacks per page")
+	historyCmd.Flags().IntVarP(&historyOptions.page, "page", "p", 1, "Page to show, the most recent first")
+}
@@ -4,17 +4,23 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/url"
 	"strings"
 
-	localHttp "github.com/restanrm/bell/http"
+	"github.com/restanrm/bell/api"
 	"github.com/restanrm/bell/sound"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
+var listOptions struct {
+	long bool
+	sort string
+}
+
 // listCmd represents the list command
 var listCmd = &cobra.Command{
 	Use:     "list",
@@ -22,7 +28,7 @@ var listCmd = &cobra.Command{
 	Long:    ``,
 	Aliases: []string{`ls`},
 	Run: func(cmd *cobra.Command, args []string) {
-		sounds, err := list()
+		sounds, err := list(listOptions.sort)
 		if err != nil {
 			return
 		}
@@ -43,52 +49,88 @@ var listCmd = &cobra.Command{
 				fmt.Printf("  - %v\n", k)
 			}
 		} else {
-			// get max column sizes for sounds and tags
-			ta, tb := "Sound", "Tags"
-			mls, mlt := getMaxColumnSizes(sounds, ta, tb)
-			printHeader(mls, mlt, ta, tb)
+			header := []string{"Sound", "Tags"}
+			if listOptions.long {
+				header = append(header, "Duration", "Size", "Rate", "Channels", "Loudness", "Uploaded", "Uploader")
+			}
+			rows := [][]string{header}
 			for _, sound := range sounds {
-				printLine(mls, mlt, sound.Name, strings.Join(sound.Tags, ","))
+				rows = append(rows, soundRow(sound, listOptions.long))
+			}
+			sizes := getMaxColumnSizes(rows)
+			printHeader(sizes, header)
+			for _, row := range rows[1:] {
+				printLine(sizes, row)
 			}
-			printFooter(mls, mlt)
+			printFooter(sizes)
 		}
 	},
 }
 
-func printHeader(mls, mlt int, ta, tb string) {
-	printDashLine(mls, mlt)
-	printLine(mls, mlt, ta, tb)
-	printDashLine(mls, mlt)
+// soundRow returns the cells describing a sound in the list of sounds
+func soundRow(s sound.Sound, long bool) []string {
+	row := []string{s.Name, strings.Join(s.Tags, ",")}
+	if !long {
+		return row
+	}
+	loudness, uploaded := "", ""
+	if s.Loudness != nil {
+		loudness = fmt.Sprintf("%.1f LUFS", *s.Loudness)
+	}
+	if s.UploadedAt != nil {
+		uploaded = s.UploadedAt.Local().Format("2006-01-02 15:04")
+	}
+	return append(row,
+		fmt.Sprintf("%.1fs", s.Duration),
+		fmt.Sprintf("%.1f kB", float64(s.Size)/1000),
+		fmt.Sprintf("%d Hz", s.SampleRate),
+		fmt.Sprint(s.Channels),
+		loudness,
+		uploaded,
+		s.Uploader,
+	)
+}
+
+func printHeader(sizes []int, header []string) {
+	printDashLine(sizes)
+	printLine(sizes, header)
+	printDashLine(sizes)
 }
 
-func printFooter(mls, mlt int) {
-	printDashLine(mls, mlt)
+func printFooter(sizes []int) {
+	printDashLine(sizes)
 }
 
-func printDashLine(mls, mlt int) {
-	fmt.Printf("+-%[1]*[3]v-+-%[2]*[4]v-+\n", mls, mlt, strings.Repeat("-", mls), strings.Repeat("-", mlt))
+func printDashLine(sizes []int) {
+	dashes := make([]string, len(sizes))
+	for i, size := range sizes {
+		dashes[i] = strings.Repeat("-", size)
+	}
+	fmt.Printf("+-%v-+\n", strings.Join(dashes, "-+-"))
 }
 
-func printLine(mls, mlt int, sound, tags string) {
-	fmt.Printf("| %-[1]*[3]v | %-[2]*[4]v |\n", mls, mlt, sound, tags)
+func printLine(sizes []int, cells []string) {
+	padded := make([]string, len(sizes))
+	for i, size := range sizes {
+		padded[i] = fmt.Sprintf("%-*v", size, cells[i])
+	}
+	fmt.Printf("| %v |\n", strings.Join(padded, " | "))
 }
 
-func getMaxColumnSizes(sounds []sound.Sound, ta, tb string) (int, int) {
-	mls, mlt := 0, 0
-	sounds = append(sounds, sound.Sound{Name: ta, Tags: []string{tb}})
-	for _, sound := range sounds {
-		if mls < len(sound.Name) {
-			mls = len(sound.Name)
-		}
-		t := strings.Join(sound.Tags, ",")
-		if mlt < len(t) {
-			mlt = len(t)
+func getMaxColumnSizes(rows [][]string) []int {
+	sizes := make([]int, len(rows[0]))
+	for _, row := range rows {
+		for i, cell := range row {
+			if sizes[i] < len(cell) {
+				sizes[i] = len(cell)
+			}
 		}
 	}
-	return mls, mlt
+	return sizes
 }
 
-func list() (sounds []sound.Sound, err error) {
+// list returns the sounds of the server, sorted by the given key
+func list(sortBy string) (sounds []sound.Sound, err error) {
 	address, err := url.Parse(viper.GetString("bell.address") + ListPath)
 	if err != nil {
 		logrus.WithFields(logrus.Fields{
@@ -98,6 +140,9 @@ func list() (sounds []sound.Sound, err error) {
 		}).Error("Failed to build url")
 		return
 	}
+	if sortBy != "" {
+		address.RawQuery = url.Values{"sort": []string{sortBy}}.Encode()
+	}
 	resp, err := http.Get(address.String())
 	if err != nil {
 		logrus.WithFields(logrus.Fields{
@@ -105,6 +150,13 @@ func list() (sounds []sound.Sound, err error) {
 		}).Error("Failed to contact bell server")
 		return
 	}
+	defer resp.Body.Close()
+	if resp.StatusCode > 299 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		err = fmt.Errorf("Server answered %v: %s", resp.Status, strings.TrimSpace(string(body)))
+		logrus.WithError(err).Error("Failed to list sounds")
+		return
+	}
 	json.NewDecoder(resp.Body).Decode(&sounds)
 	if len(sounds) == 0 {
 		err = errors.New("No sounds found")
@@ -116,7 +168,7 @@ var listTagsCmd = &cobra.Command{
 	Use:   "tags",
 	Short: "List tags in bell server",
 	Run: func(cmd *cobra.Command, args []string) {
-		sounds, err := list()
+		sounds, err := list("")
 		if err != nil {
 			return
 		}
@@ -155,7 +207,7 @@ var listClientsCmd = &cobra.Command{
 			}).Error("Failed to contact bell server")
 			return
 		}
-		cl := localHttp.ClientsList{}
+		cl := api.ClientsList{}
 		json.NewDecoder(resp.Body).Decode(&cl)
 		if len(cl.Clients) == 0 {
 			logrus.Infof("No clients registered yet")
@@ -169,6 +221,8 @@ var listClientsCmd = &cobra.Command{
 func init() {
 	rootCmd.AddCommand(listCmd)
 	listCmd.Flags().BoolVarP(&tagOption, "tag", "t", false, "Option to enable tag mode (list or play by tag)")
+	listCmd.Flags().BoolVarP(&listOptions.long, "long", "l", false, "Show the audio properties of the sounds")
+	listCmd.Flags().StringVarP(&listOptions.sort, "sort", "s", "", "Sort the sounds by "+strings.Join(sound.SortKeys, ", ")+". Prefix with - for a descending order")
 	listCmd.AddCommand(listTagsCmd)
 	listCmd.AddCommand(listClientsCmd)
 }
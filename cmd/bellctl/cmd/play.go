@@ -1,9 +1,13 @@
 package cmd
 
 import (
+	"encoding/json"
 	"net/http"
 	"net/url"
 
+	"github.com/restanrm/bell/api"
+	"github.com/restanrm/bell/job"
+	"github.com/restanrm/bell/policy"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -39,6 +43,12 @@ var playCmd = &cobra.Command{
 		if viper.GetString("playSoundOnClient") != "" {
 			q.Add("destination", viper.GetString("playSoundOnClient"))
 		}
+		if viper.GetString("playPriority") != "" {
+			q.Add("priority", viper.GetString("playPriority"))
+		}
+		if waitOption {
+			q.Add("wait", "true")
+		}
 		address.RawQuery = q.Encode()
 		logrus.Debugf("address built: %v", address)
 
@@ -49,6 +59,18 @@ var playCmd = &cobra.Command{
 			}).Error("Failed to contact bell server")
 			return
 		}
+		defer resp.Body.Close()
+		if resp.StatusCode == http.StatusLocked {
+			logrus.WithFields(logrus.Fields{
+				"sound":  sound,
+				"reason": denialReason(resp),
+			}).Info("Not played, denied by the destination")
+			return
+		}
+		if waitOption {
+			reportJob(resp, logrus.Fields{"sound": sound})
+			return
+		}
 		if resp.StatusCode > 299 {
 			logrus.WithFields(logrus.Fields{
 				"sound":       sound,
@@ -58,11 +80,45 @@ var playCmd = &cobra.Command{
 	},
 }
 
+// denialReason returns the reason of a playback denied by the quiet hours
+// policy of the server, or by the mute of the destination
+func denialReason(resp *http.Response) string {
+	var d policy.Decision
+	if err := json.NewDecoder(resp.Body).Decode(&d); err != nil {
+		return "unknown"
+	}
+	return d.Reason
+}
+
+// reportJob logs the end of a playback waited for. It exits with an error if
+// the playback failed.
+func reportJob(resp *http.Response, fields logrus.Fields) {
+	var pr api.PlayResponse
+	if err := json.NewDecoder(resp.Body).Decode(&pr); err != nil || pr.Job.ID == "" {
+		logrus.WithFields(fields).WithField("status_code", resp.StatusCode).Fatal("Failed to play")
+	}
+	log := logrus.WithFields(fields).WithFields(logrus.Fields{
+		"job":         pr.Job.ID,
+		"destination": pr.Job.Destination,
+	})
+	switch pr.Job.Status {
+	case job.Done:
+		log.Info("Played")
+	case job.Failed:
+		log.WithField("error", pr.Job.Error).Fatal("Failed to play")
+	default:
+		log.WithField("status", pr.Job.Status).Warn("Still not played after the wait timeout of the server")
+	}
+}
+
 func init() {
 	rootCmd.AddCommand(playCmd)
 
 	playCmd.Flags().BoolVarP(&tagOption, "tag", "t", false, "Option to play a sound by its tag")
 	playCmd.Flags().StringP("destination", "d", "", "Destination to play the sound")
 	viper.BindPFlag("playSoundOnClient", playCmd.Flags().Lookup("destination"))
+	playCmd.Flags().StringP("priority", "p", "", "Priority of the sound in the server queue (fun|normal|alert)")
+	viper.BindPFlag("playPriority", playCmd.Flags().Lookup("priority"))
+	playCmd.Flags().BoolVarP(&waitOption, "wait", "w", false, "Wait for the end of the sound and fail if it couldn't be played")
 
 }
@@ -15,20 +15,25 @@
 package cmd
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"math"
 	"net/url"
 	"os"
-	"os/exec"
 	"path/filepath"
-	"strings"
+	"sync"
 	"time"
 
 	"github.com/cenkalti/backoff"
 	"github.com/gorilla/websocket"
 	"github.com/pkg/errors"
+	"github.com/restanrm/bell/audio"
 	"github.com/restanrm/bell/connstore"
+	"github.com/restanrm/bell/player"
+	"github.com/restanrm/bell/sound"
+	"github.com/restanrm/bell/volume"
 
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -38,8 +43,24 @@ import (
 // registerCmd represents the register command
 var registerCmd = &cobra.Command{
 	Use:   "register",
-	Short: "Register allows to connect to websocket of bell server. It will receive play orders and run them with `mpv`.",
+	Short: "Register allows to connect to websocket of bell server. It will receive play and volume orders and run them with a player command, `mpv` by default.",
+	Long: `Register allows to connect to websocket of bell server. It will receive play
+and volume orders and run them with mpv, or the player chosen with --player:
+mpv, ffplay, aplay (wav sounds only), paplay or command.
+
+The arguments of the player can be replaced with --player-args. Their {file},
+{gain}, {volume} and {pavolume} placeholders are replaced by the path of the
+sound, the gain in dB, the volume in percent and the volume of paplay.`,
+	Example: `
+  bellctl register --player paplay --player-args=--device=alsa_output.usb,--volume={pavolume},{file}
+  bellctl register --player command --player-command ffplay --player-args=-nodisp,-autoexit,{file}
+	`,
 	Run: func(cmd *cobra.Command, args []string) {
+		var err error
+		command, err = player.CommandFromViper("register.player")
+		if err != nil {
+			logrus.WithError(err).Fatal("Invalid player, please use mpv, ffplay, aplay, paplay or command")
+		}
 		op := func() error {
 			return runRegister(viper.GetString("bell.address"))
 		}
@@ -72,7 +93,7 @@ func runRegister(bellAddress string) error {
 	} else {
 		address.Scheme = "ws"
 	}
-	c, r, err := websocket.DefaultDialer.Dial(address.String(), nil)
+	c, r, err := websocket.DefaultDialer.Dial(address.String(), authHeader(nil))
 	if err != nil {
 		return errors.Wrapf(err, "Failed to create websocket connection to server. response: %v", fmt.Sprintf("%#v", r))
 	}
@@ -95,20 +116,86 @@ func runRegister(bellAddress string) error {
 	done := make(chan struct{})
 	go readOrder(c, done)
 
-	for {
-		select {
-		case <-done:
-			return errors.New("channel has been closed")
+	<-done
+	return errors.New("channel has been closed")
+}
+
+var (
+	// errInterrupted is the failure of the playbacks stopped by the server
+	errInterrupted = errors.New("Interrupted")
+	// errMuted is the failure of the orders received while muted
+	errMuted = errors.New("Client is muted")
+)
+
+// command is the player command of the client
+var command player.Command
+
+// settings are the volume settings of the client, sent by the server
+var settings = struct {
+	sync.Mutex
+	volume.Settings
+}{Settings: volume.Default}
+
+// playbacks are the orders being played by the client, so they can be
+// stopped by the server
+type playbacks struct {
+	mu      sync.Mutex
+	next    int
+	running map[int]playback
+}
+
+type playback struct {
+	job    string
+	cancel context.CancelFunc
+}
+
+// start returns the context of the playback of an order, cancelled when it is
+// stopped, and the function to call at its end
+func (p *playbacks) start(job string) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.running == nil {
+		p.running = make(map[int]playback)
+	}
+	id := p.next
+	p.next++
+	p.running[id] = playback{job: job, cancel: cancel}
+	return ctx, func() {
+		p.mu.Lock()
+		delete(p.running, id)
+		p.mu.Unlock()
+		cancel()
+	}
+}
+
+// stop interrupts the playback of a job, or all of them if job is empty. It
+// returns the number of playbacks interrupted.
+func (p *playbacks) stop(job string) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	n := 0
+	for _, pb := range p.running {
+		if job == "" || pb.job == job {
+			pb.cancel()
+			n++
 		}
 	}
-	return nil
+	return n
 }
 
 type ReadMessager interface {
 	ReadMessage() (messageType int, p []byte, err error)
 }
 
-func readOrder(c ReadMessager, done chan struct{}) {
+// ReadWriter reads the orders of the server and writes the results of the
+// playbacks
+type ReadWriter interface {
+	ReadMessager
+	WriteJSONer
+}
+
+func readOrder(c ReadWriter, done chan struct{}) {
 	defer close(done)
 	dir, err := ioutil.TempDir("/tmp", "bellPlayer")
 	if err != nil {
@@ -116,6 +203,9 @@ func readOrder(c ReadMessager, done chan struct{}) {
 		os.Exit(-1)
 	}
 	defer os.RemoveAll(dir)
+	// the results of the playbacks are written concurrently
+	var mu sync.Mutex
+	var running playbacks
 	for {
 		_, message, err := c.ReadMessage()
 		if err != nil {
@@ -130,55 +220,150 @@ func readOrder(c ReadMessager, done chan struct{}) {
 		}
 		s := &connstore.PlayerRequest{}
 		json.Unmarshal(message, s)
+		if s.Type == "volume" {
+			var vs volume.Settings
+			if err := json.Unmarshal([]byte(s.Data), &vs); err != nil {
+				logrus.WithError(err).Error("Failed to decode the volume settings")
+				continue
+			}
+			settings.Lock()
+			settings.Settings = vs
+			settings.Unlock()
+			logrus.WithFields(logrus.Fields{"volume": vs.Volume, "muted": vs.Muted}).Info("Received volume settings")
+			continue
+		}
+		if s.Type == "stop" {
+			// the data of a stop order is the job to stop, if any
+			n := running.stop(s.Data)
+			logrus.WithFields(logrus.Fields{"job": s.Data, "stopped": n}).Info("Received stop order")
+			continue
+		}
+		ctx, done := running.start(s.Job)
 		go func() {
-			switch s.Type {
-			case "error":
+			defer done()
+			var err error
+			settings.Lock()
+			muted := settings.Muted
+			settings.Unlock()
+			switch {
+			case s.Type == "error":
 				logrus.Error(s.Data)
-			case "tts":
+			case muted:
+				logrus.WithFields(logrus.Fields{"type": s.Type, "data": s.Data}).Info("Ignoring order while muted")
+				err = errMuted
+			case s.Type == "tts":
 				logrus.WithField("text", s.Data).Info("Received TTS order")
-				err = getTTSAndPlay(dir, s.Data)
+				err = getTTSAndPlay(ctx, dir, s.Data)
 				if err != nil {
 					logrus.WithError(err).Errorf("Failed to retrieve and tts %v", s.Data)
 				}
-			case "sound":
-				logrus.WithField("sound", s.Data).Info("Received play sound order")
-				err = getAndPlay(dir, s.Data)
+			case s.Type == "sound":
+				logrus.WithFields(logrus.Fields{"sound": s.Data, "gain": s.Gain}).Info("Received play sound order")
+				err = getAndPlay(ctx, dir, s.Data, s.Gain)
 				if err != nil {
 					logrus.WithError(err).Errorf("Failed to play the sound: %v", s.Data)
 				}
+			case s.Type == "sequence":
+				logrus.WithField("sequence", s.Data).Info("Received play sequence order")
+				err = playSequence(ctx, dir, s.Data)
+				if err != nil {
+					logrus.WithError(err).Errorf("Failed to play the sequence: %v", s.Data)
+				}
+			}
+			if ctx.Err() != nil {
+				err = errInterrupted
+			}
+			if s.Job == "" {
+				return
+			}
+			resp := connstore.PlayerResponse{Job: s.Job}
+			if err != nil {
+				resp.Error = err.Error()
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if err := c.WriteJSON(resp); err != nil {
+				logrus.WithError(err).Error("Failed to report the end of the playback to the server")
 			}
 		}()
 	}
 }
 
-func getAndPlay(dir, sound string) error {
-	fp := filepath.Join(dir, fmt.Sprintf("%v.mp3", sound))
-	err := get(sound, fp)
+// getAndPlay retrieves a sound and plays it with its gain in dB. The file is
+// saved with the extension of its format, the players rely on it.
+func getAndPlay(ctx context.Context, dir, sound string, gain float64) error {
+	fp := filepath.Join(dir, sound)
+	format, err := get(sound, fp)
 	if err != nil {
 		return errors.Wrapf(err, "Failed to retrieve sound %v", sound)
 	}
-	return play(fp)
+	if format == audio.Unknown {
+		// the content type is missing or generic, detect the format
+		if format, err = audio.DetectFile(fp); err != nil {
+			return errors.Wrapf(err, "Failed to detect the format of sound %v", sound)
+		}
+	}
+	if err = os.Rename(fp, fp+format.Ext()); err != nil {
+		return errors.Wrapf(err, "Failed to name sound %v after its format", sound)
+	}
+	return play(ctx, fp+format.Ext(), gain)
 }
 
-func getTTSAndPlay(dir, text string) error {
+func getTTSAndPlay(ctx context.Context, dir, text string) error {
 	// compute hash of the text to have a filename
 	fp, err := getTTS(dir, text)
 	if err != nil {
 		return errors.Wrapf(err, "Failed to retrieve the sound from the bell server")
 	}
-	return play(fp)
+	return play(ctx, fp, 0)
 }
 
-func play(fp string) error {
-	cmd := exec.Command(
-		"mpv",
-		fp,
-	)
-	_, err := cmd.CombinedOutput()
-	if err != nil {
-		return errors.Wrapf(err, "Failed to run the command: %q", strings.Join(cmd.Args, " "))
+// playSequence plays in order the json encoded steps of a sequence. A step
+// that fails is skipped, the error of the first one is returned. The
+// remaining steps are skipped once ctx is cancelled.
+func playSequence(ctx context.Context, dir, data string) error {
+	var steps []sound.Step
+	if err := json.Unmarshal([]byte(data), &steps); err != nil {
+		return errors.Wrapf(err, "Failed to decode the steps of the sequence")
 	}
-	return nil
+	var failed error
+	for _, st := range steps {
+		if ctx.Err() != nil {
+			return errInterrupted
+		}
+		var err error
+		switch {
+		case st.Sound != "":
+			err = getAndPlay(ctx, dir, st.Sound, st.Gain)
+		case st.Text != "":
+			err = getTTSAndPlay(ctx, dir, st.Text)
+		default:
+			select {
+			case <-time.After(st.PauseDuration()):
+			case <-ctx.Done():
+			}
+		}
+		if err != nil {
+			logrus.WithError(err).WithField("step", st.String()).Error("Failed to play step of the sequence")
+			if failed == nil {
+				failed = errors.Wrapf(err, "Failed to play step %q", st.String())
+			}
+		}
+	}
+	return failed
+}
+
+// play plays the file with the player command, with a gain in dB and at the
+// volume of the client. Nothing is played at 0. The command is killed when
+// ctx is cancelled.
+func play(ctx context.Context, fp string, gain float64) error {
+	settings.Lock()
+	vol := settings.Volume
+	settings.Unlock()
+	if vol == 0 {
+		return nil
+	}
+	return command.Run(ctx, fp, gain+20*math.Log10(float64(vol)/100))
 }
 
 type ReadJSONer interface {
@@ -213,6 +398,18 @@ func init() {
 	cn := "register.name"
 	viper.BindPFlag(cn, registerCmd.Flags().Lookup("name"))
 	viper.BindEnv(cn, "BELL_REGISTER_NAME")
+
+	registerCmd.Flags().String("player", "mpv", "Player of the sounds (mpv|ffplay|aplay|paplay|command)")
+	viper.BindPFlag("register.player.type", registerCmd.Flags().Lookup("player"))
+	viper.BindEnv("register.player.type", "BELL_PLAYER")
+	registerCmd.Flags().String("player-command", "", "Binary of the player command, the one of the player if empty")
+	viper.BindPFlag("register.player.command", registerCmd.Flags().Lookup("player-command"))
+	registerCmd.Flags().StringSlice("player-args", nil, "Arguments of the player command, with the {file}, {gain}, {volume} and {pavolume} placeholders. The ones of the player if empty")
+	viper.BindPFlag("register.player.args", registerCmd.Flags().Lookup("player-args"))
+	registerCmd.Flags().StringSlice("player-env", nil, "Environment variables of the player command, as KEY=value. Can be repeated")
+	viper.BindPFlag("register.player.env", registerCmd.Flags().Lookup("player-env"))
+	registerCmd.Flags().Duration("player-timeout", 0, "Maximum duration of a sound played by the player command, 0 for no limit")
+	viper.BindPFlag("register.player.timeout", registerCmd.Flags().Lookup("player-timeout"))
 	// default to hostname if no fail
 	hn, err := os.Hostname()
 	if err == nil {
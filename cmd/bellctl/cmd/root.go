@@ -1,9 +1,15 @@
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
 	"os"
+	"strings"
 
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 
 	"github.com/spf13/cobra"
@@ -29,6 +35,23 @@ const (
 	AddSoundPath = "/api/v1/sounds"
 	// GetSoundPath is the path used to retrieve sound content
 	GetSoundPath = "/api/v1/sounds/"
+	// RestoreSoundPath is the path used to restore a deleted sound, after the sound name
+	RestoreSoundPath = "/restore"
+	// TagsPath is the path to list and edit tags
+	TagsPath = "/api/v1/tags"
+	// TrashPath is the path to list deleted sounds
+	TrashPath = "/api/v1/trash"
+
+	// SequencesPath is the path to list, edit and play the sequences
+	SequencesPath = "/api/v1/sequences"
+	// HistoryPath is the path of the history of the playbacks
+	HistoryPath = "/api/v1/history"
+	// SchedulesPath is the path to list and edit the scheduled plays
+	SchedulesPath = "/api/v1/schedules"
+	// StopPath is the path to interrupt the playbacks
+	StopPath = "/api/v1/stop"
+	// VolumePath is the path of the volume settings of the destinations
+	VolumePath = "/api/v1/volume"
 
 	// RegisterPath allow to register this host as a player client
 	RegisterPath = "/api/v1/clients/register"
@@ -38,6 +61,8 @@ const (
 
 var (
 	tagOption bool
+	// waitOption waits for the end of the playbacks
+	waitOption bool
 )
 
 // rootCmd represents the base command when called without any subcommands
@@ -46,8 +71,11 @@ var rootCmd = &cobra.Command{
 	Short: "This allow to control a \"bell\" server with simple commands",
 	Long: `You can control a bell server. To choose your bell server use the env variable BELL_ADDRESS.addCmd
 
+The BELL_TOKEN env variable authenticates the requests when the server requires it.
+
 Example:
 	export BELL_ADDRESS=http://localhost:10101
+	export BELL_TOKEN=s3cret
 	bellctl list
 	`,
 }
@@ -65,6 +93,7 @@ func init() {
 	cobra.OnInitialize(initConfig)
 	viper.BindEnv("bell.address", "BELL_ADDRESS")
 	viper.SetDefault("bell.address", "http://localhost:10101")
+	viper.BindEnv("bell.token", "BELL_TOKEN")
 	rootCmd.PersistentFlags().BoolP("verbose", "v", false, "Increase verbosity")
 	viper.BindPFlag("verbose", rootCmd.PersistentFlags().Lookup("verbose"))
 	if viper.GetBool("verbose") {
@@ -74,4 +103,60 @@ func init() {
 
 // initConfig reads in config file and ENV variables if set.
 func initConfig() {
+	if viper.GetString("bell.token") != "" {
+		http.DefaultClient.Transport = tokenTransport{http.DefaultTransport}
+	}
+}
+
+// tokenTransport authenticates the requests to the bell server with the
+// BELL_TOKEN
+type tokenTransport struct {
+	next http.RoundTripper
+}
+
+func (t tokenTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	// a RoundTripper must not modify the request
+	req := *r
+	req.Header = authHeader(r.Header)
+	return t.next.RoundTrip(&req)
+}
+
+// authHeader returns a copy of h with the authorization header of the
+// BELL_TOKEN, if any
+func authHeader(h http.Header) http.Header {
+	out := http.Header{}
+	for k, v := range h {
+		out[k] = v
+	}
+	if token := viper.GetString("bell.token"); token != "" {
+		out.Set("Authorization", "Bearer "+token)
+	}
+	return out
+}
+
+// apiRequest sends a form request on the path of the API and decodes the json
+// response in out, if not nil
+func apiRequest(method, path string, values url.Values, out interface{}) error {
+	address, err := url.Parse(viper.GetString("bell.address") + path)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to build url")
+	}
+	req, err := http.NewRequest(method, address.String(), strings.NewReader(values.Encode()))
+	if err != nil {
+		return errors.Wrapf(err, "Failed to create request")
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to contact bell server")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode > 299 {
+		content, _ := ioutil.ReadAll(resp.Body)
+		return errors.Errorf("bell server answered %v: %v", resp.StatusCode, strings.TrimSpace(string(content)))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
 }
@@ -45,6 +45,12 @@ var sayCmd = &cobra.Command{
 		if viper.GetString("playTTSOnClient") != "" {
 			q.Add("destination", viper.GetString("playTTSOnClient"))
 		}
+		if viper.GetString("sayPriority") != "" {
+			q.Add("priority", viper.GetString("sayPriority"))
+		}
+		if waitOption {
+			q.Add("wait", "true")
+		}
 		address.RawQuery = q.Encode()
 
 		resp, err := http.PostForm(address.String(), url.Values{"text": {text}})
@@ -54,6 +60,18 @@ var sayCmd = &cobra.Command{
 			}).Error("Failed to contact bell server")
 			return
 		}
+		defer resp.Body.Close()
+		if resp.StatusCode == http.StatusLocked {
+			logrus.WithFields(logrus.Fields{
+				"text":   text,
+				"reason": denialReason(resp),
+			}).Info("Not played, denied by the destination")
+			return
+		}
+		if waitOption {
+			reportJob(resp, logrus.Fields{"text": text})
+			return
+		}
 		if resp.StatusCode > 299 {
 			logrus.WithFields(logrus.Fields{
 				"text":        text,
@@ -67,4 +85,7 @@ func init() {
 	rootCmd.AddCommand(sayCmd)
 	sayCmd.Flags().StringP("destination", "d", "", "Destination to play the sound")
 	viper.BindPFlag("playTTSOnClient", sayCmd.Flags().Lookup("destination"))
+	sayCmd.Flags().StringP("priority", "p", "", "Priority of the text in the server queue (fun|normal|alert)")
+	viper.BindPFlag("sayPriority", sayCmd.Flags().Lookup("priority"))
+	sayCmd.Flags().BoolVarP(&waitOption, "wait", "w", false, "Wait for the end of the text and fail if it couldn't be played")
 }
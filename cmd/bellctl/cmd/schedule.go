@@ -0,0 +1,187 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/restanrm/bell/schedule"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var scheduleOptions struct {
+	cron        string
+	at          string
+	text        string
+	destination string
+	priority    string
+}
+
+// scheduleCmd represents the schedule command
+var scheduleCmd = &cobra.Command{
+	Use:   "schedule",
+	Short: "Manage the sounds and texts played at given times",
+	Long:  `Without subcommand, list the scheduled plays.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		listSchedules()
+	},
+}
+
+var scheduleListCmd = &cobra.Command{
+	Use:     "list",
+	Aliases: []string{"ls"},
+	Short:   "List the scheduled plays in the order they will run",
+	Run: func(cmd *cobra.Command, args []string) {
+		listSchedules()
+	},
+}
+
+var scheduleAddCmd = &cobra.Command{
+	Use:   "add [SOUND]",
+	Short: "Schedule a sound, the sounds of a tag or a text",
+	Long: `Schedule a sound, the sounds of a tag or a text (with --text), either
+on the recurrence of a cron expression (--cron) or once (--at).
+
+--at accepts a RFC 3339 time, or a local time written as "2006-01-02 15:04" or
+"15:04" (the next one).`,
+	Example: `
+  bellctl schedule add --cron "30 9 * * mon-fri" standup
+  bellctl schedule add --cron @hourly --text "Drink some water" -d office
+  bellctl schedule add --at 17:55 --text "The building closes in 5 minutes"
+	`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		values := url.Values{}
+		if len(args) == 1 {
+			values.Set("sound", args[0])
+		}
+		if scheduleOptions.at != "" {
+			at, err := parseAt(scheduleOptions.at, time.Now())
+			if err != nil {
+				logrus.WithError(err).Error("Failed to schedule")
+				return
+			}
+			values.Set("at", at.Format(time.RFC3339))
+		}
+		for key, v := range map[string]string{
+			"cron":        scheduleOptions.cron,
+			"text":        scheduleOptions.text,
+			"destination": scheduleOptions.destination,
+			"priority":    scheduleOptions.priority,
+		} {
+			if v != "" {
+				values.Set(key, v)
+			}
+		}
+		var s schedule.Schedule
+		err := apiRequest(http.MethodPost, SchedulesPath, values, &s)
+		if err != nil {
+			logrus.WithError(err).Error("Failed to schedule")
+			return
+		}
+		logrus.WithFields(logrus.Fields{
+			"id":   s.ID,
+			"next": s.Next.Local().Format("2006-01-02 15:04"),
+		}).Info("Scheduled")
+	},
+}
+
+var scheduleDeleteCmd = &cobra.Command{
+	Use:     "rm ID...",
+	Aliases: []string{"delete", "del"},
+	Short:   "Remove scheduled plays",
+	Args:    cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		for _, id := range args {
+			err := apiRequest(http.MethodDelete, SchedulesPath+"/"+url.PathEscape(id), nil, nil)
+			if err != nil {
+				logrus.WithError(err).WithField("id", id).Error("Failed to remove schedule")
+				continue
+			}
+			logrus.WithField("id", id).Info("Schedule removed")
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(scheduleCmd)
+	scheduleCmd.AddCommand(scheduleListCmd)
+	scheduleCmd.AddCommand(scheduleAddCmd)
+	scheduleCmd.AddCommand(scheduleDeleteCmd)
+
+	scheduleAddCmd.Flags().StringVarP(&scheduleOptions.cron, "cron", "c", "", "Cron expression of a recurring play: minute hour day-of-month month day-of-week")
+	scheduleAddCmd.Flags().StringVarP(&scheduleOptions.at, "at", "a", "", "Time of a single play")
+	scheduleAddCmd.Flags().StringVarP(&scheduleOptions.text, "text", "t", "", "Text to say instead of a sound")
+	scheduleAddCmd.Flags().StringVarP(&scheduleOptions.destination, "destination", "d", "", "Registered client playing the schedule, the server if empty")
+	scheduleAddCmd.Flags().StringVarP(&scheduleOptions.priority, "priority", "p", "", "Priority of the play in the server queue (fun|normal|alert)")
+}
+
+// parseAt parses the time of a single play. A time without a date is the
+// next one after now.
+func parseAt(s string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02 15:04", s, time.Local); err == nil {
+		return t, nil
+	}
+	clock, err := time.ParseInLocation("15:04", s, time.Local)
+	if err != nil {
+		return time.Time{}, errors.Errorf("Invalid time %q, please use a RFC 3339 time, \"2006-01-02 15:04\" or \"15:04\"", s)
+	}
+	t := time.Date(now.Year(), now.Month(), now.Day(), clock.Hour(), clock.Minute(), 0, 0, time.Local)
+	if !t.After(now) {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+func listSchedules() {
+	var schedules []schedule.Schedule
+	err := apiRequest(http.MethodGet, SchedulesPath, nil, &schedules)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to list schedules")
+		return
+	}
+	if len(schedules) == 0 {
+		logrus.Info("Nothing scheduled")
+		return
+	}
+	rows := [][]string{{"ID", "When", "Next", "Play", "Destination", "Creator", "Last error"}}
+	for _, s := range schedules {
+		when := s.Cron
+		if s.At != nil {
+			when = "once"
+		}
+		play := s.Sound
+		if s.Text != "" {
+			play = fmt.Sprintf("say %q", s.Text)
+		}
+		destination := s.Destination
+		if destination == "" {
+			destination = "server"
+		}
+		next := "done"
+		if s.Next != nil {
+			next = s.Next.Local().Format("2006-01-02 15:04")
+		}
+		rows = append(rows, []string{
+			s.ID,
+			when,
+			next,
+			play,
+			destination,
+			s.Creator,
+			s.LastError,
+		})
+	}
+	sizes := getMaxColumnSizes(rows)
+	printHeader(sizes, rows[0])
+	for _, row := range rows[1:] {
+		printLine(sizes, row)
+	}
+	printFooter(sizes)
+}
@@ -0,0 +1,145 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/restanrm/bell/api"
+	"github.com/restanrm/bell/job"
+	"github.com/restanrm/bell/sound"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var sequenceOptions struct {
+	destination string
+	priority    string
+}
+
+// sequenceCmd represents the sequence command
+var sequenceCmd = &cobra.Command{
+	Use:     "sequence",
+	Aliases: []string{"sequences", "seq"},
+	Short:   "Manage and play sequences of sounds, texts and pauses",
+	Long:    `Without subcommand, list the sequences of the library.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		var seqs []sound.Sequence
+		err := apiRequest(http.MethodGet, SequencesPath, nil, &seqs)
+		if err != nil {
+			logrus.WithError(err).Error("Failed to list sequences")
+			return
+		}
+		for _, seq := range seqs {
+			fmt.Printf("  - %v: %v\n", seq.Name, formatSteps(seq.Steps))
+		}
+	},
+}
+
+var sequenceShowCmd = &cobra.Command{
+	Use:   "show NAME",
+	Short: "Show the steps of a sequence",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		var seq sound.Sequence
+		err := apiRequest(http.MethodGet, SequencesPath+"/"+args[0], nil, &seq)
+		if err != nil {
+			logrus.WithError(err).Error("Failed to retrieve sequence")
+			return
+		}
+		for i, st := range seq.Steps {
+			fmt.Printf("  %d. %v\n", i+1, st)
+		}
+	},
+}
+
+var sequenceSetCmd = &cobra.Command{
+	Use:   "set NAME STEP...",
+	Short: "Create or replace a sequence",
+	Long: `Create or replace a sequence. A step is the name of a sound or a tag,
+"say:" followed by a text, or "pause:" followed by a duration.`,
+	Example: `  bellctl sequence set deployed ding "say:deploy finished" pause:1s fanfare`,
+	Args:    cobra.MinimumNArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		var seq sound.Sequence
+		err := apiRequest(http.MethodPut, SequencesPath+"/"+args[0], url.Values{"step": args[1:]}, &seq)
+		if err != nil {
+			logrus.WithError(err).Error("Failed to save sequence")
+			return
+		}
+		logrus.WithField("steps", len(seq.Steps)).Infof("Sequence %v saved", seq.Name)
+	},
+}
+
+var sequenceDeleteCmd = &cobra.Command{
+	Use:     "rm NAME",
+	Aliases: []string{"delete", "del"},
+	Short:   "Remove a sequence",
+	Args:    cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		err := apiRequest(http.MethodDelete, SequencesPath+"/"+args[0], nil, nil)
+		if err != nil {
+			logrus.WithError(err).Error("Failed to remove sequence")
+			return
+		}
+		logrus.Infof("Sequence %v removed", args[0])
+	},
+}
+
+var sequencePlayCmd = &cobra.Command{
+	Use:   "play NAME",
+	Short: "Play a sequence on the server or on a registered client",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		q := url.Values{}
+		if sequenceOptions.destination != "" {
+			q.Set("destination", sequenceOptions.destination)
+		}
+		if sequenceOptions.priority != "" {
+			q.Set("priority", sequenceOptions.priority)
+		}
+		if waitOption {
+			q.Set("wait", "true")
+		}
+		path := SequencesPath + "/" + args[0] + "/play"
+		if len(q) > 0 {
+			path += "?" + q.Encode()
+		}
+		var pr api.PlayResponse
+		err := apiRequest(http.MethodPost, path, nil, &pr)
+		switch {
+		case err != nil && waitOption:
+			logrus.WithError(err).Fatal("Failed to play sequence")
+		case err != nil:
+			logrus.WithError(err).Error("Failed to play sequence")
+		case waitOption && pr.Job.Status == job.Done:
+			logrus.WithField("job", pr.Job.ID).Infof("Sequence %v played", args[0])
+		case waitOption:
+			logrus.WithField("status", pr.Job.Status).Warn("Still not played after the wait timeout of the server")
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(sequenceCmd)
+	sequenceCmd.AddCommand(sequenceShowCmd)
+	sequenceCmd.AddCommand(sequenceSetCmd)
+	sequenceCmd.AddCommand(sequenceDeleteCmd)
+	sequenceCmd.AddCommand(sequencePlayCmd)
+
+	sequencePlayCmd.Flags().StringVarP(&sequenceOptions.destination, "destination", "d", "", "Destination to play the sequence")
+	sequencePlayCmd.Flags().BoolVarP(&waitOption, "wait", "w", false, "Wait for the end of the sequence and fail if it couldn't be played")
+	sequencePlayCmd.Flags().StringVarP(&sequenceOptions.priority, "priority", "p", "", "Priority of the sequence in the server queue (fun|normal|alert)")
+}
+
+func formatSteps(steps []sound.Step) string {
+	out := make([]string, len(steps))
+	for i, st := range steps {
+		out[i] = st.String()
+		if st.Text != "" {
+			out[i] = fmt.Sprintf("say:%q", st.Text)
+		}
+	}
+	return strings.Join(out, ", ")
+}
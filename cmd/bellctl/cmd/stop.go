@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/restanrm/bell/api"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var stopOptions struct {
+	destination string
+}
+
+// stopCmd represents the stop command
+var stopCmd = &cobra.Command{
+	Use:   "stop [JOB]",
+	Short: "Stop the sounds currently playing",
+	Long: `Without argument, interrupt the sounds playing on the server and on all
+the registered clients, or only on --destination ("server" for the server).
+The sounds waiting in the queue of the server are removed too.
+
+With the id of a job, only its playback is interrupted, or removed from the
+queue of the server if it isn't playing yet.`,
+	Example: `
+  bellctl stop
+  bellctl stop -d office
+  bellctl stop 3e5ac4d5-8a6b-4f0c-9a3e-8fd4f3cbb0a2
+	`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		values := url.Values{}
+		if len(args) == 1 {
+			values.Set("job", args[0])
+		}
+		if stopOptions.destination != "" {
+			values.Set("destination", stopOptions.destination)
+		}
+		var resp api.StopResponse
+		err := apiRequest(http.MethodPost, StopPath, values, &resp)
+		if err != nil {
+			logrus.WithError(err).Fatal("Failed to stop the sounds")
+		}
+		if len(resp.Stopped) == 0 {
+			logrus.Info("Nothing is playing")
+			return
+		}
+		logrus.Infof("Stopped on %v", strings.Join(resp.Stopped, ", "))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(stopCmd)
+	stopCmd.Flags().StringVarP(&stopOptions.destination, "destination", "d", "", "Destination where the sounds are stopped, all of them if empty")
+}
@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+
+	"github.com/restanrm/bell/api"
+	"github.com/restanrm/bell/sound"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// tagsCmd represents the tags command
+var tagsCmd = &cobra.Command{
+	Use:   "tags",
+	Short: "List and manage the tags of the library",
+	Long:  `Without subcommand, list the tags of the library with the number of sounds having them.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		var tags map[string]int
+		err := tagsRequest(http.MethodGet, "", nil, &tags)
+		if err != nil {
+			logrus.WithError(err).Error("Failed to list tags")
+			return
+		}
+		var names []string
+		for t := range tags {
+			names = append(names, t)
+		}
+		sort.Strings(names)
+		for _, t := range names {
+			fmt.Printf("  - %v (%d)\n", t, tags[t])
+		}
+	},
+}
+
+var tagsShowCmd = &cobra.Command{
+	Use:   "show TAG",
+	Short: "List the sounds having a tag",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		var sounds []sound.Sound
+		err := tagsRequest(http.MethodGet, "/"+args[0], nil, &sounds)
+		if err != nil {
+			logrus.WithError(err).Error("Failed to list sounds of the tag")
+			return
+		}
+		for _, s := range sounds {
+			fmt.Printf("  - %v\n", s.Name)
+		}
+	},
+}
+
+var tagsApplyCmd = &cobra.Command{
+	Use:     "apply TAG SOUND...",
+	Short:   "Add a tag to several sounds",
+	Example: `  bellctl tags apply insulte bangkok bordel`,
+	Args:    cobra.MinimumNArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		var res api.TagsUpdate
+		err := tagsRequest(http.MethodPost, "/"+args[0], url.Values{"sound": args[1:]}, &res)
+		if err != nil {
+			logrus.WithError(err).Error("Failed to apply tag")
+			return
+		}
+		logrus.Infof("%d sounds updated", res.Updated)
+	},
+}
+
+var tagsRenameCmd = &cobra.Command{
+	Use:   "rename TAG NEWNAME",
+	Short: "Rename a tag on every sound having it",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		var res api.TagsUpdate
+		err := tagsRequest(http.MethodPost, "/"+args[0]+"/rename", url.Values{"name": {args[1]}}, &res)
+		if err != nil {
+			logrus.WithError(err).Error("Failed to rename tag")
+			return
+		}
+		logrus.Infof("%d sounds updated", res.Updated)
+	},
+}
+
+var tagsDeleteCmd = &cobra.Command{
+	Use:     "rm TAG",
+	Aliases: []string{"delete", "del"},
+	Short:   "Remove a tag from every sound having it",
+	Args:    cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		var res api.TagsUpdate
+		err := tagsRequest(http.MethodDelete, "/"+args[0], nil, &res)
+		if err != nil {
+			logrus.WithError(err).Error("Failed to delete tag")
+			return
+		}
+		logrus.Infof("%d sounds updated", res.Updated)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(tagsCmd)
+	tagsCmd.AddCommand(tagsShowCmd)
+	tagsCmd.AddCommand(tagsApplyCmd)
+	tagsCmd.AddCommand(tagsRenameCmd)
+	tagsCmd.AddCommand(tagsDeleteCmd)
+}
+
+// tagsRequest sends a request on the tags endpoint and decodes the json
+// response in out
+func tagsRequest(method, path string, values url.Values, out interface{}) error {
+	return apiRequest(method, TagsPath+path, values, out)
+}
@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"github.com/restanrm/bell/sound"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// undeleteCmd represents the undelete command
+var undeleteCmd = &cobra.Command{
+	Use:     "undelete",
+	Aliases: []string{`restore-sound`},
+	Short:   "undelete restores a sound from the trash of the library",
+	Long:    `Deleted sounds are kept in the trash of the bell server for a while. This command puts them back in the library. Use "bellctl list trash" to see the sounds that can be restored.`,
+	Example: `
+  bellctl undelete tada
+	`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) < 1 {
+			logrus.Error("Failed to restore nothing as a sound")
+			return
+		}
+		for _, sound := range args {
+			address, err := url.Parse(viper.GetString("bell.address") + DeleteSoundPath + sound + RestoreSoundPath)
+			if err != nil {
+				logrus.WithFields(logrus.Fields{
+					"error":          err,
+					"server address": viper.GetString("bell.address"),
+					"method":         "undeleteCmd.Run",
+				}).Error("Failed to build url")
+				return
+			}
+			resp, err := http.Post(address.String(), "", nil)
+			if err != nil {
+				logrus.WithFields(logrus.Fields{
+					"error": err,
+				}).Error("Failed to contact bell server")
+				return
+			}
+			content, _ := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode > 299 {
+				logrus.WithFields(logrus.Fields{
+					"sound":       sound,
+					"status_code": resp.StatusCode,
+					"body":        string(content),
+				}).Info("Failed to restore the sound")
+				continue
+			}
+			logrus.Infof("Sound %v restored", sound)
+		}
+	},
+}
+
+var listTrashCmd = &cobra.Command{
+	Use:     "trash",
+	Aliases: []string{"deleted"},
+	Short:   "List deleted sounds that can be restored",
+	Run: func(cmd *cobra.Command, args []string) {
+		address, err := url.Parse(viper.GetString("bell.address") + TrashPath)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"server address": viper.GetString("bell.address"),
+				"method":         "listTrashCmd.Run",
+			}).WithError(err).Errorf("Failed to build URL")
+			return
+		}
+		resp, err := http.Get(address.String())
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"error": err,
+			}).Error("Failed to contact bell server")
+			return
+		}
+		defer resp.Body.Close()
+		var deleted []sound.DeletedSound
+		json.NewDecoder(resp.Body).Decode(&deleted)
+		if len(deleted) == 0 {
+			logrus.Infof("Trash is empty")
+			return
+		}
+		for _, d := range deleted {
+			fmt.Printf("  - %v (deleted %v)\n", d.Name, d.DeletedAt.Format("2006-01-02 15:04:05"))
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(undeleteCmd)
+	listCmd.AddCommand(listTrashCmd)
+}
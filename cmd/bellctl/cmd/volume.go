@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+
+	"github.com/restanrm/bell/volume"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var volumeOptions struct {
+	destination string
+}
+
+// volumeCmd represents the volume command
+var volumeCmd = &cobra.Command{
+	Use:   "volume [PERCENT]",
+	Short: "Show or change the volume of the server and of the clients",
+	Long: `Without argument, show the volume settings of the destinations. With a
+percentage between 0 and 100, change the volume of --destination, the server
+if empty.`,
+	Example: `
+  bellctl volume
+  bellctl volume 40 -d office
+	`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 {
+			listVolumes()
+			return
+		}
+		if _, err := strconv.Atoi(args[0]); err != nil {
+			logrus.Fatalf("Invalid volume %q, please give a percentage", args[0])
+		}
+		setVolume(url.Values{"volume": {args[0]}})
+	},
+}
+
+var muteCmd = &cobra.Command{
+	Use:   "mute",
+	Short: "Refuse the plays on the server or on a client",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		setVolume(url.Values{"muted": {"true"}})
+	},
+}
+
+var unmuteCmd = &cobra.Command{
+	Use:   "unmute",
+	Short: "Accept the plays on the server or on a client again",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		setVolume(url.Values{"muted": {"false"}})
+	},
+}
+
+func listVolumes() {
+	var all map[string]volume.Settings
+	err := apiRequest(http.MethodGet, VolumePath, nil, &all)
+	if err != nil {
+		logrus.WithError(err).Fatal("Failed to retrieve the volumes")
+	}
+	dests := make([]string, 0, len(all))
+	for d := range all {
+		dests = append(dests, d)
+	}
+	sort.Strings(dests)
+	for _, d := range dests {
+		muted := ""
+		if all[d].Muted {
+			muted = " (muted)"
+		}
+		fmt.Printf("  - %v: %v%%%v\n", d, all[d].Volume, muted)
+	}
+}
+
+// setVolume changes the volume settings of the destination option
+func setVolume(values url.Values) {
+	if volumeOptions.destination != "" {
+		values.Set("destination", volumeOptions.destination)
+	}
+	var s volume.Settings
+	err := apiRequest(http.MethodPut, VolumePath, values, &s)
+	if err != nil {
+		logrus.WithError(err).Fatal("Failed to change the volume")
+	}
+	dest := volumeOptions.destination
+	if dest == "" {
+		dest = "server"
+	}
+	logrus.WithFields(logrus.Fields{
+		"destination": dest,
+		"volume":      s.Volume,
+		"muted":       s.Muted,
+	}).Info("Volume changed")
+}
+
+func init() {
+	rootCmd.AddCommand(volumeCmd)
+	rootCmd.AddCommand(muteCmd)
+	rootCmd.AddCommand(unmuteCmd)
+	for _, c := range []*cobra.Command{volumeCmd, muteCmd, unmuteCmd} {
+		c.Flags().StringVarP(&volumeOptions.destination, "destination", "d", "", "Destination of the settings, the server if empty")
+	}
+}
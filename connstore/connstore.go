@@ -9,6 +9,9 @@ import (
 	"time"
 
 	"github.com/pkg/errors"
+	"github.com/restanrm/bell/job"
+	"github.com/restanrm/bell/metrics"
+	"github.com/restanrm/bell/queue"
 	"github.com/sirupsen/logrus"
 
 	"github.com/twinj/uuid"
@@ -21,12 +24,23 @@ var (
 	pingPeriod               = time.Duration((9 * pongWait) / 10)
 )
 
+// sendBuffer is the number of messages waiting to be written to a client.
+// Messages sent to a client with a full buffer are dropped.
+const sendBuffer = 16
+
 type MessageType int
 
 const (
 	Error MessageType = iota
 	TTS
 	Sound
+	// Sequence data are the json encoded steps of a sequence
+	Sequence
+	// Stop interrupts the playback of the job in data, or all the playbacks
+	// of the client if empty
+	Stop
+	// Volume data are the json encoded volume settings of the client
+	Volume
 )
 
 // String convert MessageType to string
@@ -38,6 +52,12 @@ func (m MessageType) String() string {
 		return "tts"
 	case 2:
 		return "sound"
+	case 3:
+		return "sequence"
+	case 4:
+		return "stop"
+	case 5:
+		return "volume"
 	}
 	return ""
 }
@@ -52,28 +72,59 @@ type RegisterResponse struct {
 	PingPeriodSecond int    `json:"ping_period_seconds"`
 }
 type PlayerRequest struct {
-	// Type is the type of the payload. It can be "error|tts|sound"
+	// Type is the type of the payload. It can be "error|tts|sound|sequence|stop|volume"
 	Type string `json:"type"`
 	Data string `json:"data"`
+	// Gain is the gain in dB of the sound of a sound order: its loudness
+	// normalization or its manual volume
+	Gain float64 `json:"gain,omitempty"`
+	// Job is the job of the request. The client reports the end of its
+	// playback with a PlayerResponse.
+	Job string `json:"job,omitempty"`
+}
+
+// PlayerResponse is sent by the clients at the end of the playback of a job
+type PlayerResponse struct {
+	Job string `json:"job"`
+	// Error is the reason of the failure of the playback, empty on success
+	Error string `json:"error,omitempty"`
 }
 
 // ConnStore is the struct that holds clients
 type ConnStore struct {
+	jobs      *job.Jobs
 	store     map[string]*client
 	mu        sync.RWMutex
 	interrupt chan os.Signal
+	// registered are called with the name of the new clients
+	registered []func(name string)
 }
 
 type client struct {
 	conn *websocket.Conn
-	send chan []byte
+	send chan message
+
+	mu sync.Mutex
+	// playing are the jobs received by the client and not reported yet, nil
+	// once the client is disconnected
+	playing map[string]bool
+	// closed is set once the messages aren't written to the client anymore
+	closed bool
 }
 
-// New return a new Client object
-func New() *ConnStore {
+type message struct {
+	t    MessageType
+	data []byte
+	job  string
+}
+
+// New return a new Client object. The jobs of the messages are updated when
+// the clients receive them and report the end of their playback.
+func New(jobs *job.Jobs) *ConnStore {
 	interrupt := make(chan os.Signal, 1)
 	signal.Notify(interrupt, os.Interrupt)
 	c := &ConnStore{
+		jobs:      jobs,
 		store:     make(map[string]*client),
 		interrupt: interrupt,
 	}
@@ -108,8 +159,19 @@ func (c *ConnStore) cleanup() {
 	}
 }
 
-// Send get a client and a payload and send content to the destined client
-func (c *ConnStore) Send(dest string, t MessageType, data string) error {
+// Send get a client and a payload and send content to the destined client.
+// The job, if any, is started once the client received the message.
+func (c *ConnStore) Send(dest string, t MessageType, data, job string) error {
+	return c.send(dest, t, PlayerRequest{Type: t.String(), Data: data, Job: job})
+}
+
+// SendSound sends a sound order to the destined client, with the gain in dB
+// to apply to the sound
+func (c *ConnStore) SendSound(dest, sound string, gain float64, job string) error {
+	return c.send(dest, Sound, PlayerRequest{Type: Sound.String(), Data: sound, Gain: gain, Job: job})
+}
+
+func (c *ConnStore) send(dest string, t MessageType, req PlayerRequest) error {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 	client, ok := c.store[dest]
@@ -117,12 +179,29 @@ func (c *ConnStore) Send(dest string, t MessageType, data string) error {
 		return fmt.Errorf("client %q isn't registered", dest)
 	}
 
-	enc, err := json.Marshal(PlayerRequest{Type: t.String(), Data: data})
+	enc, err := json.Marshal(req)
 	if err != nil {
 		return errors.Wrapf(err, "Failed to encode request as json")
 	}
-	client.send <- enc
-	return nil
+	// the messages can't be queued once the write pump has drained them
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	if client.closed {
+		return fmt.Errorf("client %q is disconnecting", dest)
+	}
+	select {
+	case client.send <- message{t: t, data: enc, job: req.Job}:
+		return nil
+	default:
+		metrics.WebsocketMessagesDropped.WithLabelValues(dest, t.String()).Inc()
+		return fmt.Errorf("client %q doesn't read its messages, message dropped", dest)
+	}
+}
+
+// OnRegister registers a function called with the name of each new client,
+// once it received its name. It must be called before the clients register.
+func (c *ConnStore) OnRegister(fn func(name string)) {
+	c.registered = append(c.registered, fn)
 }
 
 // Register function is the public handler to associate new websockets store to the service.Register.
@@ -143,10 +222,12 @@ func (c *ConnStore) Register(conn *websocket.Conn) error {
 	logrus.Infof("registering new client: %v", name)
 
 	cl := &client{
-		conn: conn,
-		send: make(chan []byte),
+		conn:    conn,
+		send:    make(chan message, sendBuffer),
+		playing: make(map[string]bool),
 	}
 	c.store[name] = cl
+	metrics.WebsocketClients.Set(float64(len(c.store)))
 
 	var done = make(chan struct{})
 
@@ -157,35 +238,58 @@ func (c *ConnStore) Register(conn *websocket.Conn) error {
 		conn.SetReadDeadline(time.Now().Add(pongWait))
 		conn.SetPongHandler(func(string) error { cl.conn.SetReadDeadline(time.Now().Add(pongWait)); return nil })
 		for {
-			_, _, err := cl.conn.ReadMessage()
-			if err != nil {
-				if !websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
-					// normal close
-					logrus.WithField("client", name).Infof("Clients closing")
-				} else {
-					// not normal close message
-					logrus.WithError(err).Errorf("Abnormal closure of the websocket")
-				}
+			_, data, err := cl.conn.ReadMessage()
+			if err == nil {
+				c.report(name, cl, data)
+				continue
+			}
+			if !websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				// normal close
+				logrus.WithField("client", name).Infof("Clients closing")
+			} else {
+				// not normal close message
+				logrus.WithError(err).Errorf("Abnormal closure of the websocket")
 			}
 			c.mu.Lock()
 			defer c.mu.Unlock()
 			delete(c.store, name)
+			metrics.WebsocketClients.Set(float64(len(c.store)))
+			cl.mu.Lock()
+			defer cl.mu.Unlock()
+			for id := range cl.playing {
+				c.jobs.Finish(id, fmt.Errorf("client %q disconnected while playing", name))
+			}
+			cl.playing = nil
 			break
 		}
 	}()
 
 	// writePump
 	go func() {
+		defer c.drain(name, cl)
 		defer cl.conn.Close()
 		tick := time.Tick(pingPeriod)
 		for {
 			select {
-			case data := <-cl.send:
-				err := conn.WriteMessage(websocket.TextMessage, data)
+			case m := <-cl.send:
+				err := conn.WriteMessage(websocket.TextMessage, m.data)
 				if err != nil {
+					metrics.WebsocketMessagesDropped.WithLabelValues(name, m.t.String()).Inc()
+					c.jobs.Finish(m.job, errors.Wrapf(err, "Failed to send message to client %q", name))
 					logrus.WithError(err).Errorf("Failed to send message to client")
 					return
 				}
+				metrics.WebsocketMessagesSent.WithLabelValues(name, m.t.String()).Inc()
+				if m.job != "" {
+					c.jobs.Start(m.job)
+					cl.mu.Lock()
+					if cl.playing == nil {
+						c.jobs.Finish(m.job, fmt.Errorf("client %q disconnected while playing", name))
+					} else {
+						cl.playing[m.job] = true
+					}
+					cl.mu.Unlock()
+				}
 			case <-done:
 				return
 			case <-tick:
@@ -203,12 +307,62 @@ func (c *ConnStore) Register(conn *websocket.Conn) error {
 	if err != nil {
 		logrus.WithError(err).Errorf("Failed to send register response to client")
 		delete(c.store, name)
+		metrics.WebsocketClients.Set(float64(len(c.store)))
 		return err
 	}
+	for _, fn := range c.registered {
+		// the client is added to the store once Register returns
+		go fn(name)
+	}
 
 	return nil
 }
 
+// drain fails the jobs of the messages which won't be written to a client
+// anymore, once its write pump has stopped
+func (c *ConnStore) drain(name string, cl *client) {
+	cl.mu.Lock()
+	cl.closed = true
+	cl.mu.Unlock()
+	for {
+		select {
+		case m := <-cl.send:
+			metrics.WebsocketMessagesDropped.WithLabelValues(name, m.t.String()).Inc()
+			if m.job != "" {
+				c.jobs.Finish(m.job, fmt.Errorf("client %q disconnected before receiving the message", name))
+			}
+		default:
+			return
+		}
+	}
+}
+
+// report finishes the job of a PlayerResponse sent by a client
+func (c *ConnStore) report(name string, cl *client, data []byte) {
+	var resp PlayerResponse
+	if err := json.Unmarshal(data, &resp); err != nil || resp.Job == "" {
+		logrus.WithField("client", name).Warn("Ignoring invalid message of client")
+		return
+	}
+	cl.mu.Lock()
+	playing := cl.playing[resp.Job]
+	delete(cl.playing, resp.Job)
+	cl.mu.Unlock()
+	if !playing {
+		return
+	}
+	var err error
+	switch resp.Error {
+	case "":
+	case queue.ErrInterrupted.Error():
+		// the playback has been stopped by the server
+		err = queue.ErrInterrupted
+	default:
+		err = errors.New(resp.Error)
+	}
+	c.jobs.Finish(resp.Job, err)
+}
+
 // List returns the list of registered clients name
 func (c *ConnStore) List() []string {
 	var clist []string
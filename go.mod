@@ -8,6 +8,8 @@ require (
 	github.com/go-logfmt/logfmt v0.4.0 // indirect
 	github.com/gorilla/mux v1.7.3
 	github.com/gorilla/websocket v1.4.0
+	github.com/hajimehoshi/go-mp3 v0.3.4
+	github.com/jfreymuth/oggvorbis v1.0.5
 	github.com/myesui/uuid v1.0.0 // indirect
 	github.com/pkg/errors v0.8.1
 	github.com/prometheus/client_golang v1.0.0
@@ -18,4 +20,6 @@ require (
 	github.com/spf13/cobra v0.0.5
 	github.com/spf13/viper v1.4.0
 	github.com/twinj/uuid v1.0.0
+	go.etcd.io/bbolt v1.3.5
+	golang.org/x/crypto v0.0.0-20190308221718-c2843e01d9a2
 )
@@ -0,0 +1,141 @@
+// Package health verifies the dependencies of the server: its data
+// directory, its sounds library, the audio toolchain and the text to speech
+// services. The results are reported check by check.
+package health
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Status of the checks and of the reports
+const (
+	OK   = "ok"
+	Warn = "warn"
+	Fail = "fail"
+)
+
+// Check is a named verification of a dependency
+type Check struct {
+	Name string
+	Run  func() error
+	// Optional checks only warn when they fail, like the ones of the
+	// dependencies having a fallback. The report stays healthy.
+	Optional bool
+}
+
+// Result is the outcome of a check
+type Result struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	// Took is the duration of the check in milliseconds
+	Took float64 `json:"took_ms"`
+}
+
+// Report is the outcome of checks, failed if one of them failed
+type Report struct {
+	Status string   `json:"status"`
+	Checks []Result `json:"checks"`
+}
+
+// Healthy returns true if all the checks passed
+func (r Report) Healthy() bool {
+	return r.Status == OK
+}
+
+// Failures returns the failed checks
+func (r Report) Failures() []Result {
+	return r.with(Fail)
+}
+
+// Warnings returns the failed optional checks
+func (r Report) Warnings() []Result {
+	return r.with(Warn)
+}
+
+func (r Report) with(status string) []Result {
+	var out []Result
+	for _, c := range r.Checks {
+		if c.Status == status {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// Run runs the checks concurrently and reports their results in the order
+// of the checks
+func Run(checks ...Check) Report {
+	r := Report{Status: OK, Checks: make([]Result, len(checks))}
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c Check) {
+			defer wg.Done()
+			begin := time.Now()
+			err := c.Run()
+			res := Result{Name: c.Name, Status: OK, Took: float64(time.Since(begin)) / float64(time.Millisecond)}
+			if err != nil {
+				res.Status = Fail
+				if c.Optional {
+					res.Status = Warn
+				}
+				res.Error = err.Error()
+			}
+			r.Checks[i] = res
+		}(i, c)
+	}
+	wg.Wait()
+	if len(r.Failures()) > 0 {
+		r.Status = Fail
+	}
+	return r
+}
+
+// Writable checks that files can be created in the directory
+func Writable(dir string) func() error {
+	return func() error {
+		f, err := ioutil.TempFile(dir, ".healthz")
+		if err != nil {
+			return errors.Wrapf(err, "Directory %v is not writable", dir)
+		}
+		f.Close()
+		return os.Remove(f.Name())
+	}
+}
+
+// Binary checks that the command is found in the PATH
+func Binary(name string) func() error {
+	return func() error {
+		if _, err := exec.LookPath(name); err != nil {
+			return fmt.Errorf("%v not found in PATH", name)
+		}
+		return nil
+	}
+}
+
+// Cached returns a check running check at most once per ttl, to avoid
+// querying costly services on every probe
+func Cached(ttl time.Duration, check func() error) func() error {
+	var (
+		mu   sync.Mutex
+		last time.Time
+		err  error
+	)
+	return func() error {
+		mu.Lock()
+		defer mu.Unlock()
+		if last.IsZero() || time.Since(last) >= ttl {
+			err = check()
+			last = time.Now()
+		}
+		return err
+	}
+}
@@ -0,0 +1,313 @@
+// Package history keeps a persistent record of the playbacks: who played
+// what, from where, on which destination and with which result. The entries
+// are appended to a json lines file and expire after a retention period.
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Sources of the playbacks
+const (
+	REST       = "rest"
+	Mattermost = "mattermost"
+	Schedule   = "schedule"
+)
+
+// Results of the playbacks
+const (
+	// Queued playbacks have been queued on the server or sent to the client,
+	// and are not finished yet
+	Queued = "queued"
+	// Played playbacks have been played to the end
+	Played = "played"
+	// Denied playbacks have been refused by the quiet hours policy
+	Denied = "denied"
+	// Failed playbacks couldn't be played
+	Failed = "failed"
+	// Removed playbacks have been removed from the queue before being played
+	Removed = "removed"
+	// Interrupted playbacks have been stopped while playing
+	Interrupted = "interrupted"
+)
+
+// pruneInterval is the minimum delay between two removals of the expired
+// entries
+const pruneInterval = time.Hour
+
+// Entry is a playback of a sound, a text or a sequence
+type Entry struct {
+	Time   time.Time `json:"time"`
+	Caller string    `json:"caller,omitempty"`
+	Source string    `json:"source"`
+	// Sound is the name of the sound played. The refused playbacks and the
+	// sounds not found keep the requested sound or tag.
+	Sound string `json:"sound,omitempty"`
+	// Tag is the tag played, Sound being the sound picked for it
+	Tag      string `json:"tag,omitempty"`
+	Text     string `json:"text,omitempty"`
+	Sequence string `json:"sequence,omitempty"`
+	// Destination is the client playing the sound, "server" for the server
+	Destination string `json:"destination"`
+	Result      string `json:"result"`
+	Reason      string `json:"reason,omitempty"`
+	// Job is the id of the job following the playback. The queued entry is
+	// finished with the outcome of the job.
+	Job string `json:"job,omitempty"`
+}
+
+// Filter selects entries of the history. Empty fields match every entry.
+type Filter struct {
+	Caller      string
+	Source      string
+	Sound       string
+	Tag         string
+	Sequence    string
+	Destination string
+	Result      string
+	// Text matches the entries whose text contains it, ignoring the case
+	Text  string
+	Since time.Time
+	Until time.Time
+	// Offset is the number of matching entries skipped, the newest first
+	Offset int
+	// Limit is the maximum number of entries returned, all if 0
+	Limit int
+}
+
+func (f Filter) match(e Entry) bool {
+	for _, c := range []struct{ want, got string }{
+		{f.Caller, e.Caller},
+		{f.Source, e.Source},
+		{f.Sound, e.Sound},
+		{f.Tag, e.Tag},
+		{f.Sequence, e.Sequence},
+		{f.Destination, e.Destination},
+		{f.Result, e.Result},
+	} {
+		if c.want != "" && c.want != c.got {
+			return false
+		}
+	}
+	if f.Text != "" && !strings.Contains(strings.ToLower(e.Text), strings.ToLower(f.Text)) {
+		return false
+	}
+	if !f.Since.IsZero() && e.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !e.Time.Before(f.Until) {
+		return false
+	}
+	return true
+}
+
+// History records the playbacks. A nil History records nothing.
+type History struct {
+	fp string
+	// retention is how long the entries are kept, forever if 0
+	retention time.Duration
+	// max is the maximum number of entries kept, unlimited if 0
+	max int
+
+	mu      sync.Mutex
+	entries []Entry
+	f       *os.File
+	pruned  time.Time
+}
+
+// New returns the history stored in the file at fp. The entries older than
+// retention and the oldest entries beyond max are removed.
+func New(fp string, retention time.Duration, max int) (*History, error) {
+	h := &History{
+		fp:        fp,
+		retention: retention,
+		max:       max,
+	}
+	f, err := os.Open(fp)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.Wrapf(err, "Failed to open history file %v", fp)
+	}
+	if err == nil {
+		// the finished entries are appended again, they replace the queued
+		// ones of their job
+		jobs := make(map[string]int)
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for n := 1; scanner.Scan(); n++ {
+			var e Entry
+			if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+				logrus.WithError(err).WithField("line", n).Warn("Ignoring invalid entry of the history")
+				continue
+			}
+			if i, ok := jobs[e.Job]; ok && e.Job != "" {
+				h.entries[i] = e
+				continue
+			}
+			jobs[e.Job] = len(h.entries)
+			h.entries = append(h.entries, e)
+		}
+		err = scanner.Err()
+		f.Close()
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to read history file %v", fp)
+		}
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err := h.prune(time.Now(), true); err != nil {
+		return nil, err
+	}
+	if h.f == nil {
+		if h.f, err = os.OpenFile(fp, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644); err != nil {
+			return nil, errors.Wrapf(err, "Failed to open history file %v", fp)
+		}
+	}
+	return h, nil
+}
+
+// Record adds an entry to the history. Its time is set if it is empty.
+func (h *History) Record(e Entry) {
+	if h == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to encode history entry")
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.entries = append(h.entries, e)
+	if _, err = h.f.Write(append(data, '\n')); err != nil {
+		logrus.WithError(err).Error("Failed to write history entry")
+	}
+	if err = h.prune(e.Time, false); err != nil {
+		logrus.WithError(err).Error("Failed to remove the expired entries of the history")
+	}
+}
+
+// Finish sets the result of the queued entry of a job, and returns the
+// finished entry. It returns false if the job has no queued entry.
+func (h *History) Finish(job, result, reason string) (Entry, bool) {
+	if h == nil || job == "" {
+		return Entry{}, false
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	// the entries of the jobs finishing are usually the last ones
+	for i := len(h.entries) - 1; i >= 0; i-- {
+		e := &h.entries[i]
+		if e.Job != job {
+			continue
+		}
+		if e.Result != Queued {
+			return Entry{}, false
+		}
+		e.Result, e.Reason = result, reason
+		data, err := json.Marshal(e)
+		if err != nil {
+			logrus.WithError(err).Error("Failed to encode history entry")
+			return *e, true
+		}
+		if _, err = h.f.Write(append(data, '\n')); err != nil {
+			logrus.WithError(err).Error("Failed to write history entry")
+		}
+		return *e, true
+	}
+	return Entry{}, false
+}
+
+// Query returns the entries matching the filter, the newest first, and the
+// number of matching entries before the pagination
+func (h *History) Query(f Filter) ([]Entry, int) {
+	out := []Entry{}
+	if h == nil {
+		return out, 0
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	total := 0
+	for i := len(h.entries) - 1; i >= 0; i-- {
+		e := h.entries[i]
+		if !f.match(e) {
+			continue
+		}
+		if total >= f.Offset && (f.Limit == 0 || len(out) < f.Limit) {
+			out = append(out, e)
+		}
+		total++
+	}
+	return out, total
+}
+
+// prune removes the expired entries and rewrites the file, at most once per
+// pruneInterval unless force is true. Caller must hold the lock.
+func (h *History) prune(now time.Time, force bool) error {
+	if !force && now.Sub(h.pruned) < pruneInterval && (h.max == 0 || len(h.entries) <= 2*h.max) {
+		return nil
+	}
+	h.pruned = now
+	first := 0
+	if h.retention > 0 {
+		for first < len(h.entries) && now.Sub(h.entries[first].Time) > h.retention {
+			first++
+		}
+	}
+	if h.max > 0 && len(h.entries)-first > h.max {
+		first = len(h.entries) - h.max
+	}
+	if first == 0 {
+		return nil
+	}
+	h.entries = append([]Entry(nil), h.entries[first:]...)
+	return h.rewrite()
+}
+
+// rewrite replaces the file with the entries in memory. Caller must hold the
+// lock.
+func (h *History) rewrite() error {
+	tmp, err := os.OpenFile(h.fp+".tmp", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to create temporary history file")
+	}
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	for _, e := range h.entries {
+		if err = enc.Encode(e); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return errors.Wrapf(err, "Failed to write temporary history file")
+	}
+	if err = os.Rename(tmp.Name(), h.fp); err != nil {
+		os.Remove(tmp.Name())
+		return errors.Wrapf(err, "Failed to replace %v", h.fp)
+	}
+	if h.f != nil {
+		h.f.Close()
+	}
+	h.f, err = os.OpenFile(h.fp, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to open history file %v", h.fp)
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package history
+
+import "sort"
+
+// dayLayout is the layout of the days of the statistics
+const dayLayout = "2006-01-02"
+
+// Count is the number of playbacks of a sound, a tag, a day, a destination or
+// a caller
+type Count struct {
+	Key   string `json:"key"`
+	Plays int    `json:"plays"`
+}
+
+// Stats are the statistics of the played playbacks
+type Stats struct {
+	Plays int `json:"plays"`
+	// Texts is the number of texts to speech among the playbacks
+	Texts int `json:"texts"`
+	// Sounds and Tags are the most played sounds and tags, the most played
+	// first. A tag played directly counts as a play of the sound picked for
+	// it and of the tag.
+	Sounds    []Count `json:"sounds"`
+	Tags      []Count `json:"tags"`
+	Sequences []Count `json:"sequences"`
+	// Hours are the playbacks for each hour of the day, in the local time
+	Hours [24]int `json:"hours"`
+	// Days are the playbacks for each day with playbacks, the oldest first
+	Days         []Count `json:"days"`
+	Destinations []Count `json:"destinations"`
+	Callers      []Count `json:"callers"`
+}
+
+// Stats returns the statistics of the played entries matching the filter,
+// keeping the top most played keys of each ranking, all of them if top is 0.
+// tags returns the tags of a sound, or the tag itself for a tag. The Result,
+// Offset and Limit of the filter are ignored.
+func (h *History) Stats(f Filter, top int, tags func(name string) []string) Stats {
+	f.Result = Played
+	f.Offset, f.Limit = 0, 0
+	entries, _ := h.Query(f)
+
+	st := Stats{Plays: len(entries)}
+	sounds := make(map[string]int)
+	tagPlays := make(map[string]int)
+	sequences := make(map[string]int)
+	days := make(map[string]int)
+	destinations := make(map[string]int)
+	callers := make(map[string]int)
+	for _, e := range entries {
+		switch {
+		case e.Sound != "":
+			sounds[e.Sound]++
+			var ts []string
+			if tags != nil {
+				ts = tags(e.Sound)
+			}
+			if e.Tag != "" && !contains(ts, e.Tag) {
+				ts = append(ts, e.Tag)
+			}
+			for _, t := range ts {
+				tagPlays[t]++
+			}
+		case e.Text != "":
+			st.Texts++
+		case e.Sequence != "":
+			sequences[e.Sequence]++
+		}
+		t := e.Time.Local()
+		st.Hours[t.Hour()]++
+		days[t.Format(dayLayout)]++
+		destinations[e.Destination]++
+		if e.Caller != "" {
+			callers[e.Caller]++
+		}
+	}
+	st.Sounds = ranking(sounds, top)
+	st.Tags = ranking(tagPlays, top)
+	st.Sequences = ranking(sequences, top)
+	st.Destinations = ranking(destinations, top)
+	st.Callers = ranking(callers, top)
+	st.Days = make([]Count, 0, len(days))
+	for d, n := range days {
+		st.Days = append(st.Days, Count{Key: d, Plays: n})
+	}
+	sort.Slice(st.Days, func(i, j int) bool { return st.Days[i].Key < st.Days[j].Key })
+	return st
+}
+
+// ranking returns the top keys of counts, the most played first and by name
+// on a tie
+func ranking(counts map[string]int, top int) []Count {
+	out := make([]Count, 0, len(counts))
+	for k, n := range counts {
+		out = append(out, Count{Key: k, Plays: n})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Plays != out[j].Plays {
+			return out[i].Plays > out[j].Plays
+		}
+		return out[i].Key < out[j].Key
+	})
+	if top > 0 && len(out) > top {
+		out = out[:top]
+	}
+	return out
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,49 @@
+package history
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestStatsTagPlays(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bell-history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	h, err := New(filepath.Join(dir, "history.jsonl"), 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range []Entry{
+		{Sound: "ding", Result: Played},
+		// the tag door picked knock twice, then bell which lost the tag since
+		{Sound: "knock", Tag: "door", Result: Played},
+		{Sound: "knock", Tag: "door", Result: Played},
+		{Sound: "bell", Tag: "door", Result: Played},
+		{Sound: "door", Result: Denied},
+	} {
+		e.Source, e.Destination = REST, "server"
+		h.Record(e)
+	}
+	tags := map[string][]string{
+		"ding":  {"door"},
+		"knock": {"door", "wood"},
+	}
+	st := h.Stats(Filter{}, 0, func(name string) []string { return tags[name] })
+
+	if st.Plays != 4 {
+		t.Errorf("got %d plays, want 4", st.Plays)
+	}
+	sounds := []Count{{"knock", 2}, {"bell", 1}, {"ding", 1}}
+	if !reflect.DeepEqual(st.Sounds, sounds) {
+		t.Errorf("got sounds %v, want %v", st.Sounds, sounds)
+	}
+	tagPlays := []Count{{"door", 4}, {"wood", 2}}
+	if !reflect.DeepEqual(st.Tags, tagPlays) {
+		t.Errorf("got tags %v, want %v", st.Tags, tagPlays)
+	}
+}
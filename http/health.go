@@ -0,0 +1,27 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/restanrm/bell/health"
+	"github.com/sirupsen/logrus"
+)
+
+// Health runs the checks and reports their results. The status is 503 if one
+// of them failed.
+func Health(checks ...health.Check) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report := health.Run(checks...)
+		status := http.StatusOK
+		if !report.Healthy() {
+			status = http.StatusServiceUnavailable
+			logrus.WithField("failures", report.Failures()).Warn("Health check failed")
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		if err := json.NewEncoder(w).Encode(report); err != nil {
+			logrus.WithError(err).Error("Failed to encode health report to json")
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/restanrm/bell/api"
+	"github.com/restanrm/bell/history"
+	"github.com/restanrm/bell/job"
+	"github.com/restanrm/bell/metrics"
+	"github.com/restanrm/bell/policy"
+	"github.com/restanrm/bell/queue"
+	"github.com/restanrm/bell/sound"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultHistoryLimit = 50
+	maxHistoryLimit     = 1000
+)
+
+// ListHistory returns the entries of the history, the newest first. They are
+// filtered by the caller, source, sound, sequence, destination, result and
+// text query parameters, and between the since and until times. The pages
+// are selected with the offset and limit query parameters.
+func ListHistory(hist *history.History) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		f, ok := historyFilter(w, r)
+		if !ok {
+			return
+		}
+		f.Limit = defaultHistoryLimit
+		values := r.URL.Query()
+		var err error
+		for _, n := range []struct {
+			name string
+			v    *int
+		}{{"offset", &f.Offset}, {"limit", &f.Limit}} {
+			s := values.Get(n.name)
+			if s == "" {
+				continue
+			}
+			if *n.v, err = strconv.Atoi(s); err != nil || *n.v < 0 {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprintf(w, "Invalid %v %q", n.name, s)
+				return
+			}
+		}
+		if f.Limit == 0 || f.Limit > maxHistoryLimit {
+			f.Limit = maxHistoryLimit
+		}
+		entries, total := hist.Query(f)
+		w.Header().Add("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(api.HistoryPage{
+			Total:   total,
+			Offset:  f.Offset,
+			Limit:   f.Limit,
+			Entries: entries,
+		})
+		if err != nil {
+			logrus.WithError(err).Error("Failed to encode history to json")
+		}
+	}
+}
+
+// historyFilter returns the filter of the caller, source, sound, sequence,
+// destination, result and text query parameters, between the since and until
+// times. An invalid time is reported to the client.
+func historyFilter(w http.ResponseWriter, r *http.Request) (history.Filter, bool) {
+	values := r.URL.Query()
+	f := history.Filter{
+		Caller:      values.Get("caller"),
+		Source:      values.Get("source"),
+		Sound:       values.Get("sound"),
+		Tag:         values.Get("tag"),
+		Sequence:    values.Get("sequence"),
+		Destination: values.Get("destination"),
+		Result:      values.Get("result"),
+		Text:        values.Get("text"),
+	}
+	var err error
+	for _, t := range []struct {
+		name string
+		v    *time.Time
+	}{{"since", &f.Since}, {"until", &f.Until}} {
+		if *t.v, err = parseSince(values.Get(t.name), time.Now()); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "Invalid %v: %v", t.name, err)
+			return f, false
+		}
+	}
+	return f, true
+}
+
+// parseSince parses a RFC 3339 time, or a duration before now like "24h".
+// An empty string is the zero time.
+func parseSince(s string, now time.Time) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return t, fmt.Errorf("%q is neither a RFC 3339 time nor a duration", s)
+	}
+	return t, nil
+}
+
+// record adds a playback to the history, with the destination and the result
+// of the decision of the policy, or the error of the playback. The accepted
+// playbacks are queued, and finished by FinishHistory with the outcome of
+// their job.
+func record(hist *history.History, e history.Entry, d policy.Decision, err error) {
+	e.Destination = d.Destination
+	e.Reason = d.Reason
+	switch {
+	case !d.Allowed:
+		e.Result = history.Denied
+	case err != nil:
+		e.Result = history.Failed
+		e.Reason = err.Error()
+	default:
+		e.Result = history.Queued
+	}
+	hist.Record(e)
+}
+
+// pickSound resolves name, a sound or a tag, to the sound to play. The
+// picked sound is recorded in e, with the tag when a tag is played.
+func pickSound(vault sound.Sounder, e *history.Entry, name string) (sound.Sound, error) {
+	s, err := sound.Pick(vault, name)
+	if err != nil {
+		return s, err
+	}
+	e.Sound = s.Name
+	if s.Name != name {
+		e.Tag = name
+	}
+	return s, nil
+}
+
+// FinishHistory returns the function finishing the queued entries of the
+// history with the outcome of their job. The sounds played to the end are
+// counted in the metrics.
+func FinishHistory(hist *history.History) func(j job.Job, err error) {
+	return func(j job.Job, err error) {
+		result, reason := history.Played, ""
+		switch errors.Cause(err) {
+		case nil:
+		case queue.ErrRemoved:
+			result = history.Removed
+		case queue.ErrInterrupted:
+			result = history.Interrupted
+		default:
+			result, reason = history.Failed, err.Error()
+		}
+		hist.Finish(j.ID, result, reason)
+		if result == history.Played && j.Sound != "" {
+			metrics.SoundPlays.WithLabelValues(j.Sound, j.Destination).Inc()
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/restanrm/bell/api"
+	"github.com/restanrm/bell/job"
+	"github.com/restanrm/bell/policy"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// GetJob returns a job. With the wait query parameter, it returns once the
+// job is finished, or after the wait timeout if it isn't.
+func GetJob(jobs *job.Jobs) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		wait, ok := waitParam(w, r)
+		if !ok {
+			return
+		}
+		id := mux.Vars(r)["id"]
+		j, err := jobs.Get(id)
+		if err == nil && wait {
+			j, err = jobs.Wait(id, viper.GetDuration("jobs.waitTimeout"))
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		w.Header().Add("Content-Type", "application/json")
+		if err = json.NewEncoder(w).Encode(j); err != nil {
+			logrus.WithError(err).Error("Failed to encode job to json")
+		}
+	}
+}
+
+// waitParam returns the value of the wait query parameter, false if empty.
+// An invalid value is reported to the client.
+func waitParam(w http.ResponseWriter, r *http.Request) (bool, bool) {
+	s := r.URL.Query().Get("wait")
+	if s == "" {
+		return false, true
+	}
+	wait, err := strconv.ParseBool(s)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Invalid wait %q, please use true or false", s)
+		return false, false
+	}
+	return wait, true
+}
+
+// writeJob answers the job of an accepted playback. When wait is true, it
+// answers once the job is finished: the status is 500 if the job failed, and
+// 202 if it is still playing after the wait timeout.
+func writeJob(w http.ResponseWriter, jobs *job.Jobs, d policy.Decision, j job.Job, wait bool) {
+	status := http.StatusOK
+	cur, err := jobs.Get(j.ID)
+	if wait {
+		cur, err = jobs.Wait(j.ID, viper.GetDuration("jobs.waitTimeout"))
+	}
+	if err == nil {
+		j = cur
+	}
+	switch {
+	case wait && j.Status == job.Failed:
+		status = http.StatusInternalServerError
+	case wait && !j.Finished():
+		status = http.StatusAccepted
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(api.PlayResponse{Decision: d, Job: j}); err != nil {
+		logrus.WithError(err).Error("Failed to encode job to json")
+	}
+}
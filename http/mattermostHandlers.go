@@ -2,19 +2,36 @@ package http
 
 import (
 	"bytes"
+	"crypto/subtle"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/restanrm/bell/tts"
 
+	"github.com/restanrm/bell/history"
+	"github.com/restanrm/bell/job"
 	"github.com/restanrm/bell/player"
+	"github.com/restanrm/bell/policy"
+	"github.com/restanrm/bell/queue"
 	"github.com/restanrm/bell/sound"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 )
 
+// mattermostStatsTop is the length of the rankings of the stats command
+const mattermostStatsTop = 5
+
+// statsPeriods are the periods of the stats command in addition to the
+// durations
+var statsPeriods = map[string]time.Duration{
+	"day":   24 * time.Hour,
+	"week":  7 * 24 * time.Hour,
+	"month": 30 * 24 * time.Hour,
+}
+
 var (
 	// Ephemeral response ar only seen by querier
 	Ephemeral = "ephemeral"
@@ -39,26 +56,38 @@ type listSender interface {
 	Sender
 }
 
-// MattermostHandler handle mattermost /bell commands.
-// it allows to list and play sounds, and do some TTS.
-func MattermostHandler(vault sound.Sounder, listSender listSender) http.HandlerFunc {
+// MattermostToken refuses the mattermost requests without the token of the
+// slash command, before anything else is done for them
+func MattermostToken(h http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		rToken := r.FormValue("token")
 		logrus.Debug("rToken: ", rToken)
 		if token := viper.GetString("mattermost.token"); token != "" {
-			if rToken != token {
+			if subtle.ConstantTimeCompare([]byte(rToken), []byte(token)) != 1 {
 				w.WriteHeader(http.StatusForbidden)
 				return
 			}
 		}
 		logrus.Debugf("mattermost request token is valid")
+		h(w, r)
+	}
+}
 
+// MattermostHandler handle mattermost /bell commands.
+// it allows to list and play sounds, and do some TTS. The token of the
+// requests must be checked by MattermostToken.
+func MattermostHandler(vault sound.Sounder, q *queue.Queue, listSender listSender, pol *policy.Policy, hist *history.History, jobs *job.Jobs) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
 		// command := r.FormValue("command") // complete command ex: /bell
 		text := r.FormValue("text") // complete list of arguments
 		responseURL := r.FormValue("response_url")
 
 		// parse command and build response to send back to caller
-		response := parseCommand(vault, listSender, text)
+		response := parseCommand(vault, q, listSender, pol, hist, jobs, r.FormValue("user_name"), text)
+		if response.Type != InChannel {
+			// only the commands that succeed are shown in the channel
+			notPlayed(r)
+		}
 
 		jres, err := json.Marshal(response)
 		if err != nil {
@@ -77,7 +106,9 @@ func MattermostHandler(vault sound.Sounder, listSender listSender) http.HandlerF
 	}
 }
 
-func parseCommand(vault sound.Sounder, listSender listSender, text string) (response SlashCommandResponse) {
+// parseCommand runs the command of the mattermost user. The playbacks are
+// recorded in the history on behalf of the user, and followed by jobs.
+func parseCommand(vault sound.Sounder, q *queue.Queue, listSender listSender, pol *policy.Policy, hist *history.History, jobs *job.Jobs, user, text string) (response SlashCommandResponse) {
 
 	response = SlashCommandResponse{
 		Type: Ephemeral,
@@ -86,7 +117,7 @@ func parseCommand(vault sound.Sounder, listSender listSender, text string) (resp
 	arguments := strings.Fields(text)
 
 	if len(arguments) <= 0 {
-		response.Text = "No subcommand specified, please use the following (list|play|say)"
+		response.Text = "No subcommand specified, please use the following (list|play|say|stop|stats)"
 		return
 	}
 
@@ -104,13 +135,29 @@ func parseCommand(vault sound.Sounder, listSender listSender, text string) (resp
 			response.Text = formatSounds(sounds)
 		}
 	case "play":
-		m := new(player.MpvPlayer)
 		switch {
 		case len(arguments) <= 0:
 			response.Text = "Cannot guess what sound to play"
 		case len(arguments) == 1:
-			err := vault.PlaySound(arguments[0], m)
+			e := history.Entry{Caller: user, Source: history.Mattermost, Sound: arguments[0]}
+			d := pol.Decide(policy.Server, policyTags(vault, arguments[0]), time.Now())
+			if !d.Allowed {
+				record(hist, e, d, nil)
+				response.Text = denied(d)
+				return
+			}
+			s, err := pickSound(vault, &e, arguments[0])
 			if err != nil {
+				record(hist, e, d, err)
+				response.Text = fmt.Sprintf("Failed to play the sound: %v", err)
+				return
+			}
+			j := jobs.Create(job.Job{Sound: e.Sound, Tag: e.Tag, Destination: d.Destination})
+			e.Job = j.ID
+			record(hist, e, d, nil)
+			err = vault.PlaySound(s.Name, q.JobPlayer(queue.Normal, j.ID))
+			if err != nil {
+				jobs.Finish(j.ID, err)
 				response.Text = fmt.Sprintf("Failed to play the sound: %v", err)
 				return
 			}
@@ -124,43 +171,118 @@ func parseCommand(vault sound.Sounder, listSender listSender, text string) (resp
 			// arguments[1] should be the destination "supervision"
 			// arguments[2] should be the play ""
 			destination := arguments[1]
-			sound := arguments[2]
-			err := PlayOnClient(listSender, destination, sound)
+			name := arguments[2]
+			e := history.Entry{Caller: user, Source: history.Mattermost, Sound: name}
+			d := pol.Decide(destination, policyTags(vault, name), time.Now())
+			if !d.Allowed {
+				record(hist, e, d, nil)
+				response.Text = denied(d)
+				return
+			}
+			s, err := pickSound(vault, &e, name)
+			if err != nil {
+				record(hist, e, d, err)
+				response.Text = fmt.Sprintf("Failed to play %v on destination %v: %v",
+					name,
+					destination,
+					err,
+				)
+				return
+			}
+			j := jobs.Create(job.Job{Sound: e.Sound, Tag: e.Tag, Destination: d.Destination})
+			e.Job = j.ID
+			record(hist, e, d, nil)
+			err = PlayOnClient(listSender, destination, s, j.ID)
 			if err != nil {
+				jobs.Finish(j.ID, err)
 				response.Text = fmt.Sprintf("Failed to play %v on destination %v: %v",
-					sound,
+					name,
 					destination,
 					err,
 				)
 				return
 			}
-			response.Text = fmt.Sprintf(":musical_note: sound %q is playing on destination %q :musical_note:", sound, destination)
+			response.Text = fmt.Sprintf(":musical_note: sound %q is playing on destination %q :musical_note:", name, destination)
 			response.Type = InChannel
 		}
 	case "say":
-		var m player.Player
 		var t tts.Sayer
-		m = new(player.MpvPlayer)
 		t = tts.NewTTS(
 			viper.GetBool("flite"),
 			viper.GetString("polly.accessKey"),
 			viper.GetString("polly.secretKey"),
 		)
 		text := strings.Join(arguments, " ")
-		err := t.Say(text, m)
+		e := history.Entry{Caller: user, Source: history.Mattermost, Text: text}
+		d := pol.Decide(policy.Server, nil, time.Now())
+		if !d.Allowed {
+			record(hist, e, d, nil)
+			response.Text = denied(d)
+			return
+		}
+		j := jobs.Create(job.Job{Text: text, Destination: d.Destination})
+		e.Job = j.ID
+		record(hist, e, d, nil)
+		err := t.Say(text, q.JobPlayer(queue.Normal, j.ID))
 		if err != nil {
+			jobs.Finish(j.ID, err)
 			response.Text = fmt.Sprintf(":broken_heart: something went wrong: %s", err)
 			return
 		}
 		response.Text = text
 		response.Type = InChannel
 
+	case "stop":
+		var destination string
+		switch {
+		case len(arguments) == 2 && arguments[0] == "-d":
+			destination = arguments[1]
+		case len(arguments) != 0:
+			response.Text = "Usage: /bell stop [-d destination]"
+			return
+		}
+		stopped, err := stopDestinations(q, listSender, destination)
+		if err == player.ErrNothingPlaying {
+			stopped, err = nil, nil
+		}
+		if err != nil {
+			response.Text = fmt.Sprintf("Failed to stop the sounds: %v", err)
+			return
+		}
+		response.Text = formatStopped(stopped)
+		if len(stopped) > 0 {
+			response.Text += fmt.Sprintf(" by %v", user)
+			response.Type = InChannel
+		}
+
+	case "stats":
+		f := history.Filter{}
+		period := "in the history"
+		if len(arguments) > 0 {
+			d, ok := statsPeriods[arguments[0]]
+			if !ok {
+				var err error
+				if d, err = time.ParseDuration(arguments[0]); err != nil || d <= 0 {
+					response.Text = fmt.Sprintf("Invalid period %q, please use day, week, month or a duration like 12h", arguments[0])
+					return
+				}
+			}
+			f.Since = time.Now().Add(-d)
+			period = "in the last " + arguments[0]
+		}
+		response.Text = formatStats(hist.Stats(f, mattermostStatsTop, tagsOf(vault)), period)
+
 	default:
 		response.Text = "This command isn't supported"
 	}
 	return response
 }
 
+// denied explains why the policy denied a playback
+func denied(d policy.Decision) string {
+	return fmt.Sprintf(":mute: Not played on %v: %v", d.Destination, d.Reason)
+}
+
 func formatSounds(sounds []sound.Sound) (out string) {
 	if len(sounds) <= 0 {
 		out += fmt.Sprintf("No sounds found")
@@ -174,6 +296,32 @@ func formatSounds(sounds []sound.Sound) (out string) {
 	return out
 }
 
+func formatStats(st history.Stats, period string) (out string) {
+	if st.Plays <= 0 {
+		return fmt.Sprintf("Nothing has been played %v", period)
+	}
+	out += fmt.Sprintf("#### %d playbacks %v, %d texts to speech\n", st.Plays, period, st.Texts)
+	for _, r := range []struct {
+		title  string
+		counts []history.Count
+	}{
+		{"Sound", st.Sounds},
+		{"Tag", st.Tags},
+		{"User", st.Callers},
+		{"Destination", st.Destinations},
+	} {
+		if len(r.counts) <= 0 {
+			continue
+		}
+		out += fmt.Sprintf("\n|%s|%s|\n", r.title, "Plays")
+		out += fmt.Sprintf("|:--|--:|\n")
+		for _, c := range r.counts {
+			out += fmt.Sprintf("|%s|%d|\n", c.Key, c.Plays)
+		}
+	}
+	return out
+}
+
 func formatClients(clients []string) (out string) {
 	if len(clients) <= 0 {
 		out += fmt.Sprintf("No clients have been registered yet")
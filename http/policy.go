@@ -0,0 +1,43 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/restanrm/bell/policy"
+	"github.com/restanrm/bell/sound"
+	"github.com/sirupsen/logrus"
+)
+
+// policyTags returns the tags deciding the policy of a sound. A name that
+// isn't a sound is a tag.
+func policyTags(vault sound.Sounder, name string) []string {
+	if s, ok := findSound(vault, name); ok {
+		return s.Tags
+	}
+	return []string{name}
+}
+
+// decide consults the policy before a playback on the destination. A denied
+// playback is reported to the client with a 423 status.
+func decide(w http.ResponseWriter, pol *policy.Policy, destination string, tags []string) (policy.Decision, bool) {
+	d := pol.Decide(destination, tags, time.Now())
+	if !d.Allowed {
+		logrus.WithFields(logrus.Fields{
+			"destination": d.Destination,
+			"reason":      d.Reason,
+		}).Info("Playback denied by the policy")
+		writeDecision(w, d, http.StatusLocked)
+	}
+	return d, d.Allowed
+}
+
+// writeDecision reports the decision of the policy to the client
+func writeDecision(w http.ResponseWriter, d policy.Decision, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(d); err != nil {
+		logrus.WithError(err).Error("Failed to encode decision to json")
+	}
+}
@@ -0,0 +1,68 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/restanrm/bell/player"
+	"github.com/restanrm/bell/queue"
+	"github.com/sirupsen/logrus"
+)
+
+// ListQueue returns the item currently playing and the pending ones
+func ListQueue(q *queue.Queue) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Content-Type", "application/json")
+		err := json.NewEncoder(w).Encode(q.List())
+		if err != nil {
+			logrus.WithError(err).Errorf("Failed to return queue content")
+			return
+		}
+	}
+}
+
+// RemoveFromQueue removes an item from the queue. The item is interrupted if
+// it is currently playing.
+func RemoveFromQueue(q *queue.Queue) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := mux.Vars(r)["id"]
+		err := q.Remove(id)
+		switch err {
+		case nil:
+		case queue.ErrItemNotFound:
+			http.Error(w, err.Error(), http.StatusNotFound)
+		default:
+			logrus.WithError(err).WithField("id", id).Error("Failed to remove item from queue")
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
+
+// SkipQueue interrupts the sound currently playing
+func SkipQueue(q *queue.Queue) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := q.Skip()
+		switch err {
+		case nil:
+		case player.ErrNothingPlaying:
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			logrus.WithError(err).Error("Failed to skip current sound")
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
+
+// priority reads the priority query parameter of the request. It writes the
+// error to the client if the priority is not valid.
+func priority(w http.ResponseWriter, r *http.Request) (queue.Priority, bool) {
+	prio, err := queue.ParsePriority(r.URL.Query().Get("priority"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, err)
+		return prio, false
+	}
+	return prio, true
+}
@@ -0,0 +1,107 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/restanrm/bell/metrics"
+	"github.com/restanrm/bell/ratelimit"
+	"github.com/sirupsen/logrus"
+)
+
+// LimitKeys returns the caller and the sound of a request to rate limit. The
+// request isn't limited if ok is false.
+type LimitKeys func(r *http.Request) (caller, sound string, ok bool)
+
+// RateLimit rejects the requests exceeding the limits of l with a 429 status
+// and a Retry-After header. The label identifies the handler in the metrics.
+// The requests answered with an error status, like the plays denied by the
+// policy or of unknown sounds, or marked with notPlayed don't count in the
+// limits.
+func RateLimit(l *ratelimit.Limiter, label string, keys LimitKeys, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		who, sound, ok := keys(r)
+		if !ok {
+			h(w, r)
+			return
+		}
+		res, wait, err := l.Allow(who, sound)
+		if err != nil {
+			reason := ratelimit.Reason(err)
+			metrics.RateLimitRejections.WithLabelValues(label, reason).Inc()
+			logrus.WithFields(logrus.Fields{
+				"caller": who,
+				"sound":  sound,
+				"reason": reason,
+				"wait":   wait,
+			}).Warn("Request rejected by rate limit")
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			http.Error(w, fmt.Sprintf("%v, retry in %v", err, wait.Round(100*time.Millisecond)), http.StatusTooManyRequests)
+			return
+		}
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		h(sw, r.WithContext(context.WithValue(r.Context(), reservationKey{}, res)))
+		if sw.status >= http.StatusBadRequest {
+			res.Cancel()
+		}
+	}
+}
+
+type reservationKey struct{}
+
+// notPlayed gives back to the rate limits the play of a request that didn't
+// play anything, when its status doesn't tell it
+func notPlayed(r *http.Request) {
+	if res, ok := r.Context().Value(reservationKey{}).(*ratelimit.Reservation); ok {
+		res.Cancel()
+	}
+}
+
+// statusWriter records the status of a response
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// PlayLimitKeys limits the plays of sounds and tags
+func PlayLimitKeys(r *http.Request) (string, string, bool) {
+	return caller(r), mux.Vars(r)["sound"], true
+}
+
+// TtsLimitKeys limits the texts to speech. The text is limited like a sound.
+func TtsLimitKeys(r *http.Request) (string, string, bool) {
+	return caller(r), "tts:" + r.FormValue("text"), true
+}
+
+// SequenceLimitKeys limits the sequences. A sequence is limited like a sound.
+func SequenceLimitKeys(r *http.Request) (string, string, bool) {
+	return caller(r), "sequence:" + mux.Vars(r)["name"], true
+}
+
+// MattermostLimitKeys limits the play and say commands of mattermost per
+// mattermost user
+func MattermostLimitKeys(r *http.Request) (string, string, bool) {
+	who := "mattermost:" + r.FormValue("user_name")
+	arguments := strings.Fields(r.FormValue("text"))
+	if len(arguments) < 2 {
+		return "", "", false
+	}
+	switch arguments[0] {
+	case "play":
+		return who, arguments[len(arguments)-1], true
+	case "say":
+		return who, "tts:" + strings.Join(arguments[1:], " "), true
+	}
+	return "", "", false
+}
@@ -0,0 +1,188 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/restanrm/bell/history"
+	"github.com/restanrm/bell/job"
+	"github.com/restanrm/bell/policy"
+	"github.com/restanrm/bell/queue"
+	"github.com/restanrm/bell/schedule"
+	"github.com/restanrm/bell/sound"
+	"github.com/sirupsen/logrus"
+)
+
+// ListSchedules returns the schedules in the order they will run
+func ListSchedules(sch *schedule.Scheduler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Content-Type", "application/json")
+		err := json.NewEncoder(w).Encode(sch.List())
+		if err != nil {
+			logrus.WithError(err).Error("Failed to encode schedules to json")
+			return
+		}
+	}
+}
+
+// orphanedSchedules returns the IDs of the pending schedules which play the
+// sound name, directly or through a tag, and would play nothing without it
+func orphanedSchedules(sch *schedule.Scheduler, sounds []sound.Sound, name string) []string {
+	rest := make([]sound.Sound, 0, len(sounds))
+	for _, s := range sounds {
+		if s.Name != name {
+			rest = append(rest, s)
+		}
+	}
+	var ids []string
+	for _, sc := range sch.List() {
+		if sc.Sound == "" || sc.Next == nil {
+			continue
+		}
+		if sound.Exists(sounds, sc.Sound) && !sound.Exists(rest, sc.Sound) {
+			ids = append(ids, sc.ID)
+		}
+	}
+	return ids
+}
+
+// AddSchedule creates a schedule from the "cron" or "at" (RFC 3339) form
+// values, the "sound" or "text" to play, and the optional "destination" and
+// "priority"
+func AddSchedule(vault sound.Sounder, sch *schedule.Scheduler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s := schedule.Schedule{
+			Cron:        r.FormValue("cron"),
+			Sound:       r.FormValue("sound"),
+			Text:        r.FormValue("text"),
+			Destination: r.FormValue("destination"),
+			Priority:    r.FormValue("priority"),
+			Creator:     caller(r),
+		}
+		if at := r.FormValue("at"); at != "" {
+			t, err := time.Parse(time.RFC3339, at)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprintf(w, "Invalid time %q, it must be written as %v", at, time.RFC3339)
+				return
+			}
+			s.At = &t
+		}
+		if _, err := queue.ParsePriority(s.Priority); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, err)
+			return
+		}
+		if s.Sound != "" {
+			if !rxSound.MatchString(s.Sound) {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprintf(w, "Bad sound or tag name. It doesn't match the regex %q", rxSound.String())
+				return
+			}
+			if _, ok := findSound(vault, s.Sound); !ok && len(sound.SoundsWithTag(vault, s.Sound)) == 0 {
+				http.Error(w, fmt.Sprintf("No sound or tag named %v", s.Sound), http.StatusNotFound)
+				return
+			}
+		}
+		s, err := sch.Add(s)
+		switch errors.Cause(err) {
+		case nil:
+		case schedule.ErrInvalid:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		default:
+			logrus.WithError(err).Error("Failed to add schedule")
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		logrus.WithFields(logrus.Fields{
+			"id":      s.ID,
+			"creator": s.Creator,
+			"next":    s.Next,
+		}).Info("Schedule added")
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		if err := json.NewEncoder(w).Encode(s); err != nil {
+			logrus.WithError(err).Error("Failed to encode schedule to json")
+		}
+	}
+}
+
+// RemoveSchedule deletes a schedule
+func RemoveSchedule(sch *schedule.Scheduler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := mux.Vars(r)["id"]
+		err := sch.Remove(id)
+		switch err {
+		case nil:
+			logrus.WithField("id", id).Info("Schedule removed")
+		case schedule.ErrNotFound:
+			http.Error(w, err.Error(), http.StatusNotFound)
+		default:
+			logrus.WithError(err).WithField("id", id).Error("Failed to remove schedule")
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
+
+// ScheduleRunner returns the runner playing the schedules on the server or on
+// their destination. The policy is consulted before any playback, and the
+// playbacks are recorded in the history on behalf of the creator of the
+// schedule, and followed by jobs.
+func ScheduleRunner(vault sound.Sounder, q *queue.Queue, sender Sender, pol *policy.Policy, hist *history.History, jobs *job.Jobs) schedule.Runner {
+	t := newSayer()
+	play := func(s schedule.Schedule, ss sound.Sound, id string) error {
+		switch {
+		case s.Destination != "" && s.Sound != "":
+			return PlayOnClient(sender, s.Destination, ss, id)
+		case s.Destination != "":
+			return SayOnClient(sender, s.Destination, s.Text, id)
+		}
+		prio, err := queue.ParsePriority(s.Priority)
+		if err != nil {
+			return err
+		}
+		if s.Sound != "" {
+			return vault.PlaySound(ss.Name, q.JobPlayer(prio, id))
+		}
+		return t.Say(s.Text, q.JobPlayer(prio, id))
+	}
+	return func(s schedule.Schedule) error {
+		var tags []string
+		if s.Sound != "" {
+			tags = policyTags(vault, s.Sound)
+		}
+		e := history.Entry{Caller: s.Creator, Source: history.Schedule, Sound: s.Sound, Text: s.Text}
+		d := pol.Decide(s.Destination, tags, time.Now())
+		if !d.Allowed {
+			record(hist, e, d, nil)
+			return errors.Errorf("Not played on %v: %v", d.Destination, d.Reason)
+		}
+		logrus.WithFields(logrus.Fields{
+			"id":          s.ID,
+			"sound":       s.Sound,
+			"text":        s.Text,
+			"destination": s.Destination,
+		}).Info("Playing schedule")
+		var ss sound.Sound
+		if s.Sound != "" {
+			var err error
+			if ss, err = pickSound(vault, &e, s.Sound); err != nil {
+				record(hist, e, d, err)
+				return err
+			}
+		}
+		j := jobs.Create(job.Job{Sound: e.Sound, Tag: e.Tag, Text: s.Text, Destination: d.Destination})
+		e.Job = j.ID
+		record(hist, e, d, nil)
+		err := play(s, ss, j.ID)
+		if err != nil {
+			jobs.Finish(j.ID, err)
+		}
+		return err
+	}
+}
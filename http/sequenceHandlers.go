@@ -0,0 +1,179 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/restanrm/bell/history"
+	"github.com/restanrm/bell/job"
+	"github.com/restanrm/bell/policy"
+	"github.com/restanrm/bell/queue"
+	"github.com/restanrm/bell/sound"
+	"github.com/sirupsen/logrus"
+)
+
+// ListSequences returns the sequences of the library
+func ListSequences(vault sound.Sounder) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Content-Type", "application/json")
+		err := json.NewEncoder(w).Encode(vault.GetSequences())
+		if err != nil {
+			logrus.WithError(err).Error("Failed to encode sequences to json")
+			return
+		}
+	}
+}
+
+// GetSequence returns a sequence
+func GetSequence(vault sound.Sounder) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		seq, err := vault.GetSequence(mux.Vars(r)["name"])
+		if !sequenceFound(w, err) {
+			return
+		}
+		writeSequence(w, seq)
+	}
+}
+
+// SaveSequence creates or replaces a sequence with the steps of the "step"
+// form values. A step is the name of a sound or a tag, "say:" followed by a
+// text, or "pause:" followed by a duration.
+func SaveSequence(vault sound.Sounder) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		seq := sound.Sequence{Name: mux.Vars(r)["name"]}
+		r.ParseForm()
+		for _, v := range r.Form["step"] {
+			st, err := sound.ParseStep(v)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			seq.Steps = append(seq.Steps, st)
+		}
+		if err := seq.Validate(vault); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		err := vault.SaveSequence(seq)
+		if err != nil {
+			logrus.WithError(err).WithField("name", seq.Name).Error("Failed to save sequence")
+			http.Error(w, "Failed to save sequence", http.StatusInternalServerError)
+			return
+		}
+		writeSequence(w, seq)
+	}
+}
+
+// DeleteSequence removes a sequence
+func DeleteSequence(vault sound.Sounder) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sequenceFound(w, vault.DeleteSequence(mux.Vars(r)["name"]))
+	}
+}
+
+// SequencePlayer plays the steps of a sequence in order, on the server or on
+// the registered client given by the destination query parameter. On the
+// server, the sequence is played as a single item of the queue. The policy is
+// consulted with the tags of all the sounds of the sequence.
+func SequencePlayer(vault sound.Sounder, q *queue.Queue, sender Sender, pol *policy.Policy, hist *history.History, jobs *job.Jobs) http.HandlerFunc {
+	t := newSayer()
+	return func(w http.ResponseWriter, r *http.Request) {
+		seq, err := vault.GetSequence(mux.Vars(r)["name"])
+		if !sequenceFound(w, err) {
+			return
+		}
+		wait, ok := waitParam(w, r)
+		if !ok {
+			return
+		}
+		var tags []string
+		for _, st := range seq.Steps {
+			if st.Sound != "" {
+				tags = append(tags, policyTags(vault, st.Sound)...)
+			}
+		}
+		destination := r.URL.Query().Get("destination")
+		e := history.Entry{Caller: caller(r), Source: history.REST, Sequence: seq.Name}
+		d, ok := decide(w, pol, destination, tags)
+		if !ok {
+			record(hist, e, d, nil)
+			return
+		}
+		seq, err = seq.Resolve(vault)
+		if err != nil {
+			record(hist, e, d, err)
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, err)
+			return
+		}
+		prio := queue.Normal
+		if destination == "" {
+			if prio, ok = priority(w, r); !ok {
+				return
+			}
+		}
+		j := jobs.Create(job.Job{Sequence: seq.Name, Destination: d.Destination})
+		e.Job = j.ID
+		record(hist, e, d, nil)
+		if destination != "" {
+			logrus.WithFields(logrus.Fields{
+				"destination": destination,
+				"sequence":    seq.Name,
+			}).Infof("Sending sequence to registered client")
+			err = SequenceOnClient(sender, destination, seq, j.ID)
+			if err != nil {
+				jobs.Finish(j.ID, err)
+				logrus.WithError(err).Errorf("Failed to send request to client")
+				w.WriteHeader(http.StatusInternalServerError)
+				fmt.Fprintf(w, "Failed to send sequence to client")
+				return
+			}
+			writeJob(w, jobs, d, j, wait)
+			return
+		}
+		items := &queue.Sequence{Name: seq.Name, Job: j.ID}
+		for _, st := range seq.Steps {
+			switch {
+			case st.Sound != "":
+				err = vault.PlaySound(st.Sound, items)
+			case st.Text != "":
+				err = t.Say(st.Text, items)
+			default:
+				items.Pause(st.PauseDuration())
+			}
+			if err != nil {
+				jobs.Finish(j.ID, err)
+				logrus.WithError(err).WithField("step", st.String()).Error("Failed to prepare step of sequence")
+				w.WriteHeader(http.StatusInternalServerError)
+				fmt.Fprintf(w, "Failed to prepare step %q of the sequence", st.String())
+				return
+			}
+		}
+		q.PushSequence(items, prio)
+		writeJob(w, jobs, d, j, wait)
+	}
+}
+
+// sequenceFound writes the error of a sequence lookup to the client. It
+// returns true if there was no error.
+func sequenceFound(w http.ResponseWriter, err error) bool {
+	switch err {
+	case nil:
+		return true
+	case sound.ErrSequenceNotFound:
+		http.Error(w, err.Error(), http.StatusNotFound)
+	default:
+		logrus.WithError(err).Error("Failed to retrieve sequence")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+	return false
+}
+
+func writeSequence(w http.ResponseWriter, seq sound.Sequence) {
+	w.Header().Add("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(seq); err != nil {
+		logrus.WithError(err).Error("Failed to encode sequence to json")
+	}
+}
@@ -3,16 +3,23 @@ package http
 import (
 	"encoding/json"
 	"fmt"
-	"io"
+	"math"
 	"net/http"
 	"os"
 	"path/filepath"
 	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/pkg/errors"
-	"github.com/restanrm/bell/player"
+	"github.com/restanrm/bell/audio"
+	"github.com/restanrm/bell/history"
+	"github.com/restanrm/bell/job"
+	"github.com/restanrm/bell/policy"
+	"github.com/restanrm/bell/queue"
+	"github.com/restanrm/bell/schedule"
 	"github.com/restanrm/bell/sound"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
@@ -37,44 +44,86 @@ func WebLogger(h http.Handler) http.Handler {
 	})
 }
 
-// SoundPlayer allow to play a sound from sounder service
-func SoundPlayer(vault sound.Sounder, sender Sender) http.HandlerFunc {
-	m := new(player.MpvPlayer)
+// SoundPlayer allow to play a sound from sounder service. Sounds played on
+// the server are pushed in the playback queue. The policy is consulted before
+// any playback and its decision is returned.
+func SoundPlayer(vault sound.Sounder, q *queue.Queue, sender Sender, pol *policy.Policy, hist *history.History, jobs *job.Jobs) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		vars := mux.Vars(r)
-		sound := vars["sound"]
+		name := vars["sound"]
 		// validate sound name to regex
-		if !rxSound.MatchString(sound) {
+		if !rxSound.MatchString(name) {
 			w.WriteHeader(http.StatusBadRequest)
-			logrus.WithFields(logrus.Fields{"soundname": sound}).Warn("Client made a request with wrong sound or tagname. It doesn't match the regexp")
+			logrus.WithFields(logrus.Fields{"soundname": name}).Warn("Client made a request with wrong sound or tagname. It doesn't match the regexp")
 			fmt.Fprintf(w, "Bad sound or tag name. It doesn't match the regex %q", rxSound.String())
 			return
 		}
-		var err error
-		if dest, ok := r.URL.Query()["destination"]; ok {
+		wait, ok := waitParam(w, r)
+		if !ok {
+			return
+		}
+		destination := r.URL.Query().Get("destination")
+		e := history.Entry{Caller: caller(r), Source: history.REST, Sound: name}
+		d, ok := decide(w, pol, destination, policyTags(vault, name))
+		if !ok {
+			record(hist, e, d, nil)
+			return
+		}
+		prio := queue.Normal
+		if destination == "" {
+			if prio, ok = priority(w, r); !ok {
+				return
+			}
+		}
+		s, err := pickSound(vault, &e, name)
+		if err != nil {
+			record(hist, e, d, err)
 			logrus.WithFields(logrus.Fields{
-				"destination": dest[0],
-				"sound":       sound,
+				"name": name,
+			}).Info("Sound or tag has not been found in store")
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		j := jobs.Create(job.Job{Sound: e.Sound, Tag: e.Tag, Destination: d.Destination})
+		e.Job = j.ID
+		record(hist, e, d, nil)
+		if destination != "" {
+			logrus.WithFields(logrus.Fields{
+				"destination": destination,
+				"sound":       s.Name,
 			}).Infof("Sending play order to registerd client")
-			PlayOnClient(sender, dest[0], sound)
+			err = PlayOnClient(sender, destination, s, j.ID)
+			if err != nil {
+				jobs.Finish(j.ID, err)
+				logrus.WithError(err).Errorf("Failed to send request to client")
+				w.WriteHeader(http.StatusInternalServerError)
+				fmt.Fprintf(w, "Failed to send play order to client")
+				return
+			}
 		} else {
-			err = vault.PlaySound(sound, m)
+			err = vault.PlaySound(s.Name, q.JobPlayer(prio, j.ID))
 			if err != nil {
+				jobs.Finish(j.ID, err)
 				w.WriteHeader(http.StatusNotFound)
 				logrus.WithFields(logrus.Fields{
-					"name": sound,
-				}).Info("Sound or tag has not been found in store")
+					"name": s.Name,
+				}).Info("Sound has not been found in store")
 				return
 			}
 		}
+		writeJob(w, jobs, d, j, wait)
 	}
 }
 
-// AddNewSound to Sounder service
-func AddSound(vault sound.Sounder) http.HandlerFunc {
+// AddSound adds a new sound to Sounder service. The uploaded content must be
+// a supported audio format within the limits of the library, it is processed
+// by up before being added.
+func AddSound(vault sound.Sounder, up *Uploads) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// this function add new sound file on sound dir path
-		r.ParseMultipartForm(int64(1 * 1024 * 1024))
+		if !up.parseForm(w, r) {
+			return
+		}
 		soundName := r.FormValue("name")
 		if soundName == "" {
 			w.WriteHeader(http.StatusBadRequest)
@@ -100,6 +149,7 @@ func AddSound(vault sound.Sounder) http.HandlerFunc {
 		for _, t := range soundTags {
 			if !rxSound.MatchString(t) {
 				logrus.WithFields(logrus.Fields{"tag": t}).Warn("Client made a request with wrong tag name. It doesn't match the regexp")
+				w.WriteHeader(http.StatusBadRequest)
 				fmt.Fprintf(w, "Bad tag name. It doesn't match the regex %q", rxSound.String())
 				return
 			}
@@ -116,29 +166,36 @@ func AddSound(vault sound.Sounder) http.HandlerFunc {
 		}
 		defer file.Close()
 
-		soundFilepath := filepath.Join(viper.GetString("soundDir"), fmt.Sprintf("%v.mp3", soundName))
-		err = dirExist(soundFilepath)
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			logrus.WithError(err).Errorf("Directory to store sound doesn't exist")
-			return
+		// an existing sound is overwritten, its tags are kept unless new ones
+		// are given
+		s, exists := findSound(vault, soundName)
+		s.Name, s.FilePath = soundName, ""
+		if !exists || len(soundTags) > 0 {
+			s.Tags = soundTags
 		}
-		f, err := os.OpenFile(soundFilepath, os.O_WRONLY|os.O_CREATE, 0666)
-		if err != nil {
-			logrus.WithFields(logrus.Fields{
-				"error": err,
-			}).Error("Failed to open file to save new sound")
-			w.WriteHeader(http.StatusInternalServerError)
+		fp, ok := up.save(w, r, vault, file, &s)
+		if !ok {
 			return
 		}
-		defer f.Close()
-		io.Copy(f, file)
-
-		err = vault.CreateSound(soundName, soundFilepath, soundTags...)
+		if exists {
+			err = vault.ReplaceSound(soundName, fp)
+		} else {
+			soundFilepath := filepath.Join(viper.GetString("soundDir"), soundName+filepath.Ext(fp))
+			err = os.Rename(fp, soundFilepath)
+			if err == nil {
+				err = vault.CreateSound(soundName, soundFilepath, soundTags...)
+			}
+		}
+		if err == nil {
+			err = vault.UpdateSound(s)
+		}
 		if err != nil {
+			os.Remove(fp)
 			logrus.WithFields(logrus.Fields{
 				"error": err,
 			}).Error("Failed to add new sound")
+			http.Error(w, "Failed to add new sound", http.StatusInternalServerError)
+			return
 		}
 	}
 }
@@ -161,7 +218,7 @@ func dirExist(filename string) error {
 }
 
 // DeleteSound allows to delete sound from library
-func DeleteSound(vault sound.Sounder) http.HandlerFunc {
+func DeleteSound(vault sound.Sounder, sch *schedule.Scheduler) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		vars := mux.Vars(r)
 		soundName := vars["sound"]
@@ -178,20 +235,74 @@ func DeleteSound(vault sound.Sounder) http.HandlerFunc {
 			fmt.Fprintf(w, "Bad sound name. It doesn't match the regex %q", rxSound.String())
 			return
 		}
+		if ids := orphanedSchedules(sch, vault.GetSounds(), soundName); len(ids) > 0 {
+			http.Error(w, fmt.Sprintf("The sound is played by the schedules %v, remove them first", strings.Join(ids, ", ")), http.StatusConflict)
+			return
+		}
 		err := vault.DeleteSound(soundName)
+		if err == sound.ErrSoundNotFound {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
 		if err != nil {
 			logrus.WithFields(logrus.Fields{
 				"error": err,
 			}).Error("Failed to remove sound from store")
+			http.Error(w, "Failed to remove sound from store", http.StatusInternalServerError)
 		}
 	}
 }
 
-// ListSounds function
+// RestoreSound puts back in the library a sound from the trash
+func RestoreSound(vault sound.Sounder) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		soundName := mux.Vars(r)["sound"]
+		// validate sound name to regex
+		if !rxSound.MatchString(soundName) {
+			w.WriteHeader(http.StatusBadRequest)
+			logrus.WithFields(logrus.Fields{"soundname": soundName}).Warn("Client made a request with wrong input file name. It doesn't match the regexp")
+			fmt.Fprintf(w, "Bad sound name. It doesn't match the regex %q", rxSound.String())
+			return
+		}
+		err := vault.RestoreSound(soundName)
+		switch err {
+		case nil:
+		case sound.ErrSoundNotFound:
+			http.Error(w, "Sound not found in trash", http.StatusNotFound)
+		case sound.ErrSoundAlreadyExist:
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			logrus.WithFields(logrus.Fields{
+				"error": err,
+				"name":  soundName,
+			}).Error("Failed to restore sound from trash")
+			http.Error(w, "Failed to restore sound from trash", http.StatusInternalServerError)
+		}
+	}
+}
+
+// ListDeletedSounds lists the sounds of the trash that can be restored
+func ListDeletedSounds(vault sound.Sounder) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Content-Type", "application/json")
+		err := json.NewEncoder(w).Encode(vault.GetDeletedSounds())
+		if err != nil {
+			logrus.WithError(err).Error("Failed to encode deleted sounds to json")
+			return
+		}
+	}
+}
+
+// ListSounds returns the sounds of the library, sorted by the "sort" query
+// parameter
 func ListSounds(vault sound.Sounder) http.HandlerFunc {
 	// this function list all currently available sounds
 	return func(w http.ResponseWriter, r *http.Request) {
 		sounds := vault.GetSounds()
+		if err := sound.Sort(sounds, r.URL.Query().Get("sort")); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		w.Header().Add("Content-Type", "application/json")
 
 		b, err := json.Marshal(sounds)
@@ -240,7 +351,8 @@ func GetSound(vault sound.Sounder) http.HandlerFunc {
 			http.Error(w, "Failed to find the requested file", http.StatusNotFound)
 			return
 		}
-		w.Header().Add("ContentType", "audio/mpeg3")
+		format, _ := audio.Detect(content)
+		w.Header().Set("Content-Type", format.MIMEType())
 		_, err = w.Write(content)
 		if err != nil {
 			logrus.WithField("err", err).Error("Couldn' write file content the responseWriter")
@@ -250,3 +362,193 @@ func GetSound(vault sound.Sounder) http.HandlerFunc {
 }
 
 // part for TextToSpeech
+
+// PatchSound allows to edit a sound of the library. The form values
+// "addTag" and "removeTag" edit the tags of the sound, "uploadFile" replaces
+// its audio content and "rename" changes its name. The updated sound is
+// returned. The schedules playing the sound follow its rename.
+func PatchSound(vault sound.Sounder, up *Uploads, sch *schedule.Scheduler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		soundName := mux.Vars(r)["sound"]
+		// validate sound name to regex
+		if !rxSound.MatchString(soundName) {
+			w.WriteHeader(http.StatusBadRequest)
+			logrus.WithFields(logrus.Fields{"soundname": soundName}).Warn("Client made a request with wrong input file name. It doesn't match the regexp")
+			fmt.Fprintf(w, "Bad sound name. It doesn't match the regex %q", rxSound.String())
+			return
+		}
+		if !up.parseForm(w, r) {
+			return
+		}
+
+		s, ok := findSound(vault, soundName)
+		if !ok {
+			http.Error(w, sound.ErrSoundNotFound.Error(), http.StatusNotFound)
+			return
+		}
+
+		// validate every input before changing anything
+		newName := r.Form.Get("rename")
+		if newName != "" && !rxSound.MatchString(newName) {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "Bad sound name. It doesn't match the regex %q", rxSound.String())
+			return
+		}
+		addTags, removeTags := r.Form["addTag"], r.Form["removeTag"]
+		for _, t := range append(append([]string{}, addTags...), removeTags...) {
+			if !rxSound.MatchString(t) {
+				logrus.WithFields(logrus.Fields{"tag": t}).Warn("Client made a request with wrong tag name. It doesn't match the regexp")
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprintf(w, "Bad tag name. It doesn't match the regex %q", rxSound.String())
+				return
+			}
+		}
+
+		volume, setVolume, err := parseVolume(r.Form["volume"])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		rename := newName != "" && newName != soundName
+		if _, exists := findSound(vault, newName); rename && exists {
+			http.Error(w, sound.ErrSoundAlreadyExist.Error(), http.StatusConflict)
+			return
+		}
+
+		edited := s
+		changed := setVolume || len(addTags) > 0 || len(removeTags) > 0
+		edited.Tags = editTags(s.Tags, addTags, removeTags)
+		if setVolume {
+			edited.Volume = volume
+		}
+
+		var fp string
+		file, _, err := r.FormFile("uploadFile")
+		switch err {
+		case nil:
+			defer file.Close()
+			if fp, ok = up.save(w, r, vault, file, &edited); !ok {
+				return
+			}
+			changed = true
+		case http.ErrMissingFile, http.ErrNotMultipart:
+		default:
+			http.Error(w, "Failed to read \"uploadFile\" field", http.StatusBadRequest)
+			return
+		}
+
+		// the changes are applied once every input is valid, the rename
+		// first as it may still conflict. They are undone if one of them
+		// fails, so the edition is applied entirely or not at all.
+		var undo []func() error
+		fail := func(msg string, err error) {
+			if fp != "" {
+				os.Remove(fp)
+			}
+			for i := len(undo) - 1; i >= 0; i-- {
+				if uerr := undo[i](); uerr != nil {
+					logrus.WithError(uerr).WithField("name", soundName).Error("Failed to undo the edition of the sound")
+				}
+			}
+			logrus.WithError(err).WithField("name", soundName).Error(msg)
+			status := http.StatusInternalServerError
+			if err == sound.ErrSoundAlreadyExist {
+				status = http.StatusConflict
+				msg = err.Error()
+			}
+			http.Error(w, msg, status)
+		}
+
+		name := soundName
+		if rename {
+			if err = vault.RenameSound(soundName, newName); err != nil {
+				fail("Failed to rename the sound", err)
+				return
+			}
+			name = newName
+			undo = append(undo, func() error { return vault.RenameSound(newName, soundName) })
+			if _, err = sch.RenameSound(soundName, newName); err != nil {
+				fail("Failed to rename the sound in the schedules", err)
+				return
+			}
+			undo = append(undo, func() error {
+				_, err := sch.RenameSound(newName, soundName)
+				return err
+			})
+		}
+		if changed {
+			// the file of the sound may have been renamed
+			edited.Name, edited.FilePath = name, ""
+			if err = vault.UpdateSound(edited); err != nil {
+				fail("Failed to update the sound", err)
+				return
+			}
+			original := s
+			original.Name, original.FilePath = name, ""
+			undo = append(undo, func() error { return vault.UpdateSound(original) })
+		}
+		if fp != "" {
+			if err = vault.ReplaceSound(name, fp); err != nil {
+				fail("Failed to replace the sound file", err)
+				return
+			}
+		}
+		soundName = name
+
+		s, _ = findSound(vault, soundName)
+		w.Header().Add("Content-Type", "application/json")
+		if err = json.NewEncoder(w).Encode(s); err != nil {
+			logrus.WithError(err).Error("Failed to encode sound to json")
+		}
+	}
+}
+
+// findSound returns the sound with the given name, tags are not considered
+func findSound(vault sound.Sounder, name string) (sound.Sound, bool) {
+	for _, s := range vault.GetSounds() {
+		if s.Name == name {
+			return s, true
+		}
+	}
+	return sound.Sound{}, false
+}
+
+// editTags returns tags with the tags of add and without the tags of remove
+func editTags(tags, add, remove []string) []string {
+	var out []string
+	seen := make(map[string]bool)
+	for _, t := range append(append([]string{}, tags...), add...) {
+		if seen[t] {
+			continue
+		}
+		seen[t] = true
+		out = append(out, t)
+	}
+	for _, t := range remove {
+		for i, o := range out {
+			if o == t {
+				out = append(out[:i], out[i+1:]...)
+				break
+			}
+		}
+	}
+	return out
+}
+
+// parseVolume parses the volume field of a sound edition. The volume is a
+// gain in dB, or "auto" to use the loudness normalization. The boolean is
+// false if the field isn't set.
+func parseVolume(values []string) (*float64, bool, error) {
+	if len(values) == 0 {
+		return nil, false, nil
+	}
+	if values[0] == "auto" {
+		return nil, true, nil
+	}
+	v, err := strconv.ParseFloat(values[0], 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+		return nil, false, errors.Errorf("Bad volume %q. It must be a gain in dB or \"auto\"", values[0])
+	}
+	return &v, true, nil
+}
@@ -0,0 +1,63 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/restanrm/bell/history"
+	"github.com/restanrm/bell/sound"
+	"github.com/sirupsen/logrus"
+)
+
+const defaultStatsTop = 10
+
+// GetStats returns the statistics of the played sounds, tags, sequences and
+// texts, by hour, day, destination and caller. They are computed from the
+// history filtered by the query parameters of ListHistory. The rankings keep
+// the top most played keys, 10 by default and all of them with 0.
+func GetStats(vault sound.Sounder, hist *history.History) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		f, ok := historyFilter(w, r)
+		if !ok {
+			return
+		}
+		top := defaultStatsTop
+		if s := r.URL.Query().Get("top"); s != "" {
+			var err error
+			if top, err = strconv.Atoi(s); err != nil || top < 0 {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprintf(w, "Invalid top %q", s)
+				return
+			}
+		}
+		w.Header().Add("Content-Type", "application/json")
+		err := json.NewEncoder(w).Encode(hist.Stats(f, top, tagsOf(vault)))
+		if err != nil {
+			logrus.WithError(err).Error("Failed to encode stats to json")
+		}
+	}
+}
+
+// tagsOf returns a function giving the current tags of a sound of the
+// library, or the tag itself for a tag. Removed sounds have no tags.
+func tagsOf(vault sound.Sounder) func(name string) []string {
+	sounds := make(map[string][]string)
+	tags := make(map[string]bool)
+	for _, s := range vault.GetSounds() {
+		sounds[s.Name] = s.Tags
+		for _, t := range s.Tags {
+			tags[t] = true
+		}
+	}
+	return func(name string) []string {
+		if t, ok := sounds[name]; ok {
+			return t
+		}
+		if tags[name] {
+			return []string{name}
+		}
+		return nil
+	}
+}
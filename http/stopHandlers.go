@@ -0,0 +1,151 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/restanrm/bell/api"
+	"github.com/restanrm/bell/connstore"
+	"github.com/restanrm/bell/job"
+	"github.com/restanrm/bell/player"
+	"github.com/restanrm/bell/policy"
+	"github.com/restanrm/bell/queue"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	// errJobFinished is returned when the job to stop is already finished
+	errJobFinished = errors.New("Job is already finished")
+	// errUnknownDestination is returned when the destination to stop isn't
+	// the server or a registered client
+	errUnknownDestination = errors.New("Destination isn't the server or a registered client")
+)
+
+// StopPlayback interrupts the playbacks. With the job parameter, only
+// the playback of this job is stopped, or removed from the queue if it is
+// pending. With the destination one, the sounds playing on the server or on
+// the client are interrupted, and without them on every destination. Stopping
+// the server also empties its queue.
+func StopPlayback(q *queue.Queue, ls listSender, jobs *job.Jobs) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var stopped []string
+		var err error
+		if id := r.FormValue("job"); id != "" {
+			stopped, err = stopJob(q, ls, jobs, id)
+		} else {
+			stopped, err = stopDestinations(q, ls, r.FormValue("destination"))
+		}
+		switch errors.Cause(err) {
+		case nil:
+		case job.ErrNotFound, errUnknownDestination:
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		case errJobFinished, player.ErrNothingPlaying:
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		default:
+			logrus.WithError(err).Error("Failed to stop the playbacks")
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Add("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(api.StopResponse{Stopped: stopped})
+		if err != nil {
+			logrus.WithError(err).Errorf("Failed to return the stopped destinations")
+		}
+	}
+}
+
+// stopJob interrupts the playback of a job on its destination
+func stopJob(q *queue.Queue, s Sender, jobs *job.Jobs, id string) ([]string, error) {
+	j, err := jobs.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if j.Finished() {
+		return nil, errJobFinished
+	}
+	if j.Destination == policy.Server {
+		err = q.StopJob(id)
+		if err == queue.ErrItemNotFound {
+			// the job is finishing
+			return nil, errJobFinished
+		}
+	} else {
+		err = StopOnClient(s, j.Destination, id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return []string{j.Destination}, nil
+}
+
+// stopServer removes the pending sounds from the queue and interrupts the one
+// playing. It returns player.ErrNothingPlaying if the queue was empty.
+func stopServer(q *queue.Queue) error {
+	removed := q.Clear()
+	err := q.Skip()
+	if err == player.ErrNothingPlaying && removed > 0 {
+		return nil
+	}
+	return err
+}
+
+// stopDestinations interrupts the sounds playing on a destination, or on all
+// of them if empty. The sounds waiting in the queue of the server are removed.
+// Nothing playing on all the destinations isn't an error.
+func stopDestinations(q *queue.Queue, ls listSender, destination string) ([]string, error) {
+	clients := ls.List()
+	if destination != "" {
+		known := destination == policy.Server
+		for _, c := range clients {
+			known = known || c == destination
+		}
+		if !known {
+			return nil, errUnknownDestination
+		}
+		if destination == policy.Server {
+			return []string{destination}, stopServer(q)
+		}
+		return []string{destination}, StopOnClient(ls, destination, "")
+	}
+
+	stopped := []string{}
+	switch err := stopServer(q); err {
+	case nil:
+		stopped = append(stopped, policy.Server)
+	case player.ErrNothingPlaying:
+	default:
+		logrus.WithError(err).Warn("Failed to stop the sound playing on the server")
+	}
+	for _, c := range clients {
+		if err := StopOnClient(ls, c, ""); err != nil {
+			logrus.WithError(err).WithField("client", c).Warn("Failed to stop the client")
+			continue
+		}
+		stopped = append(stopped, c)
+	}
+	return stopped, nil
+}
+
+// StopOnClient interrupts the playback of a job on a client, or all its
+// playbacks if job is empty
+func StopOnClient(a Sender, client, id string) error {
+	err := a.Send(client, connstore.Stop, id, "")
+	if err != nil {
+		return errors.Wrap(err, "Failed to send stop order to client")
+	}
+	return nil
+}
+
+// formatStopped describes the destinations where the playbacks were
+// interrupted
+func formatStopped(stopped []string) string {
+	if len(stopped) == 0 {
+		return "Nothing is playing"
+	}
+	return fmt.Sprintf(":stop_button: Stopped on %v", strings.Join(stopped, ", "))
+}
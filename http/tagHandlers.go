@@ -0,0 +1,103 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/restanrm/bell/api"
+	"github.com/restanrm/bell/sound"
+	"github.com/sirupsen/logrus"
+)
+
+// ListTags returns the tags of the library with the number of sounds having
+// them
+func ListTags(vault sound.Sounder) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Content-Type", "application/json")
+		err := json.NewEncoder(w).Encode(sound.Tags(vault))
+		if err != nil {
+			logrus.WithError(err).Error("Failed to encode tags to json")
+			return
+		}
+	}
+}
+
+// ListTagSounds returns the sounds having a tag
+func ListTagSounds(vault sound.Sounder) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tag := mux.Vars(r)["tag"]
+		sounds := sound.SoundsWithTag(vault, tag)
+		if len(sounds) == 0 {
+			http.Error(w, sound.ErrNoTagMatch(tag).Error(), http.StatusNotFound)
+			return
+		}
+		w.Header().Add("Content-Type", "application/json")
+		err := json.NewEncoder(w).Encode(sounds)
+		if err != nil {
+			logrus.WithError(err).Error("Failed to encode sounds to json")
+			return
+		}
+	}
+}
+
+// AddTag adds a tag to the sounds given in the "sound" form values
+func AddTag(vault sound.Sounder) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tag := mux.Vars(r)["tag"]
+		r.ParseForm()
+		names := r.Form["sound"]
+		if len(names) == 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "Missing \"sound\" field")
+			return
+		}
+		n, err := sound.AddTag(vault, tag, names...)
+		writeTagsUpdate(w, n, err)
+	}
+}
+
+// RenameTag renames a tag on every sound having it. The new name is given in
+// the "name" form value.
+func RenameTag(vault sound.Sounder) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tag := mux.Vars(r)["tag"]
+		newTag := r.FormValue("name")
+		if !rxSound.MatchString(newTag) {
+			logrus.WithFields(logrus.Fields{"tag": newTag}).Warn("Client made a request with wrong tag name. It doesn't match the regexp")
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "Bad tag name. It doesn't match the regex %q", rxSound.String())
+			return
+		}
+		n, err := sound.RenameTag(vault, tag, newTag)
+		writeTagsUpdate(w, n, err)
+	}
+}
+
+// DeleteTag removes a tag from every sound having it
+func DeleteTag(vault sound.Sounder) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tag := mux.Vars(r)["tag"]
+		n, err := sound.DeleteTag(vault, tag)
+		writeTagsUpdate(w, n, err)
+	}
+}
+
+func writeTagsUpdate(w http.ResponseWriter, n int, err error) {
+	if errors.Cause(err) == sound.ErrSoundNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logrus.WithError(err).WithField("updated", n).Error("Failed to update tags")
+		http.Error(w, "Failed to update tags", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(api.TagsUpdate{Updated: n})
+	if err != nil {
+		logrus.WithError(err).Error("Failed to encode response to json")
+	}
+}
@@ -5,22 +5,32 @@ import (
 	"html/template"
 	"net/http"
 
-	"github.com/restanrm/bell/player"
+	"github.com/restanrm/bell/audio"
+	"github.com/restanrm/bell/history"
+	"github.com/restanrm/bell/job"
+	"github.com/restanrm/bell/policy"
+	"github.com/restanrm/bell/queue"
 	"github.com/restanrm/bell/tts"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 )
 
-// TtsPostHandler handle request to play tts
-func TtsPostHandler(sender Sender) http.HandlerFunc {
+// newSayer returns the text to speech service configured by the flite and
+// polly options
+func newSayer() tts.Sayer {
 	var t tts.Sayer
 	t = tts.NewTTS(
 		viper.GetBool("flite"),
 		viper.GetString("polly.accessKey"),
 		viper.GetString("polly.secretKey"),
 	)
-	t = tts.NewLoggingService(t)
-	var m = &player.MpvPlayer{}
+	return tts.NewLoggingService(t)
+}
+
+// TtsPostHandler handle request to play tts. The policy is consulted before
+// any playback and its decision is returned.
+func TtsPostHandler(q *queue.Queue, sender Sender, pol *policy.Policy, hist *history.History, jobs *job.Jobs) http.HandlerFunc {
+	t := newSayer()
 	return func(w http.ResponseWriter, r *http.Request) {
 		r.ParseForm()
 		texts, ok := r.PostForm["text"]
@@ -32,37 +42,56 @@ func TtsPostHandler(sender Sender) http.HandlerFunc {
 		if len(texts) >= 1 {
 			text = texts[0]
 		}
-		if dest, ok := r.URL.Query()["destination"]; ok {
+		wait, ok := waitParam(w, r)
+		if !ok {
+			return
+		}
+		destination := r.URL.Query().Get("destination")
+		e := history.Entry{Caller: caller(r), Source: history.REST, Text: text}
+		d, ok := decide(w, pol, destination, nil)
+		if !ok {
+			record(hist, e, d, nil)
+			return
+		}
+		prio := queue.Normal
+		if destination == "" {
+			if prio, ok = priority(w, r); !ok {
+				return
+			}
+		}
+		j := jobs.Create(job.Job{Text: text, Destination: d.Destination})
+		e.Job = j.ID
+		record(hist, e, d, nil)
+		if destination != "" {
 			logrus.WithFields(logrus.Fields{
-				"destination": dest[0],
+				"destination": destination,
 				"sound":       text,
 			}).Infof("Sending text to speech order to registered client")
-			err := SayOnClient(sender, dest[0], text)
+			err := SayOnClient(sender, destination, text, j.ID)
 			if err != nil {
+				jobs.Finish(j.ID, err)
 				logrus.WithError(err).Errorf("Failed to send request to client")
 				w.WriteHeader(http.StatusInternalServerError)
 				fmt.Fprintf(w, "Failed to send tts request to client")
+				return
 			}
 		} else {
-			err := t.Say(text, m)
+			err := t.Say(text, q.JobPlayer(prio, j.ID))
 			if err != nil {
+				jobs.Finish(j.ID, err)
 				logrus.WithError(err).Errorf("Failed to convert text to sound")
 				w.WriteHeader(http.StatusInternalServerError)
 				fmt.Fprintf(w, "Failed to convert text to sound")
+				return
 			}
 		}
+		writeJob(w, jobs, d, j, wait)
 	}
 }
 
 // TtsPostHandler handle request to play tts
 func TtsGetPostHandler() http.HandlerFunc {
-	var t tts.Sayer
-	t = tts.NewTTS(
-		viper.GetBool("flite"),
-		viper.GetString("polly.accessKey"),
-		viper.GetString("polly.secretKey"),
-	)
-	t = tts.NewLoggingService(t)
+	t := newSayer()
 	return func(w http.ResponseWriter, r *http.Request) {
 		r.ParseForm()
 		texts, ok := r.PostForm["text"]
@@ -81,7 +110,8 @@ func TtsGetPostHandler() http.HandlerFunc {
 			http.Error(w, "Failed to find the requested file", http.StatusNotFound)
 			return
 		}
-		w.Header().Add("ContentType", "audio/mpeg3")
+		format, _ := audio.Detect(content)
+		w.Header().Set("Content-Type", format.MIMEType())
 		_, err = w.Write(content)
 		if err != nil {
 			logrus.WithField("err", err).Error("Couldn' write file content the responseWriter")
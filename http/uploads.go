@@ -0,0 +1,190 @@
+package http
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/restanrm/bell/audio"
+	"github.com/restanrm/bell/auth"
+	"github.com/restanrm/bell/sound"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// Uploads processes the audio files uploaded to the sounds library
+type Uploads struct {
+	// Converter converts the uploads to the canonical format of the library
+	Converter *audio.Converter
+	// Meter measures the loudness of the uploads
+	Meter *audio.LoudnessMeter
+	// MaxSize is the maximum size in bytes of an upload request. There is no
+	// limit if it's 0.
+	MaxSize int64
+	// Limits restrict the sounds that can be added to the library
+	Limits sound.Limits
+	// Playable returns false for the formats the player can't play, whose
+	// uploads are refused. All the formats are accepted if it's nil.
+	Playable func(audio.Format) bool
+}
+
+// parseForm parses the multipart form of an upload request, limited to
+// MaxSize. Requests that are not multipart are accepted. On failure, the
+// error is written to the client.
+func (u *Uploads) parseForm(w http.ResponseWriter, r *http.Request) bool {
+	body := &countingBody{ReadCloser: r.Body}
+	if u.MaxSize > 0 {
+		if r.ContentLength > u.MaxSize {
+			u.tooLarge(w)
+			return false
+		}
+		body.ReadCloser = http.MaxBytesReader(w, r.Body, u.MaxSize)
+		r.Body = body
+	}
+	err := r.ParseMultipartForm(int64(1 * 1024 * 1024))
+	switch {
+	case err == nil, err == http.ErrNotMultipart:
+		return true
+	case u.MaxSize > 0 && body.n >= u.MaxSize:
+		// the body has been cut at the limit
+		u.tooLarge(w)
+	default:
+		http.Error(w, "Failed to parse form", http.StatusBadRequest)
+	}
+	return false
+}
+
+// countingBody counts the bytes read from a request body
+type countingBody struct {
+	io.ReadCloser
+	n int64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	return n, err
+}
+
+func (u *Uploads) tooLarge(w http.ResponseWriter) {
+	logrus.WithField("limit", u.MaxSize).Warn("Client uploaded a file larger than the limit")
+	http.Error(w, "Upload is larger than the limit of "+sound.FormatSize(u.MaxSize), http.StatusRequestEntityTooLarge)
+}
+
+// save checks that the uploaded content is a supported audio format, writes
+// it in a new file of the sound directory and converts it to the canonical
+// format. The file is analyzed in s and checked against the limits of the
+// library. It returns the path of the file. On failure, the error is written
+// to the client.
+func (u *Uploads) save(w http.ResponseWriter, r *http.Request, vault sound.Sounder, file io.Reader, s *sound.Sound) (string, bool) {
+	format, content, err := audio.DetectReader(file)
+	if err == audio.ErrUnknownFormat {
+		logrus.WithField("name", s.Name).Warn("Client uploaded content that isn't audio")
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		return "", false
+	}
+	if err != nil {
+		logrus.WithError(err).Error("Failed to read uploaded file")
+		http.Error(w, "Failed to read uploaded file", http.StatusBadRequest)
+		return "", false
+	}
+
+	fp, err := writeUpload(content, s.Name, format)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to save uploaded file")
+		http.Error(w, "Failed to save uploaded file", http.StatusInternalServerError)
+		return "", false
+	}
+	fp, format, err = u.Converter.Convert(fp, format)
+	if err != nil {
+		os.Remove(fp)
+		logrus.WithError(err).WithField("name", s.Name).Error("Failed to convert uploaded file")
+		http.Error(w, "Failed to convert uploaded file", http.StatusUnprocessableEntity)
+		return "", false
+	}
+	if u.Playable != nil && !u.Playable(format) {
+		os.Remove(fp)
+		logrus.WithFields(logrus.Fields{
+			"name":   s.Name,
+			"format": format,
+		}).Warn("Client uploaded a sound the player can't play")
+		http.Error(w, "The "+format.String()+" sounds can't be played by the server", http.StatusUnsupportedMediaType)
+		return "", false
+	}
+
+	u.analyze(s, fp, r)
+	err = u.Limits.Check(vault.GetSounds(), *s)
+	if err != nil {
+		os.Remove(fp)
+		logrus.WithError(err).WithFields(logrus.Fields{
+			"name":     s.Name,
+			"uploader": s.Uploader,
+		}).Warn("Uploaded sound exceeds the limits")
+		status := http.StatusRequestEntityTooLarge
+		switch errors.Cause(err) {
+		case sound.ErrTooLong, sound.ErrUnknownDuration:
+			status = http.StatusUnprocessableEntity
+		}
+		http.Error(w, err.Error(), status)
+		return "", false
+	}
+	return fp, true
+}
+
+// analyze describes an uploaded file in s. A sound that can't be analyzed is
+// played without normalization. The upload time and the uploader of a sound
+// already in the library are kept when its content is replaced.
+func (u *Uploads) analyze(s *sound.Sound, fp string, r *http.Request) {
+	uploadedAt, uploader := s.UploadedAt, s.Uploader
+	if uploadedAt == nil {
+		now := time.Now()
+		uploadedAt, uploader = &now, caller(r)
+	}
+	s.Loudness = nil
+	s.Properties = sound.Properties{UploadedAt: uploadedAt, Uploader: uploader}
+	if err := sound.Analyze(u.Meter, s, fp); err != nil {
+		logrus.WithError(err).WithField("name", s.Name).Warn("Failed to analyze the uploaded sound")
+	}
+}
+
+// caller returns who made the request: the authenticated caller, or the
+// address of the client when the caller is anonymous.
+func caller(r *http.Request) string {
+	if id, ok := auth.FromContext(r.Context()); ok && id.Name != "" {
+		return id.Name
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// writeUpload writes the uploaded content in a new file of the sound directory
+// and returns its path
+func writeUpload(file io.Reader, soundName string, format audio.Format) (string, error) {
+	soundDir := viper.GetString("soundDir")
+	err := dirExist(filepath.Join(soundDir, soundName))
+	if err != nil {
+		return "", errors.Wrapf(err, "Directory to store sound doesn't exist")
+	}
+	f, err := ioutil.TempFile(soundDir, soundName+"-*"+format.Ext())
+	if err != nil {
+		return "", errors.Wrapf(err, "Failed to create file to save sound")
+	}
+	defer f.Close()
+	_, err = io.Copy(f, file)
+	if err == nil {
+		err = f.Close()
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", errors.Wrapf(err, "Failed to write sound file")
+	}
+	return f.Name(), nil
+}
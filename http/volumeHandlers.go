@@ -0,0 +1,80 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/restanrm/bell/policy"
+	"github.com/restanrm/bell/volume"
+	"github.com/sirupsen/logrus"
+)
+
+// GetVolume returns the volume settings of the "destination" query
+// parameter, or of all the destinations that have some
+func GetVolume(controls *volume.Controls) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var out interface{} = controls.List()
+		if dest := r.URL.Query().Get("destination"); dest != "" {
+			out = controls.Get(dest)
+		}
+		w.Header().Add("Content-Type", "application/json")
+		err := json.NewEncoder(w).Encode(out)
+		if err != nil {
+			logrus.WithError(err).Error("Failed to encode volume to json")
+		}
+	}
+}
+
+// SetVolume changes the "volume" and the "muted" switch of the
+// "destination", the server if empty. The settings that aren't given are
+// kept.
+func SetVolume(controls *volume.Controls) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		dest := r.FormValue("destination")
+		if dest == "" {
+			dest = policy.Server
+		}
+		s := controls.Get(dest)
+		if v := r.FormValue("volume"); v != "" {
+			percent, err := strconv.Atoi(v)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprintf(w, "Invalid volume %q", v)
+				return
+			}
+			s.Volume = percent
+		}
+		if m := r.FormValue("muted"); m != "" {
+			muted, err := strconv.ParseBool(m)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprintf(w, "Invalid muted value %q, please use true or false", m)
+				return
+			}
+			s.Muted = muted
+		}
+		err := controls.Set(dest, s)
+		switch err {
+		case nil:
+		case volume.ErrInvalid:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		default:
+			logrus.WithError(err).WithField("destination", dest).Error("Failed to change the volume")
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		logrus.WithFields(logrus.Fields{
+			"destination": dest,
+			"volume":      s.Volume,
+			"muted":       s.Muted,
+			"caller":      caller(r),
+		}).Info("Volume changed")
+		w.Header().Add("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(s); err != nil {
+			logrus.WithError(err).Error("Failed to encode volume to json")
+		}
+	}
+}
@@ -6,7 +6,10 @@ import (
 
 	"github.com/gorilla/websocket"
 	"github.com/pkg/errors"
+	"github.com/restanrm/bell/api"
 	"github.com/restanrm/bell/connstore"
+	"github.com/restanrm/bell/sound"
+	"github.com/restanrm/bell/volume"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 )
@@ -46,34 +49,62 @@ func RegisterClients(registerer Registerer) http.HandlerFunc {
 	}
 }
 
+// Sender sends messages to the registered clients. The job, if not empty,
+// follows the playback of the message by the client.
 type Sender interface {
-	Send(string, connstore.MessageType, string) error
+	Send(dest string, t connstore.MessageType, data, job string) error
+	SendSound(dest, sound string, gain float64, job string) error
 }
 
-func PlayOnClient(a Sender, client, sound string) error {
-	err := a.Send(client, connstore.Sound, sound)
+// PlayOnClient sends a play order of the sound s to a client, with its gain
+func PlayOnClient(a Sender, client string, s sound.Sound, job string) error {
+	err := a.SendSound(client, s.Name, s.Gain(), job)
 	if err != nil {
 		return errors.Wrap(err, "Failed to send play order to client")
 	}
 	return nil
 }
 
-func SayOnClient(a Sender, client, text string) error {
-	err := a.Send(client, connstore.TTS, text)
+func SayOnClient(a Sender, client, text, job string) error {
+	err := a.Send(client, connstore.TTS, text, job)
 	if err != nil {
 		return errors.Wrap(err, "Failed to send text to speech request to client")
 	}
 	return nil
 }
 
-type ClientsList struct {
-	Clients []string `json:"clients"`
+// VolumeOnClient sends the volume settings to a client, which applies them to
+// the next sounds it plays
+func VolumeOnClient(a Sender, client string, s volume.Settings) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return errors.Wrap(err, "Failed to encode volume")
+	}
+	err = a.Send(client, connstore.Volume, string(data), "")
+	if err != nil {
+		return errors.Wrap(err, "Failed to send volume to client")
+	}
+	return nil
+}
+
+// SequenceOnClient sends the steps of a sequence to a client, which plays
+// them in order. The tags of the sequence must be resolved.
+func SequenceOnClient(a Sender, client string, seq sound.Sequence, job string) error {
+	data, err := json.Marshal(seq.Steps)
+	if err != nil {
+		return errors.Wrap(err, "Failed to encode sequence")
+	}
+	err = a.Send(client, connstore.Sequence, string(data), job)
+	if err != nil {
+		return errors.Wrap(err, "Failed to send sequence to client")
+	}
+	return nil
 }
 
 // List returns the clients list to the caller
 func ListClients(l Lister) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		cl := ClientsList{Clients: l.List()}
+		cl := api.ClientsList{Clients: l.List()}
 		err := json.NewEncoder(w).Encode(cl)
 		if err != nil {
 			logrus.WithError(err).Errorf("Failed to return clients list")
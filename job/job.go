@@ -0,0 +1,175 @@
+// Package job follows the playbacks from the request to the end of the
+// sound. A job is queued when it is accepted, playing when the server starts
+// playing it or the client receives it, then done or failed with the reason.
+package job
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/twinj/uuid"
+)
+
+// Status of the jobs
+const (
+	Queued  = "queued"
+	Playing = "playing"
+	Done    = "done"
+	Failed  = "failed"
+)
+
+// staleAfter is the delay after which an unfinished job is forgotten, like
+// the jobs of clients that don't report the end of their playbacks
+const staleAfter = 24 * time.Hour
+
+// ErrNotFound is returned when a job doesn't exist or has expired
+var ErrNotFound = errors.New("Job not found")
+
+// Job is the playback of a sound, a text or a sequence
+type Job struct {
+	ID    string `json:"id"`
+	Sound string `json:"sound,omitempty"`
+	// Tag is the tag played, Sound being the sound picked for it
+	Tag      string `json:"tag,omitempty"`
+	Text     string `json:"text,omitempty"`
+	Sequence string `json:"sequence,omitempty"`
+	// Destination is the client playing the job, "server" for the server
+	Destination string     `json:"destination"`
+	Status      string     `json:"status"`
+	Error       string     `json:"error,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+
+	// finished is closed when the job is done or failed
+	finished chan struct{}
+}
+
+// Finished returns true if the job is done or failed
+func (j Job) Finished() bool {
+	return j.Status == Done || j.Status == Failed
+}
+
+// Jobs keeps the jobs until retention after they are finished. The methods
+// of a nil Jobs, and the updates of the empty id, do nothing.
+type Jobs struct {
+	retention time.Duration
+	// onFinish is called with the jobs once they are finished
+	onFinish func(j Job, err error)
+
+	mu   sync.Mutex
+	jobs map[string]*Job
+}
+
+// New returns the jobs, kept retention after they are finished
+func New(retention time.Duration) *Jobs {
+	return &Jobs{
+		retention: retention,
+		jobs:      make(map[string]*Job),
+	}
+}
+
+// Create adds a queued job. Its ID and creation time are set.
+func (js *Jobs) Create(j Job) Job {
+	j.ID = uuid.NewV4().String()
+	j.Status = Queued
+	j.CreatedAt = time.Now()
+	j.finished = make(chan struct{})
+	if js == nil {
+		return j
+	}
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	js.prune(j.CreatedAt)
+	js.jobs[j.ID] = &j
+	return j
+}
+
+// OnFinish sets the function called with each job once it is finished, and
+// the error it failed with. It must be set before the jobs are used.
+func (js *Jobs) OnFinish(fn func(j Job, err error)) {
+	js.onFinish = fn
+}
+
+// Start marks a job as playing
+func (js *Jobs) Start(id string) {
+	js.update(id, func(j *Job, now time.Time) {
+		if j.Status == Queued {
+			j.Status = Playing
+			j.StartedAt = &now
+		}
+	})
+}
+
+// Finish marks a job as done, or failed if err is not nil. A finished job is
+// not updated anymore.
+func (js *Jobs) Finish(id string, err error) {
+	var finished *Job
+	js.update(id, func(j *Job, now time.Time) {
+		if j.Finished() {
+			return
+		}
+		j.Status = Done
+		if err != nil {
+			j.Status = Failed
+			j.Error = err.Error()
+		}
+		j.FinishedAt = &now
+		close(j.finished)
+		f := *j
+		finished = &f
+	})
+	if finished != nil && js.onFinish != nil {
+		js.onFinish(*finished, err)
+	}
+}
+
+// Get returns a job
+func (js *Jobs) Get(id string) (Job, error) {
+	if js == nil {
+		return Job{}, ErrNotFound
+	}
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	j, ok := js.jobs[id]
+	if !ok {
+		return Job{}, ErrNotFound
+	}
+	return *j, nil
+}
+
+// Wait returns a job once it is finished, or after timeout if it isn't
+func (js *Jobs) Wait(id string, timeout time.Duration) (Job, error) {
+	j, err := js.Get(id)
+	if err != nil || j.Finished() {
+		return j, err
+	}
+	select {
+	case <-j.finished:
+	case <-time.After(timeout):
+	}
+	return js.Get(id)
+}
+
+func (js *Jobs) update(id string, fn func(j *Job, now time.Time)) {
+	if js == nil || id == "" {
+		return
+	}
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	if j, ok := js.jobs[id]; ok {
+		fn(j, time.Now())
+	}
+}
+
+// prune removes the jobs finished for longer than the retention, and the
+// stale ones. Caller must hold the lock.
+func (js *Jobs) prune(now time.Time) {
+	for id, j := range js.jobs {
+		finished := j.FinishedAt != nil && now.Sub(*j.FinishedAt) > js.retention
+		if finished || now.Sub(j.CreatedAt) > staleAfter {
+			delete(js.jobs, id)
+		}
+	}
+}
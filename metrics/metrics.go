@@ -21,11 +21,155 @@ var (
 		},
 		[]string{"handler", "method"},
 	)
+
+	// RateLimitRejections count the requests rejected by the rate limits
+	RateLimitRejections = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "bell_ratelimit_rejections_total",
+			Help: "Count the requests rejected by the rate limits",
+		},
+		[]string{"handler", "reason"},
+	)
+
+	// SoundPlays count the sounds played by sound or tag and destination
+	SoundPlays = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "bell_sound_plays_total",
+			Help: "Count the sounds played by sound or tag and destination",
+		},
+		[]string{"sound", "destination"},
+	)
+
+	// WebsocketClients is the number of registered websocket clients
+	WebsocketClients = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "bell_websocket_clients",
+			Help: "Number of registered websocket clients",
+		},
+	)
+
+	// WebsocketMessagesSent count the messages sent to the websocket clients
+	WebsocketMessagesSent = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "bell_websocket_messages_sent_total",
+			Help: "Count the messages sent to the websocket clients",
+		},
+		[]string{"client", "type"},
+	)
+
+	// WebsocketMessagesDropped count the messages that couldn't be sent to the
+	// websocket clients
+	WebsocketMessagesDropped = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "bell_websocket_messages_dropped_total",
+			Help: "Count the messages that couldn't be sent to the websocket clients",
+		},
+		[]string{"client", "type"},
+	)
+
+	// PlayerFailures count the sounds the player of the server failed to play
+	PlayerFailures = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "bell_player_failures_total",
+			Help: "Count the sounds the player of the server failed to play",
+		},
+		[]string{"player"},
+	)
+
+	// PlaybackDuration represent the duration of the sounds played by the
+	// server
+	PlaybackDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "bell_playback_duration_seconds",
+			Help:    "Measure the duration of the sounds played by the server",
+			Buckets: []float64{0.5, 1, 2, 5, 10, 20, 30, 60, 120},
+		},
+		[]string{"player"},
+	)
+
+	// PlayerPlays represent the duration of the plays going through the
+	// player middlewares, by result
+	PlayerPlays = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "bell_player_plays_seconds",
+			Help:    "Measure the duration of the plays of the server by result (ok or error)",
+			Buckets: []float64{0.5, 1, 2, 5, 10, 20, 30, 60, 120},
+		},
+		[]string{"result"},
+	)
+
+	// TTSCache count the texts to speech found in the cache or not
+	TTSCache = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "bell_tts_cache_total",
+			Help: "Count the texts to speech found in the cache (hit) or generated (miss)",
+		},
+		[]string{"result"},
+	)
+
+	// TTSGenerations count the texts to speech generated by engine and result
+	TTSGenerations = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "bell_tts_generations_total",
+			Help: "Count the texts to speech generated by engine (polly or flite) and result",
+		},
+		[]string{"engine", "result"},
+	)
+
+	// TTSPollyFallbacks count the texts to speech said with flite because
+	// polly failed
+	TTSPollyFallbacks = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "bell_tts_polly_fallbacks_total",
+			Help: "Count the texts to speech said with flite because polly failed",
+		},
+	)
 )
 
+var (
+	librarySoundsDesc = prometheus.NewDesc(
+		"bell_library_sounds",
+		"Number of sounds of the library",
+		nil, nil,
+	)
+	libraryBytesDesc = prometheus.NewDesc(
+		"bell_library_bytes",
+		"Size of the audio files of the library",
+		nil, nil,
+	)
+)
+
+// LibrarySize collects the number of sounds of the library and the size of
+// their audio files in bytes
+type LibrarySize func() (sounds int, bytes int64)
+
+// Describe implements prometheus.Collector
+func (l LibrarySize) Describe(ch chan<- *prometheus.Desc) {
+	ch <- librarySoundsDesc
+	ch <- libraryBytesDesc
+}
+
+// Collect implements prometheus.Collector
+func (l LibrarySize) Collect(ch chan<- prometheus.Metric) {
+	sounds, bytes := l()
+	ch <- prometheus.MustNewConstMetric(librarySoundsDesc, prometheus.GaugeValue, float64(sounds))
+	ch <- prometheus.MustNewConstMetric(libraryBytesDesc, prometheus.GaugeValue, float64(bytes))
+}
+
 func init() {
 	prometheus.MustRegister(
 		HTTPRequestDuration,
 		HTTPRequestsCount,
+		RateLimitRejections,
+		SoundPlays,
+		WebsocketClients,
+		WebsocketMessagesSent,
+		WebsocketMessagesDropped,
+		PlayerFailures,
+		PlaybackDuration,
+		PlayerPlays,
+		TTSCache,
+		TTSGenerations,
+		TTSPollyFallbacks,
 	)
 }
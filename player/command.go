@@ -0,0 +1,211 @@
+package player
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/restanrm/bell/metrics"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// Presets are the commands of the usual players. Only mpv and ffplay play
+// every supported format, aplay plays the wav files only.
+var Presets = map[string]Command{
+	"mpv": {
+		Binary: "mpv",
+		Args:   []string{"--audio-normalize-downmix=yes", "--af=lavfi=[volume={gain}dB]", "{file}"},
+	},
+	"ffplay": {
+		Binary: "ffplay",
+		Args:   []string{"-nodisp", "-autoexit", "-loglevel", "error", "-volume", "{volume}", "{file}"},
+	},
+	"aplay": {
+		Binary: "aplay",
+		Args:   []string{"-q", "{file}"},
+	},
+	"paplay": {
+		Binary: "paplay",
+		Args:   []string{"--volume={pavolume}", "{file}"},
+	},
+}
+
+// Command describes how a player command is run. The placeholders of the
+// arguments are replaced for each sound:
+//   - {file} by the path of the file, added as last argument if missing
+//   - {gain} by the gain in dB
+//   - {volume} by the volume in percent, 100 without gain
+//   - {pavolume} by the volume of paplay, 65536 without gain
+type Command struct {
+	Binary string
+	Args   []string
+	// Env are KEY=value variables added to the environment of the command
+	Env []string
+	// Timeout is the maximum duration of a sound, none if 0
+	Timeout time.Duration
+}
+
+// CommandFromViper returns the command configured by the viper keys under
+// prefix: type (a preset, or command), and command, args, env and timeout,
+// which override the ones of the preset.
+func CommandFromViper(prefix string) (Command, error) {
+	kind := viper.GetString(prefix + ".type")
+	c, ok := Presets[kind]
+	if !ok && kind != "command" {
+		return c, fmt.Errorf("Unknown player %q", kind)
+	}
+	if binary := viper.GetString(prefix + ".command"); binary != "" {
+		c.Binary = binary
+	}
+	if args := viper.GetStringSlice(prefix + ".args"); len(args) > 0 {
+		c.Args = args
+	}
+	c.Env = viper.GetStringSlice(prefix + ".env")
+	c.Timeout = viper.GetDuration(prefix + ".timeout")
+	if c.Binary == "" {
+		return c, errors.New("The command of the player is missing")
+	}
+	return c, nil
+}
+
+// Name is the name of the binary of the command
+func (c Command) Name() string {
+	return filepath.Base(c.Binary)
+}
+
+// args returns the arguments of the command playing fp with a gain in dB
+func (c Command) args(fp string, gain float64) []string {
+	scale := math.Pow(10, gain/20)
+	r := strings.NewReplacer(
+		"{file}", fp,
+		"{gain}", strconv.FormatFloat(gain, 'f', 2, 64),
+		"{volume}", strconv.Itoa(int(math.Round(100*scale))),
+		"{pavolume}", strconv.Itoa(int(math.Round(65536*scale))),
+	)
+	args := make([]string, 0, len(c.Args)+1)
+	file := false
+	for _, a := range c.Args {
+		file = file || strings.Contains(a, "{file}")
+		args = append(args, r.Replace(a))
+	}
+	if !file {
+		args = append(args, fp)
+	}
+	return args
+}
+
+// Run plays the file with a gain in dB. The command is killed when ctx is
+// done or after the timeout.
+func (c Command) Run(ctx context.Context, fp string, gain float64) error {
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+	var out bytes.Buffer
+	cmd := c.command(ctx, fp, gain, &out)
+	err := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return errors.Errorf("%v timed out after %v", c.Name(), c.Timeout)
+	}
+	if err != nil {
+		args := strings.Join(cmd.Args, " ")
+		if output := strings.TrimSpace(out.String()); output != "" {
+			return errors.Wrapf(err, "Failed to run the command %q, output %q", args, output)
+		}
+		return errors.Wrapf(err, "Failed to run the command %q", args)
+	}
+	return nil
+}
+
+func (c Command) command(ctx context.Context, fp string, gain float64, out *bytes.Buffer) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, c.Binary, c.args(fp, gain)...)
+	if len(c.Env) > 0 {
+		cmd.Env = append(os.Environ(), c.Env...)
+	}
+	cmd.Stdout = out
+	cmd.Stderr = out
+	return cmd
+}
+
+// CommandPlayer plays sounds with a command, like mpv. It keeps track of the
+// running process so it can be interrupted.
+type CommandPlayer struct {
+	command Command
+
+	mu sync.Mutex
+	// cancel kills the command currently running. The failure of a killed
+	// command is expected.
+	cancel context.CancelFunc
+}
+
+// NewCommandPlayer returns a player running c
+func NewCommandPlayer(c Command) *CommandPlayer {
+	return &CommandPlayer{command: c}
+}
+
+// Play plays a sound of the sound directory
+func (p *CommandPlayer) Play(path string) error {
+	return p.play(filepath.Join(viper.GetString("soundDir"), path), 0)
+}
+
+// PlayFilepath plays a file given a filepath
+func (p *CommandPlayer) PlayFilepath(fp string) error {
+	return p.play(fp, 0)
+}
+
+// PlayFilepathGain plays a file with a gain in dB
+func (p *CommandPlayer) PlayFilepathGain(fp string, gain float64) error {
+	return p.play(fp, gain)
+}
+
+// Stop kills the command currently running, if any
+func (p *CommandPlayer) Stop() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.cancel == nil {
+		return ErrNothingPlaying
+	}
+	p.cancel()
+	return nil
+}
+
+func (p *CommandPlayer) play(fp string, gain float64) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	p.mu.Lock()
+	p.cancel = cancel
+	p.mu.Unlock()
+
+	begin := time.Now()
+	err := p.command.Run(ctx, fp, gain)
+
+	p.mu.Lock()
+	stopped := ctx.Err() != nil
+	p.cancel = nil
+	p.mu.Unlock()
+	cancel()
+	if stopped {
+		return err
+	}
+	name := p.command.Name()
+	if err != nil {
+		metrics.PlayerFailures.WithLabelValues(name).Inc()
+		logrus.WithFields(logrus.Fields{
+			"error":    err,
+			"filepath": fp,
+		}).Error("Failed to read file")
+		return err
+	}
+	metrics.PlaybackDuration.WithLabelValues(name).Observe(time.Since(begin).Seconds())
+	return nil
+}
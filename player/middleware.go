@@ -0,0 +1,181 @@
+package player
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/restanrm/bell/metrics"
+	"github.com/restanrm/bell/volume"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+var (
+	// ErrMuted is returned by the plays refused by a muted player
+	ErrMuted = errors.New("Player is muted")
+)
+
+// Chain wraps p with the middlewares. The first middleware is the outermost
+// one: it sees the plays before the others.
+func Chain(p Player, mws ...Middleware) Player {
+	for i := len(mws) - 1; i >= 0; i-- {
+		p = mws[i](p)
+	}
+	return p
+}
+
+// playFunc plays the file fp with a gain in dB
+type playFunc func(fp string, gain float64) error
+
+// wrapped is the player returned by the middlewares. Every play goes through
+// play, with the function playing the file with the next player. The gain
+// is ignored if the next player doesn't support it, and it is stopped if it
+// can be.
+type wrapped struct {
+	next Player
+	play func(fp string, gain float64, next playFunc) error
+}
+
+func wrap(next Player, play func(fp string, gain float64, next playFunc) error) Player {
+	return &wrapped{next: next, play: play}
+}
+
+// Play plays a sound of the sound directory
+func (w *wrapped) Play(path string) error {
+	return w.PlayFilepathGain(filepath.Join(viper.GetString("soundDir"), path), 0)
+}
+
+// PlayFilepath plays a file given a filepath
+func (w *wrapped) PlayFilepath(fp string) error {
+	return w.PlayFilepathGain(fp, 0)
+}
+
+// PlayFilepathGain plays a file with a gain in dB
+func (w *wrapped) PlayFilepathGain(fp string, gain float64) error {
+	return w.play(fp, gain, func(fp string, gain float64) error {
+		return PlayWithGain(w.next, fp, gain)
+	})
+}
+
+// Stop interrupts the sound played by the next player
+func (w *wrapped) Stop() error {
+	s, ok := w.next.(Stopper)
+	if !ok {
+		return ErrNotStoppable
+	}
+	return s.Stop()
+}
+
+// Logging logs every sound played, with its duration and outcome
+func Logging(p Player) Player {
+	return wrap(p, func(fp string, gain float64, next playFunc) error {
+		begin := time.Now()
+		err := next(fp, gain)
+		log := logrus.WithFields(logrus.Fields{
+			"filepath": fp,
+			"gain":     gain,
+			"took":     time.Since(begin),
+		})
+		if err != nil {
+			log.WithError(err).Warn("Sound not played")
+			return err
+		}
+		log.Info("Sound played")
+		return nil
+	})
+}
+
+// Timing measures the duration of the plays in the bell_player_plays_seconds
+// metric
+func Timing(p Player) Player {
+	return wrap(p, func(fp string, gain float64, next playFunc) error {
+		begin := time.Now()
+		err := next(fp, gain)
+		result := "ok"
+		if err != nil {
+			result = "error"
+		}
+		metrics.PlayerPlays.WithLabelValues(result).Observe(time.Since(begin).Seconds())
+		return err
+	})
+}
+
+// Volume scales the sounds played to the percentage of the volume of the
+// destination in controls, read before each play. Nothing is played at 0%.
+func Volume(controls *volume.Controls, destination string) Middleware {
+	return func(p Player) Player {
+		return wrap(p, func(fp string, gain float64, next playFunc) error {
+			percent := controls.Get(destination).Volume
+			if percent == 0 {
+				return nil
+			}
+			return next(fp, gain+20*math.Log10(float64(percent)/100))
+		})
+	}
+}
+
+// Mute refuses the plays with ErrMuted while the destination is muted in
+// controls
+func Mute(controls *volume.Controls, destination string) Middleware {
+	return func(p Player) Player {
+		return wrap(p, func(fp string, gain float64, next playFunc) error {
+			if controls.Muted(destination) {
+				return ErrMuted
+			}
+			return next(fp, gain)
+		})
+	}
+}
+
+// DryRun records the sounds in w, as a json line each, instead of playing
+// them
+func DryRun(w io.Writer) Middleware {
+	var mu sync.Mutex
+	return func(p Player) Player {
+		return wrap(p, func(fp string, gain float64, next playFunc) error {
+			line, err := json.Marshal(struct {
+				Time     time.Time `json:"time"`
+				Filepath string    `json:"filepath"`
+				Gain     float64   `json:"gain"`
+			}{time.Now(), fp, gain})
+			if err != nil {
+				return err
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			_, err = w.Write(append(line, '\n'))
+			return err
+		})
+	}
+}
+
+// Middlewares returns the middlewares with the given names, in the same
+// order: logging, metrics, volume, mute or dry-run. The volume and mute ones
+// follow the settings of the destination in controls, and the dry-run one
+// writes to dryRun.
+func Middlewares(names []string, controls *volume.Controls, destination string, dryRun io.Writer) ([]Middleware, error) {
+	var mws []Middleware
+	for _, name := range names {
+		switch name {
+		case "logging":
+			mws = append(mws, Logging)
+		case "metrics":
+			mws = append(mws, Timing)
+		case "volume":
+			mws = append(mws, Volume(controls, destination))
+		case "mute":
+			mws = append(mws, Mute(controls, destination))
+		case "dry-run":
+			mws = append(mws, DryRun(dryRun))
+		default:
+			return nil, fmt.Errorf("Unknown player middleware %q, please use logging, metrics, volume, mute or dry-run", name)
+		}
+	}
+	return mws, nil
+}
@@ -0,0 +1,66 @@
+package player
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/restanrm/bell/volume"
+)
+
+// gainPlayer records the gains of the plays
+type gainPlayer struct {
+	gains []float64
+}
+
+func (g *gainPlayer) Play(path string) error { return g.PlayFilepathGain(path, 0) }
+
+func (g *gainPlayer) PlayFilepath(fp string) error { return g.PlayFilepathGain(fp, 0) }
+
+func (g *gainPlayer) PlayFilepathGain(fp string, gain float64) error {
+	g.gains = append(g.gains, gain)
+	return nil
+}
+
+func TestVolumeMuteMiddlewares(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	controls, err := volume.Load(filepath.Join(dir, "volume.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := new(gainPlayer)
+	mws, err := Middlewares([]string{"mute", "volume"}, controls, "server", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := Chain(next, mws...)
+
+	tests := []struct {
+		settings volume.Settings
+		err      error
+		gain     float64
+		played   bool
+	}{
+		{volume.Settings{Volume: 100}, nil, 0, true},
+		{volume.Settings{Volume: 50}, nil, 20 * math.Log10(0.5), true},
+		{volume.Settings{Volume: 0}, nil, 0, false},
+		{volume.Settings{Volume: 100, Muted: true}, ErrMuted, 0, false},
+	}
+	for _, tt := range tests {
+		if err := controls.Set("server", tt.settings); err != nil {
+			t.Fatal(err)
+		}
+		next.gains = nil
+		if err := p.PlayFilepath("ding.mp3"); err != tt.err {
+			t.Errorf("%+v: got error %v, want %v", tt.settings, err, tt.err)
+		}
+		if played := len(next.gains) == 1; played != tt.played {
+			t.Errorf("%+v: played is %v, want %v", tt.settings, played, tt.played)
+		}
+		if tt.played && math.Abs(next.gains[0]-tt.gain) > 1e-9 {
+			t.Errorf("%+v: gain %v, want %v", tt.settings, next.gains[0], tt.gain)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package player
+
+import (
+	"errors"
+	"io"
+	"math"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/restanrm/bell/audio"
+	"github.com/restanrm/bell/metrics"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// pcmChunk is the duration of the samples written at once to the sink. The
+// playbacks are interrupted between two chunks.
+const pcmChunk = 100 * time.Millisecond
+
+var (
+	// ErrStopped is returned by the playbacks interrupted by Stop
+	ErrStopped = errors.New("Playback stopped")
+)
+
+// PCMPlayer plays sounds without any external player: the mp3, ogg vorbis
+// and wav files are decoded in process and their samples are written to a
+// sink.
+type PCMPlayer struct {
+	sink Sink
+
+	mu     sync.Mutex
+	stream Stream
+	// stopped is the stream aborted by Stop
+	stopped Stream
+}
+
+// NewPCMPlayer returns a player writing the sounds to sink
+func NewPCMPlayer(sink Sink) *PCMPlayer {
+	return &PCMPlayer{sink: sink}
+}
+
+// Play plays a sound of the sound directory
+func (p *PCMPlayer) Play(path string) error {
+	return p.play(filepath.Join(viper.GetString("soundDir"), path), 0)
+}
+
+// PlayFilepath plays a file given a filepath
+func (p *PCMPlayer) PlayFilepath(fp string) error {
+	return p.play(fp, 0)
+}
+
+// PlayFilepathGain plays a file with a gain in dB
+func (p *PCMPlayer) PlayFilepathGain(fp string, gain float64) error {
+	return p.play(fp, gain)
+}
+
+// Stop interrupts the sound currently playing, if any
+func (p *PCMPlayer) Stop() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.stream == nil {
+		return ErrNothingPlaying
+	}
+	p.stopped = p.stream
+	return p.stream.Abort()
+}
+
+func (p *PCMPlayer) play(fp string, gain float64) error {
+	begin := time.Now()
+	err := p.write(fp, gain)
+	if err == ErrStopped {
+		return err
+	}
+	if err != nil {
+		metrics.PlayerFailures.WithLabelValues("pcm").Inc()
+		logrus.WithFields(logrus.Fields{
+			"error":    err,
+			"filepath": fp,
+		}).Error("Failed to play file")
+		return err
+	}
+	metrics.PlaybackDuration.WithLabelValues("pcm").Observe(time.Since(begin).Seconds())
+	return nil
+}
+
+// write decodes the file chunk by chunk and writes the samples to a stream
+// of the sink, until the end or an interruption
+func (p *PCMPlayer) write(fp string, gain float64) error {
+	d, err := audio.OpenFile(fp)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	stream, err := p.sink.Open(d.SampleRate(), d.Channels())
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	p.stream = stream
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		if p.stream == stream {
+			p.stream = nil
+		}
+		if p.stopped == stream {
+			p.stopped = nil
+		}
+		p.mu.Unlock()
+	}()
+
+	scale := math.Pow(10, gain/20)
+	chunk := int(pcmChunk.Seconds()*float64(d.SampleRate())) * d.Channels()
+	if chunk < d.Channels() {
+		chunk = d.Channels()
+	}
+	buf := make([]float64, chunk)
+	for !p.isStopped(stream) {
+		n, rerr := d.Read(buf)
+		if rerr != nil && rerr != io.EOF {
+			err = rerr
+			break
+		}
+		if gain != 0 {
+			for i := range buf[:n] {
+				buf[i] *= scale
+			}
+		}
+		if n > 0 {
+			if err = stream.Write(buf[:n]); err != nil {
+				break
+			}
+		}
+		if rerr == io.EOF {
+			break
+		}
+	}
+	if err != nil {
+		stream.Abort()
+		stream.Close()
+	} else {
+		err = stream.Close()
+	}
+	if p.isStopped(stream) {
+		return ErrStopped
+	}
+	return err
+}
+
+func (p *PCMPlayer) isStopped(s Stream) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.stopped == s
+}
@@ -0,0 +1,136 @@
+package player
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/restanrm/bell/audio"
+)
+
+// writeWAV writes a sine of the given duration in a wav file of dir
+func writeWAV(t *testing.T, dir string, rate, channels int, d time.Duration) (string, *audio.PCM) {
+	pcm := &audio.PCM{SampleRate: rate, Channels: channels}
+	for i := 0; i < int(d.Seconds()*float64(rate)); i++ {
+		v := 0.5 * math.Sin(2*math.Pi*440*float64(i)/float64(rate))
+		for ch := 0; ch < channels; ch++ {
+			pcm.Samples = append(pcm.Samples, v)
+		}
+	}
+	fp := filepath.Join(dir, "sine.wav")
+	f, err := os.Create(fp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := audio.EncodeWAV(f, pcm); err != nil {
+		t.Fatal(err)
+	}
+	return fp, pcm
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "bell-player")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestPCMPlayerFileSink(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	fp, in := writeWAV(t, dir, 8000, 2, 350*time.Millisecond)
+	out := filepath.Join(dir, "out.wav")
+	p := NewPCMPlayer(&FileSink{Path: out})
+
+	tests := []struct {
+		gain  float64
+		scale float64
+	}{
+		{0, 1},
+		{-6, math.Pow(10, -6.0/20)},
+	}
+	for _, tt := range tests {
+		if err := p.PlayFilepathGain(fp, tt.gain); err != nil {
+			t.Fatal(err)
+		}
+		played, err := audio.DecodeFile(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if played.SampleRate != in.SampleRate || played.Channels != in.Channels || len(played.Samples) != len(in.Samples) {
+			t.Fatalf("gain %v: played %d Hz %d channels %d samples, want %d Hz %d channels %d samples", tt.gain,
+				played.SampleRate, played.Channels, len(played.Samples), in.SampleRate, in.Channels, len(in.Samples))
+		}
+		for i, s := range in.Samples {
+			if d := played.Samples[i] - s*tt.scale; math.Abs(d) > 1e-3 {
+				t.Fatalf("gain %v: sample %d is %v, want %v", tt.gain, i, played.Samples[i], s*tt.scale)
+			}
+		}
+	}
+}
+
+func TestPCMPlayerNullSink(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	fp, _ := writeWAV(t, dir, 8000, 1, 300*time.Millisecond)
+
+	p := NewPCMPlayer(&NullSink{})
+	if err := p.PlayFilepath(fp); err != nil {
+		t.Fatal(err)
+	}
+
+	// a realtime playback takes the duration of the sound
+	p = NewPCMPlayer(&NullSink{Realtime: true})
+	begin := time.Now()
+	if err := p.PlayFilepath(fp); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(begin); d < 250*time.Millisecond {
+		t.Errorf("played in %v, want about 300ms", d)
+	}
+	if err := p.Stop(); err != ErrNothingPlaying {
+		t.Errorf("got error %v when stopping after the end, want %v", err, ErrNothingPlaying)
+	}
+}
+
+func TestPCMPlayerStop(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	fp, _ := writeWAV(t, dir, 8000, 1, 5*time.Second)
+
+	p := NewPCMPlayer(&NullSink{Realtime: true})
+	done := make(chan error)
+	go func() { done <- p.PlayFilepath(fp) }()
+	time.Sleep(150 * time.Millisecond)
+	if err := p.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-done:
+		if err != ErrStopped {
+			t.Errorf("got error %v, want %v", err, ErrStopped)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the playback wasn't stopped")
+	}
+}
+
+func TestPCMPlayerBadFile(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	fp := filepath.Join(dir, "bad.wav")
+	// a wav header of 5 Hz
+	header := []byte("RIFF\x24\x00\x00\x00WAVEfmt \x10\x00\x00\x00\x01\x00\x01\x00\x05\x00\x00\x00\x0a\x00\x00\x00\x02\x00\x10\x00data\x00\x00\x00\x00")
+	if err := ioutil.WriteFile(fp, header, 0644); err != nil {
+		t.Fatal(err)
+	}
+	p := NewPCMPlayer(&NullSink{Realtime: true})
+	if err := p.PlayFilepath(fp); err != audio.ErrBadStream {
+		t.Errorf("got error %v, want %v", err, audio.ErrBadStream)
+	}
+}
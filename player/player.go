@@ -1,17 +1,18 @@
 // Package player is the package that describe what a player is and
-// it propose an implementation of this interface with mpv player
+// it propose implementations of this interface running a command like mpv,
+// or decoding the sounds in process
 package player
 
 import (
-	"os/exec"
-	"path/filepath"
-
-	"github.com/sirupsen/logrus"
-	"github.com/spf13/viper"
+	"errors"
 )
 
-type MpvPlayer struct {
-}
+var (
+	// ErrNothingPlaying is returned when a stop is requested while nothing is played
+	ErrNothingPlaying = errors.New("Nothing is playing")
+	// ErrNotStoppable is returned when the player can't interrupt a sound
+	ErrNotStoppable = errors.New("Player can't interrupt the current sound")
+)
 
 // Middleware is the type that allows to chain Player objects
 type Middleware func(Player) Player
@@ -22,33 +23,22 @@ type Player interface {
 	PlayFilepath(string) error
 }
 
-// Play is the function used to play sounds
-// it concatenate the given path with the filepath of the application
-func (mp *MpvPlayer) Play(path string) error {
-	return mp.play(filepath.Join(viper.GetString("soundDir"), path))
+// GainPlayer is implemented by players able to apply a gain, in dB, to the
+// sound they play
+type GainPlayer interface {
+	PlayFilepathGain(fp string, gain float64) error
 }
 
-// PlayFilepath is a function to play a file given a filepath
-func (mp *MpvPlayer) PlayFilepath(fp string) error {
-	return mp.play(fp)
-}
-
-func (mp *MpvPlayer) play(fp string) error {
-	cmd := exec.Command(
-		"mpv",
-		"--audio-normalize-downmix=yes",
-		fp,
-	)
-
-	out, err := cmd.Output()
-	if err != nil {
-		logrus.WithFields(logrus.Fields{
-			"error":    err,
-			"output":   string(out),
-			"filepath": fp,
-		}).Error("Failed to read file")
-		return err
+// PlayWithGain plays the file with p. The gain is applied if p supports it.
+func PlayWithGain(p Player, fp string, gain float64) error {
+	if gp, ok := p.(GainPlayer); ok {
+		return gp.PlayFilepathGain(fp, gain)
 	}
-	return nil
+	return p.PlayFilepath(fp)
+}
 
+// Stopper is implemented by players that are able to interrupt the sound
+// they are currently playing.
+type Stopper interface {
+	Stop() error
 }
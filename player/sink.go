@@ -0,0 +1,242 @@
+package player
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/restanrm/bell/audio"
+)
+
+// Sink is an audio output receiving the decoded samples of the PCMPlayer
+type Sink interface {
+	// Open starts a stream of interleaved samples with the given rate and
+	// number of channels
+	Open(rate, channels int) (Stream, error)
+}
+
+// Stream is an opened audio output
+type Stream interface {
+	// Write plays the samples, scaled between -1 and 1. It may return
+	// before they are heard.
+	Write(samples []float64) error
+	// Close waits for the written samples to be played and releases the
+	// output
+	Close() error
+	// Abort interrupts the playback: the running and next calls to Write
+	// and Close return early. It may be called concurrently with them.
+	Abort() error
+}
+
+// NewSink returns the sink of the given kind: alsa and pulse play the
+// samples with the aplay and pacat commands on device, the default one if
+// empty. file writes the samples of the last played sound in the wav file at
+// device. null discards them at the pace of a sound card.
+func NewSink(kind, device string) (Sink, error) {
+	switch kind {
+	case "alsa":
+		return &CommandSink{Name: "aplay", Args: func(rate, channels int) []string {
+			args := []string{"-q", "-t", "raw", "-f", "S16_LE", "-r", strconv.Itoa(rate), "-c", strconv.Itoa(channels)}
+			if device != "" {
+				args = append(args, "-D", device)
+			}
+			return append(args, "-")
+		}}, nil
+	case "pulse":
+		return &CommandSink{Name: "pacat", Args: func(rate, channels int) []string {
+			args := []string{"--playback", "--raw", "--format=s16le", "--rate=" + strconv.Itoa(rate), "--channels=" + strconv.Itoa(channels)}
+			if device != "" {
+				args = append(args, "--device="+device)
+			}
+			return args
+		}}, nil
+	case "file":
+		if device == "" {
+			return nil, errors.New("The file sink needs the path of its wav file as device")
+		}
+		return &FileSink{Path: device}, nil
+	case "null":
+		return &NullSink{Realtime: true}, nil
+	}
+	return nil, fmt.Errorf("Unknown sink %q, please use alsa, pulse, file or null", kind)
+}
+
+// CommandSink pipes the samples as 16 bits little endian raw audio to the
+// standard input of a command, like aplay or pacat
+type CommandSink struct {
+	Name string
+	// Args returns the arguments of the command for the format of a stream
+	Args func(rate, channels int) []string
+}
+
+// Open starts the command
+func (c *CommandSink) Open(rate, channels int) (Stream, error) {
+	cmd := exec.Command(c.Name, c.Args(rate, channels)...)
+	in, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	out := new(lockedBuffer)
+	cmd.Stderr = out
+	if err := cmd.Start(); err != nil {
+		return nil, errors.Wrapf(err, "Failed to start %v", c.Name)
+	}
+	return &commandStream{cmd: cmd, in: in, out: out}, nil
+}
+
+type commandStream struct {
+	cmd *exec.Cmd
+	in  io.WriteCloser
+	out *lockedBuffer
+	buf []byte
+}
+
+func (s *commandStream) Write(samples []float64) error {
+	s.buf = appendInt16(s.buf[:0], samples)
+	if _, err := s.in.Write(s.buf); err != nil {
+		return errors.Wrapf(err, "Failed to write samples to %v: %v", s.cmd.Path, s.out.String())
+	}
+	return nil
+}
+
+func (s *commandStream) Close() error {
+	s.in.Close()
+	if err := s.cmd.Wait(); err != nil {
+		return errors.Wrapf(err, "%v failed: %v", s.cmd.Path, s.out.String())
+	}
+	return nil
+}
+
+func (s *commandStream) Abort() error {
+	return s.cmd.Process.Kill()
+}
+
+// lockedBuffer collects the output of a command
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf []byte
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buf = append(b.buf, p...)
+	return len(p), nil
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return string(b.buf)
+}
+
+// FileSink writes the samples of each stream in a 16 bits wav file at Path,
+// replacing the previous one. It is meant for tests.
+type FileSink struct {
+	Path string
+}
+
+// Open returns a stream written to the file when it is closed
+func (f *FileSink) Open(rate, channels int) (Stream, error) {
+	return &fileStream{path: f.Path, pcm: &audio.PCM{SampleRate: rate, Channels: channels}}, nil
+}
+
+type fileStream struct {
+	path string
+	pcm  *audio.PCM
+}
+
+func (s *fileStream) Write(samples []float64) error {
+	s.pcm.Samples = append(s.pcm.Samples, samples...)
+	return nil
+}
+
+func (s *fileStream) Close() error {
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), ".sink")
+	if err != nil {
+		return errors.Wrapf(err, "Failed to write %v", s.path)
+	}
+	defer os.Remove(tmp.Name())
+	if err := audio.EncodeWAV(tmp, s.pcm); err != nil {
+		tmp.Close()
+		return errors.Wrapf(err, "Failed to write %v", s.path)
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.Wrapf(err, "Failed to write %v", s.path)
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+// Abort does nothing, the samples written until the interruption are saved
+// by Close
+func (s *fileStream) Abort() error {
+	return nil
+}
+
+// NullSink discards the samples. With Realtime, writes take the duration of
+// the samples, like with a sound card.
+type NullSink struct {
+	Realtime bool
+}
+
+// Open returns a stream discarding the samples
+func (n *NullSink) Open(rate, channels int) (Stream, error) {
+	return &nullStream{
+		realtime: n.Realtime,
+		rate:     rate,
+		channels: channels,
+		aborted:  make(chan struct{}),
+	}, nil
+}
+
+type nullStream struct {
+	realtime       bool
+	rate, channels int
+	abort          sync.Once
+	aborted        chan struct{}
+}
+
+func (s *nullStream) Write(samples []float64) error {
+	if !s.realtime || s.rate == 0 || s.channels == 0 {
+		return nil
+	}
+	select {
+	case <-time.After(time.Duration(len(samples)/s.channels) * time.Second / time.Duration(s.rate)):
+	case <-s.aborted:
+	}
+	return nil
+}
+
+func (s *nullStream) Close() error { return nil }
+
+func (s *nullStream) Abort() error {
+	s.abort.Do(func() { close(s.aborted) })
+	return nil
+}
+
+// appendInt16 appends the samples to buf as 16 bits little endian integers
+func appendInt16(buf []byte, samples []float64) []byte {
+	var b [2]byte
+	for _, v := range samples {
+		switch {
+		case v > 1:
+			v = 1
+		case v < -1:
+			v = -1
+		}
+		binary.LittleEndian.PutUint16(b[:], uint16(int16(v*32767)))
+		buf = append(buf, b[:]...)
+	}
+	return buf
+}
@@ -0,0 +1,95 @@
+package policy
+
+import (
+	"bufio"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+)
+
+const dateLayout = "2006-01-02"
+
+// Config describes the policy
+type Config struct {
+	// Timezone of the quiet hours, the local one if empty
+	Timezone string
+	// Holidays is the path of the holidays file
+	Holidays string
+	// Overrides are the tags of the sounds played even during quiet hours.
+	// Default to "alert".
+	Overrides []string
+	// Default are the rules of the destinations without their own rules
+	Default Rules
+	// Destinations are the rules of each destination. The sounds played by
+	// the server itself go to the "server" destination.
+	Destinations map[string]Rules
+}
+
+// Rules describes when a destination must stay quiet
+type Rules struct {
+	Quiet []Window
+	// Holidays makes the destination quiet during the holidays
+	Holidays bool
+}
+
+// Window is a quiet period. It starts on each of the Days (the three first
+// letters of their english name, every day if empty) at From and ends at To,
+// written as "15:04". A window ending before it starts ends on the next day,
+// and a window without hours lasts the whole day.
+type Window struct {
+	Days []string
+	From string
+	To   string
+}
+
+// Load returns the policy configured by the file at fp. The file can be in
+// any format known by viper (yaml, json, toml...).
+func Load(fp string) (*Policy, error) {
+	v := viper.New()
+	v.SetConfigFile(fp)
+	err := v.ReadInConfig()
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to read policy file %v", fp)
+	}
+	var c Config
+	err = v.Unmarshal(&c)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to decode policy file %v", fp)
+	}
+	return New(c)
+}
+
+// LoadHolidays reads a holidays file. Each line is a date written as
+// 2006-01-02, optionally followed by the name of the holiday. Empty lines
+// and lines starting with # are ignored.
+func LoadHolidays(fp string) (map[string]string, error) {
+	f, err := os.Open(fp)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to open holidays file")
+	}
+	defer f.Close()
+	holidays := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.SplitN(line, " ", 2)
+		if _, err := time.Parse(dateLayout, fields[0]); err != nil {
+			return nil, errors.Errorf("Invalid date %q at line %d of holidays file", fields[0], n)
+		}
+		name := fields[0]
+		if len(fields) == 2 {
+			name = strings.TrimSpace(fields[1])
+		}
+		holidays[fields[0]] = name
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrapf(err, "Failed to read holidays file")
+	}
+	return holidays, nil
+}
@@ -0,0 +1,234 @@
+// Package policy decides whether a sound can be played, according to quiet
+// hours per destination, weekday calendars, holidays and muted destinations.
+package policy
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Server is the destination of the sounds played by the server itself
+const Server = "server"
+
+// Decision is the result of the policy for a playback
+type Decision struct {
+	Allowed     bool   `json:"allowed"`
+	Reason      string `json:"reason,omitempty"`
+	Destination string `json:"destination"`
+}
+
+// Policy decides whether a sound can be played. A nil Policy allows every
+// playback.
+type Policy struct {
+	loc          *time.Location
+	holidays     map[string]string
+	overrides    []string
+	defaults     rules
+	destinations map[string]rules
+	muter        Muter
+}
+
+// Muter tells whether a destination refuses the plays
+type Muter interface {
+	Muted(destination string) bool
+}
+
+type rules struct {
+	quiet    []window
+	holidays bool
+}
+
+// window is a quiet period. It starts on the given days, at from minutes
+// after midnight, and lasts until to minutes after midnight, possibly on the
+// next day.
+type window struct {
+	days     [7]bool
+	from, to int
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// parseClock parses a time of the day written as "15:04" in minutes after
+// midnight
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid time of the day %q, it must be written as 15:04", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func formatClock(m int) string {
+	return fmt.Sprintf("%02d:%02d", m/60, m%60)
+}
+
+func newWindow(c Window) (window, error) {
+	var w window
+	for _, d := range c.Days {
+		wd, ok := weekdays[strings.ToLower(d)[:min(3, len(d))]]
+		if !ok {
+			return w, fmt.Errorf("Unknown day %q", d)
+		}
+		w.days[wd] = true
+	}
+	if len(c.Days) == 0 {
+		w.days = [7]bool{true, true, true, true, true, true, true}
+	}
+	// a window without hours lasts the whole day
+	if c.From == "" && c.To == "" {
+		w.to = 24 * 60
+		return w, nil
+	}
+	var err error
+	if w.from, err = parseClock(c.From); err != nil {
+		return w, err
+	}
+	if w.to, err = parseClock(c.To); err != nil {
+		return w, err
+	}
+	return w, nil
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// contains returns true if the time of day minutes after midnight of the
+// given weekday is in the window
+func (w window) contains(day time.Weekday, minutes int) bool {
+	if w.from < w.to {
+		return w.days[day] && minutes >= w.from && minutes < w.to
+	}
+	// the window ends on the next day
+	yesterday := (day + 6) % 7
+	return (w.days[day] && minutes >= w.from) || (w.days[yesterday] && minutes < w.to)
+}
+
+func (w window) String() string {
+	var days []string
+	for _, d := range []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday, time.Saturday, time.Sunday} {
+		if w.days[d] {
+			days = append(days, d.String()[:3])
+		}
+	}
+	hours := "all day"
+	if w.from != 0 || w.to != 24*60 {
+		hours = formatClock(w.from) + "-" + formatClock(w.to)
+	}
+	if len(days) == 7 {
+		return hours
+	}
+	return strings.Join(days, ",") + " " + hours
+}
+
+// New returns the policy described by the configuration
+func New(c Config) (*Policy, error) {
+	p := &Policy{
+		loc:          time.Local,
+		holidays:     make(map[string]string),
+		overrides:    c.Overrides,
+		destinations: make(map[string]rules),
+	}
+	if c.Overrides == nil {
+		p.overrides = []string{"alert"}
+	}
+	if c.Timezone != "" {
+		loc, err := time.LoadLocation(c.Timezone)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Invalid timezone %v", c.Timezone)
+		}
+		p.loc = loc
+	}
+	if c.Holidays != "" {
+		h, err := LoadHolidays(c.Holidays)
+		if err != nil {
+			return nil, err
+		}
+		p.holidays = h
+	}
+	var err error
+	if p.defaults, err = newRules(c.Default); err != nil {
+		return nil, errors.Wrapf(err, "Invalid default rules")
+	}
+	for dest, r := range c.Destinations {
+		if p.destinations[dest], err = newRules(r); err != nil {
+			return nil, errors.Wrapf(err, "Invalid rules of destination %v", dest)
+		}
+	}
+	return p, nil
+}
+
+func newRules(c Rules) (rules, error) {
+	r := rules{holidays: c.Holidays}
+	for _, wc := range c.Quiet {
+		w, err := newWindow(wc)
+		if err != nil {
+			return r, err
+		}
+		r.quiet = append(r.quiet, w)
+	}
+	return r, nil
+}
+
+// SetMuter makes the policy deny the plays on the destinations muted by m,
+// whatever their tags
+func (p *Policy) SetMuter(m Muter) {
+	p.muter = m
+}
+
+// Decide returns whether a sound with the given tags can be played on the
+// destination at the given time. An empty destination is the server.
+func (p *Policy) Decide(destination string, tags []string, at time.Time) Decision {
+	if destination == "" {
+		destination = Server
+	}
+	d := Decision{Allowed: true, Destination: destination}
+	if p == nil {
+		return d
+	}
+	if p.muter != nil && p.muter.Muted(destination) {
+		d.Allowed, d.Reason = false, "muted"
+		return d
+	}
+	r, ok := p.destinations[destination]
+	if !ok {
+		r = p.defaults
+	}
+	at = at.In(p.loc)
+	if name, ok := p.holidays[at.Format(dateLayout)]; ok && r.holidays {
+		d.Allowed, d.Reason = false, "quiet on holiday "+name
+	}
+	minutes := at.Hour()*60 + at.Minute()
+	for _, w := range r.quiet {
+		if d.Allowed && w.contains(at.Weekday(), minutes) {
+			d.Allowed, d.Reason = false, "quiet hours "+w.String()
+		}
+	}
+	if d.Allowed {
+		return d
+	}
+	for _, t := range tags {
+		for _, o := range p.overrides {
+			if t == o {
+				d.Allowed = true
+				d.Reason = fmt.Sprintf("%v, overridden by tag %v", d.Reason, t)
+				return d
+			}
+		}
+	}
+	return d
+}
@@ -0,0 +1,419 @@
+// Package queue serializes the playback of sounds on the server. Every sound
+// or text to speech that must be played locally is pushed in the queue and
+// played one after the other by the underlying player, the most important
+// ones first.
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/restanrm/bell/job"
+	"github.com/restanrm/bell/player"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"github.com/twinj/uuid"
+)
+
+// Priority is the importance of an item in the queue. Items with an higher
+// priority are played first.
+type Priority int
+
+const (
+	// Fun is the priority of sounds that are played for fun
+	Fun Priority = iota
+	// Normal is the default priority
+	Normal
+	// Alert sounds are played before anything else and interrupt the less
+	// important sounds currently playing
+	Alert
+)
+
+// String convert Priority to string
+func (p Priority) String() string {
+	switch p {
+	case Fun:
+		return "fun"
+	case Normal:
+		return "normal"
+	case Alert:
+		return "alert"
+	}
+	return ""
+}
+
+// MarshalText allows to encode a priority with its name
+func (p Priority) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+// ParsePriority return the priority matching the given name. An empty name
+// is the Normal priority.
+func ParsePriority(s string) (Priority, error) {
+	switch strings.ToLower(s) {
+	case "fun":
+		return Fun, nil
+	case "", "normal":
+		return Normal, nil
+	case "alert":
+		return Alert, nil
+	}
+	return Normal, fmt.Errorf("Unknown priority %q, please use fun, normal or alert", s)
+}
+
+var (
+	// ErrItemNotFound is returned when an item isn't in the queue
+	ErrItemNotFound = errors.New("Item not found in queue")
+	// ErrNotStoppable is returned when the player can't interrupt a sound
+	ErrNotStoppable = player.ErrNotStoppable
+	// ErrInterrupted is the failure of the jobs interrupted while playing
+	ErrInterrupted = errors.New("Interrupted")
+	// ErrRemoved is the failure of the jobs removed from the queue
+	ErrRemoved = errors.New("Removed from the queue")
+)
+
+// Item is an element of the queue
+type Item struct {
+	ID       string    `json:"id"`
+	File     string    `json:"file"`
+	Priority Priority  `json:"priority"`
+	Playing  bool      `json:"playing"`
+	QueuedAt time.Time `json:"queued_at"`
+	Gain     float64   `json:"gain,omitempty"`
+	// Parts is the number of files and pauses of a sequence
+	Parts int `json:"parts,omitempty"`
+	// Job is the job following the playback of the item, if any
+	Job string `json:"job,omitempty"`
+
+	parts []part
+	// interrupted is closed when the item must stop playing
+	interrupted chan struct{}
+}
+
+// part is a file played by an item, or a pause
+type part struct {
+	filepath string
+	gain     float64
+	pause    time.Duration
+}
+
+// Queue holds the sounds waiting to be played
+type Queue struct {
+	player  player.Player
+	jobs    *job.Jobs
+	mu      sync.Mutex
+	pending []*Item
+	current *Item
+	wake    chan struct{}
+}
+
+// New return a new queue playing items with the given player. The jobs of
+// the items are updated when they are played. The playing loop is started
+// right away.
+func New(p player.Player, jobs *job.Jobs) *Queue {
+	q := &Queue{
+		player: p,
+		jobs:   jobs,
+		wake:   make(chan struct{}, 1),
+	}
+	go q.run()
+	return q
+}
+
+// Push add a file to play in the queue. The gain, in dB, is applied when the
+// file is played.
+func (q *Queue) Push(fp string, prio Priority, gain float64) Item {
+	return q.pushJob(fp, prio, gain, "")
+}
+
+// pushJob add a file to play in the queue for a job
+func (q *Queue) pushJob(fp string, prio Priority, gain float64, job string) Item {
+	return q.push(&Item{
+		File:     filepath.Base(fp),
+		Priority: prio,
+		Gain:     gain,
+		Job:      job,
+		parts:    []part{{filepath: fp, gain: gain}},
+	})
+}
+
+// PushSequence add the files and pauses of a sequence in the queue. They are
+// played in order, as a single item.
+func (q *Queue) PushSequence(seq *Sequence, prio Priority) Item {
+	return q.push(&Item{
+		File:     seq.Name,
+		Priority: prio,
+		Parts:    len(seq.parts),
+		Job:      seq.Job,
+		parts:    seq.parts,
+	})
+}
+
+func (q *Queue) push(it *Item) Item {
+	it.ID = uuid.NewV4().String()
+	it.QueuedAt = time.Now()
+	it.interrupted = make(chan struct{})
+
+	q.mu.Lock()
+	q.pending = append(q.pending, it)
+	// keep the order of insertion between items of the same priority
+	sort.SliceStable(q.pending, func(i, j int) bool {
+		return q.pending[i].Priority > q.pending[j].Priority
+	})
+	// the item preempted is decided and interrupted under the lock, it can't
+	// be confused with the item played after it
+	var preempted *Item
+	if q.current != nil && q.current.Priority < it.Priority && it.Priority == Alert {
+		preempted = q.current
+		interrupt(preempted)
+	}
+	pushed := *it
+	q.mu.Unlock()
+
+	if preempted != nil {
+		logrus.WithField("id", it.ID).Info("Alert pushed in queue, interrupting current sound")
+		if err := q.stop(preempted); err != nil {
+			logrus.WithError(err).Warn("Failed to interrupt current sound")
+		}
+	}
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return pushed
+}
+
+// List returns the item currently playing followed by the pending items in
+// the order they will be played
+func (q *Queue) List() []Item {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	out := make([]Item, 0, len(q.pending)+1)
+	if q.current != nil {
+		out = append(out, *q.current)
+	}
+	for _, it := range q.pending {
+		out = append(out, *it)
+	}
+	return out
+}
+
+// Remove delete an item from the queue. If the item is currently playing, it
+// is interrupted.
+func (q *Queue) Remove(id string) error {
+	q.mu.Lock()
+	if it := q.current; it != nil && it.ID == id {
+		interrupt(it)
+		q.mu.Unlock()
+		return q.stop(it)
+	}
+	defer q.mu.Unlock()
+	for i, it := range q.pending {
+		if it.ID == id {
+			q.pending = append(q.pending[:i], q.pending[i+1:]...)
+			q.jobs.Finish(it.Job, ErrRemoved)
+			return nil
+		}
+	}
+	return ErrItemNotFound
+}
+
+// Clear removes all the pending items from the queue. The item currently
+// playing isn't interrupted. It returns the number of removed items.
+func (q *Queue) Clear() int {
+	q.mu.Lock()
+	removed := q.pending
+	q.pending = nil
+	q.mu.Unlock()
+	for _, it := range removed {
+		q.jobs.Finish(it.Job, ErrRemoved)
+	}
+	return len(removed)
+}
+
+// StopJob interrupts the item of a job if it is playing, or removes it from
+// the queue if it is pending
+func (q *Queue) StopJob(job string) error {
+	if job == "" {
+		return ErrItemNotFound
+	}
+	for _, it := range q.List() {
+		if it.Job == job {
+			return q.Remove(it.ID)
+		}
+	}
+	return ErrItemNotFound
+}
+
+// Skip interrupts the sound currently playing. The next item of the queue is
+// played right after.
+func (q *Queue) Skip() error {
+	q.mu.Lock()
+	it := q.current
+	if it == nil {
+		q.mu.Unlock()
+		return player.ErrNothingPlaying
+	}
+	interrupt(it)
+	q.mu.Unlock()
+	return q.stop(it)
+}
+
+// interrupt marks the item to stop playing, with the remaining parts of a
+// sequence. Caller must hold the lock.
+func interrupt(it *Item) {
+	select {
+	case <-it.interrupted:
+	default:
+		close(it.interrupted)
+	}
+}
+
+// stop stops the player if the interrupted item it is still the one playing.
+// The check and the stop are done under the lock, so that the player never
+// stops the next item once it has finished.
+func (q *Queue) stop(it *Item) error {
+	s, ok := q.player.(player.Stopper)
+	if !ok {
+		return ErrNotStoppable
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.current != it {
+		return nil
+	}
+	err := s.Stop()
+	// the item may be in a pause between two files
+	if err == player.ErrNothingPlaying {
+		return nil
+	}
+	return err
+}
+
+func (q *Queue) next() *Item {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.current = nil
+	if len(q.pending) == 0 {
+		return nil
+	}
+	it := q.pending[0]
+	q.pending = q.pending[1:]
+	it.Playing = true
+	q.current = it
+	return it
+}
+
+func (q *Queue) run() {
+	for {
+		it := q.next()
+		if it == nil {
+			<-q.wake
+			continue
+		}
+		q.jobs.Start(it.Job)
+		q.jobs.Finish(it.Job, q.play(it))
+	}
+}
+
+// play plays the parts of an item until it is interrupted. It returns the
+// first error of the parts, or ErrInterrupted.
+func (q *Queue) play(it *Item) error {
+	var failed error
+	for _, p := range it.parts {
+		select {
+		case <-it.interrupted:
+			return ErrInterrupted
+		default:
+		}
+		if p.pause > 0 {
+			select {
+			case <-time.After(p.pause):
+			case <-it.interrupted:
+			}
+			continue
+		}
+		err := player.PlayWithGain(q.player, p.filepath, p.gain)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"id":   it.ID,
+				"file": filepath.Base(p.filepath),
+			}).WithError(err).Error("Failed to play queued item")
+			if failed == nil {
+				failed = err
+			}
+		}
+	}
+	select {
+	case <-it.interrupted:
+		return ErrInterrupted
+	default:
+	}
+	return failed
+}
+
+// Player returns a player that push every file it receives in the queue with
+// the given priority. The calls return as soon as the file is queued.
+func (q *Queue) Player(prio Priority) player.Player {
+	return q.JobPlayer(prio, "")
+}
+
+// JobPlayer returns a player like Player, whose files are played for the job
+func (q *Queue) JobPlayer(prio Priority, job string) player.Player {
+	return &queuePlayer{q: q, prio: prio, job: job}
+}
+
+type queuePlayer struct {
+	q    *Queue
+	prio Priority
+	job  string
+}
+
+func (qp *queuePlayer) Play(path string) error {
+	return qp.PlayFilepath(filepath.Join(viper.GetString("soundDir"), path))
+}
+
+func (qp *queuePlayer) PlayFilepath(fp string) error {
+	return qp.PlayFilepathGain(fp, 0)
+}
+
+func (qp *queuePlayer) PlayFilepathGain(fp string, gain float64) error {
+	qp.q.pushJob(fp, qp.prio, gain, qp.job)
+	return nil
+}
+
+// Sequence collects the files and pauses of a sequence to push them in the
+// queue as a single item. It is a player recording the files it receives.
+type Sequence struct {
+	Name string
+	// Job is the job following the playback of the sequence, if any
+	Job   string
+	parts []part
+}
+
+// Play records a file of the sound directory
+func (s *Sequence) Play(path string) error {
+	return s.PlayFilepath(filepath.Join(viper.GetString("soundDir"), path))
+}
+
+// PlayFilepath records a file
+func (s *Sequence) PlayFilepath(fp string) error {
+	return s.PlayFilepathGain(fp, 0)
+}
+
+// PlayFilepathGain records a file played with a gain in dB
+func (s *Sequence) PlayFilepathGain(fp string, gain float64) error {
+	s.parts = append(s.parts, part{filepath: fp, gain: gain})
+	return nil
+}
+
+// Pause records a pause
+func (s *Sequence) Pause(d time.Duration) {
+	s.parts = append(s.parts, part{pause: d})
+}
@@ -0,0 +1,146 @@
+package queue
+
+import (
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/restanrm/bell/job"
+	"github.com/restanrm/bell/player"
+)
+
+var errStopped = errors.New("stopped")
+
+// stubPlayer plays each file for its duration, until it is stopped, and
+// records the files stopped
+type stubPlayer struct {
+	durations map[string]time.Duration
+
+	mu      sync.Mutex
+	playing string
+	abort   chan struct{}
+	stopped []string
+}
+
+func (p *stubPlayer) Play(path string) error { return p.PlayFilepathGain(path, 0) }
+
+func (p *stubPlayer) PlayFilepath(fp string) error { return p.PlayFilepathGain(fp, 0) }
+
+func (p *stubPlayer) PlayFilepathGain(fp string, gain float64) error {
+	name := filepath.Base(fp)
+	abort := make(chan struct{})
+	p.mu.Lock()
+	p.playing, p.abort = name, abort
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		p.playing = ""
+		p.mu.Unlock()
+	}()
+	select {
+	case <-time.After(p.durations[name]):
+		return nil
+	case <-abort:
+		return errStopped
+	}
+}
+
+func (p *stubPlayer) Stop() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.playing == "" {
+		return player.ErrNothingPlaying
+	}
+	p.stopped = append(p.stopped, p.playing)
+	p.playing = ""
+	close(p.abort)
+	return nil
+}
+
+func TestAlertPushedWhileFinishing(t *testing.T) {
+	p := &stubPlayer{durations: map[string]time.Duration{
+		"normal.mp3": 200 * time.Microsecond,
+		"alert.mp3":  2 * time.Millisecond,
+	}}
+	jobs := job.New(time.Minute)
+	q := New(p, jobs)
+
+	// the alerts are pushed around the end of the normal items, they may
+	// interrupt them but must never be interrupted themselves
+	for i := 0; i < 200; i++ {
+		normal := jobs.Create(job.Job{})
+		q.pushJob("normal.mp3", Normal, 0, normal.ID)
+		time.Sleep(time.Duration(i%8) * 50 * time.Microsecond)
+		alert := jobs.Create(job.Job{})
+		q.pushJob("alert.mp3", Alert, 0, alert.ID)
+
+		j, err := jobs.Wait(alert.ID, time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if j.Status != job.Done {
+			t.Fatalf("alert %d is %v with %q, want %v", i, j.Status, j.Error, job.Done)
+		}
+		if _, err := jobs.Wait(normal.ID, time.Second); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, name := range p.stopped {
+		if name != "normal.mp3" {
+			t.Errorf("%v has been stopped", name)
+		}
+	}
+}
+
+func TestRemoveAndSkip(t *testing.T) {
+	p := &stubPlayer{durations: map[string]time.Duration{"long.mp3": time.Minute}}
+	jobs := job.New(time.Minute)
+	q := New(p, jobs)
+
+	first := jobs.Create(job.Job{})
+	q.pushJob("long.mp3", Normal, 0, first.ID)
+	second := jobs.Create(job.Job{})
+	pending := q.pushJob("long.mp3", Normal, 0, second.ID)
+	for len(q.List()) == 0 || !q.List()[0].Playing {
+		time.Sleep(time.Millisecond)
+	}
+
+	if err := q.Remove(pending.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Remove(pending.ID); err != ErrItemNotFound {
+		t.Errorf("got error %v removing twice, want %v", err, ErrItemNotFound)
+	}
+	if err := q.Skip(); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		id  string
+		err error
+	}{
+		{first.ID, ErrInterrupted},
+		{second.ID, ErrRemoved},
+	} {
+		j, err := jobs.Wait(tt.id, time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if j.Status != job.Failed || j.Error != tt.err.Error() {
+			t.Errorf("job %v is %v with %q, want failed with %q", j.ID, j.Status, j.Error, tt.err)
+		}
+	}
+	// the item is cleared right after its job is finished
+	for i := 0; len(q.List()) != 0; i++ {
+		if i == 1000 {
+			t.Fatalf("%d items left in the queue, want 0", len(q.List()))
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if err := q.Skip(); err != player.ErrNothingPlaying {
+		t.Errorf("got error %v skipping an empty queue, want %v", err, player.ErrNothingPlaying)
+	}
+}
@@ -0,0 +1,302 @@
+// Package ratelimit limits the frequency of the plays with token buckets per
+// caller, per sound and global, and with cooldowns between two plays of a
+// same sound.
+package ratelimit
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrCaller is returned when a caller plays too often
+	ErrCaller = errors.New("Too many plays from the caller")
+	// ErrSound is returned when a sound is played too often
+	ErrSound = errors.New("Too many plays of the sound")
+	// ErrGlobal is returned when too many sounds are played
+	ErrGlobal = errors.New("Too many plays")
+	// ErrCooldown is returned when a sound is played again before the end of
+	// its cooldown
+	ErrCooldown = errors.New("Sound played too recently")
+)
+
+// Reason returns the short name of a rejection error, suitable for a metric
+// label
+func Reason(err error) string {
+	switch errors.Cause(err) {
+	case ErrCaller:
+		return "caller"
+	case ErrSound:
+		return "sound"
+	case ErrGlobal:
+		return "global"
+	case ErrCooldown:
+		return "cooldown"
+	}
+	return "unknown"
+}
+
+// Rule allows Burst plays per Period. The plays are replenished continuously.
+// The zero Rule doesn't limit anything.
+type Rule struct {
+	Burst  int
+	Period time.Duration
+}
+
+// ParseRule parses a rule written as "burst/period", like "10/1m" or "10/m".
+// An empty string or 0 is the zero Rule.
+func ParseRule(s string) (Rule, error) {
+	if s == "" || s == "0" {
+		return Rule{}, nil
+	}
+	parts := strings.SplitN(s, "/", 2)
+	if len(parts) != 2 {
+		return Rule{}, fmt.Errorf("Invalid rate limit %q, it must be written as burst/period like 10/1m", s)
+	}
+	burst, err := strconv.Atoi(parts[0])
+	if err != nil || burst <= 0 {
+		return Rule{}, fmt.Errorf("Invalid burst of rate limit %q", s)
+	}
+	period := parts[1]
+	if period != "" && strings.IndexAny(period[:1], "0123456789") < 0 {
+		period = "1" + period
+	}
+	d, err := time.ParseDuration(period)
+	if err != nil || d <= 0 {
+		return Rule{}, fmt.Errorf("Invalid period of rate limit %q", s)
+	}
+	return Rule{Burst: burst, Period: d}, nil
+}
+
+func (r Rule) enabled() bool {
+	return r.Burst > 0 && r.Period > 0
+}
+
+// String returns the rule written as "burst/period"
+func (r Rule) String() string {
+	if !r.enabled() {
+		return ""
+	}
+	return fmt.Sprintf("%d/%v", r.Burst, r.Period)
+}
+
+// bucket is a token bucket
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// refill adds the tokens earned since the last update of the bucket
+func (b *bucket) refill(r Rule, now time.Time) {
+	b.tokens += now.Sub(b.last).Seconds() * float64(r.Burst) / r.Period.Seconds()
+	if b.tokens > float64(r.Burst) {
+		b.tokens = float64(r.Burst)
+	}
+	b.last = now
+}
+
+// wait returns the delay before a token is available
+func (b *bucket) wait(r Rule) time.Duration {
+	if b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) * float64(r.Period) / float64(r.Burst))
+}
+
+// Config describes the limits of the plays
+type Config struct {
+	// Caller limits the plays of each caller
+	Caller Rule
+	// Sound limits the plays of each sound
+	Sound Rule
+	// Global limits all the plays
+	Global Rule
+	// Cooldown is the minimum delay between two plays of a same sound
+	Cooldown time.Duration
+	// Cooldowns override the cooldown of some sounds
+	Cooldowns map[string]time.Duration
+}
+
+// Limiter decides whether a play is allowed. Its zero value allows
+// everything.
+type Limiter struct {
+	config  Config
+	mu      sync.Mutex
+	callers map[string]*bucket
+	sounds  map[string]*bucket
+	global  bucket
+	played  map[string]time.Time
+	pruned  time.Time
+}
+
+// New returns a limiter applying the given configuration
+func New(c Config) *Limiter {
+	return &Limiter{
+		config:  c,
+		callers: make(map[string]*bucket),
+		sounds:  make(map[string]*bucket),
+		played:  make(map[string]time.Time),
+	}
+}
+
+// get returns the bucket of key in m, refilled up to now
+func get(m map[string]*bucket, key string, r Rule, now time.Time) *bucket {
+	b, ok := m[key]
+	if !ok {
+		b = &bucket{tokens: float64(r.Burst), last: now}
+		m[key] = b
+	}
+	b.refill(r, now)
+	return b
+}
+
+// Reservation is a play recorded by a limiter. It can be cancelled when
+// nothing is played after all.
+type Reservation struct {
+	l       *Limiter
+	sound   string
+	buckets []*bucket
+	// played is the previous play of the sound, zero if none
+	played time.Time
+	// cooldown is true if the play started the cooldown of the sound
+	cooldown bool
+	done     bool
+}
+
+// Cancel gives back the tokens consumed by the play and restores the
+// cooldown of the sound. It does nothing if called more than once.
+func (res *Reservation) Cancel() {
+	if res == nil {
+		return
+	}
+	l := res.l
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if res.done {
+		return
+	}
+	res.done = true
+	for _, b := range res.buckets {
+		b.tokens++
+	}
+	if !res.cooldown {
+		return
+	}
+	if res.played.IsZero() {
+		delete(l.played, res.sound)
+	} else {
+		l.played[res.sound] = res.played
+	}
+}
+
+// Allow records a play of the sound by the caller if it is allowed by every
+// limit, and returns its reservation. Otherwise it returns the first limit
+// reached and the delay after which the play would be allowed. An empty
+// sound is only limited per caller and globally.
+func (l *Limiter) Allow(caller, sound string) (*Reservation, time.Duration, error) {
+	if l == nil {
+		return nil, 0, nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	l.prune(now)
+
+	type check struct {
+		rule Rule
+		b    *bucket
+		err  error
+	}
+	var checks []check
+	if l.config.Caller.enabled() {
+		checks = append(checks, check{l.config.Caller, get(l.callers, caller, l.config.Caller, now), ErrCaller})
+	}
+	if l.config.Sound.enabled() && sound != "" {
+		checks = append(checks, check{l.config.Sound, get(l.sounds, sound, l.config.Sound, now), ErrSound})
+	}
+	if l.config.Global.enabled() {
+		if l.global.last.IsZero() {
+			l.global = bucket{tokens: float64(l.config.Global.Burst), last: now}
+		}
+		l.global.refill(l.config.Global, now)
+		checks = append(checks, check{l.config.Global, &l.global, ErrGlobal})
+	}
+
+	// nothing is consumed unless every limit allows the play
+	if sound != "" {
+		if last, ok := l.played[sound]; ok {
+			if wait := last.Add(l.cooldown(sound)).Sub(now); wait > 0 {
+				return nil, wait, ErrCooldown
+			}
+		}
+	}
+	for _, c := range checks {
+		if wait := c.b.wait(c.rule); wait > 0 {
+			return nil, wait, c.err
+		}
+	}
+	res := &Reservation{l: l, sound: sound}
+	for _, c := range checks {
+		c.b.tokens--
+		res.buckets = append(res.buckets, c.b)
+	}
+	if sound != "" && l.cooldown(sound) > 0 {
+		res.played, res.cooldown = l.played[sound], true
+		l.played[sound] = now
+	}
+	return res, 0, nil
+}
+
+func (l *Limiter) cooldown(sound string) time.Duration {
+	if d, ok := l.config.Cooldowns[sound]; ok {
+		return d
+	}
+	return l.config.Cooldown
+}
+
+// prune forgets the buckets that are full and the cooldowns that are over,
+// at most once per minute
+func (l *Limiter) prune(now time.Time) {
+	if now.Sub(l.pruned) < time.Minute {
+		return
+	}
+	l.pruned = now
+	for _, m := range []struct {
+		buckets map[string]*bucket
+		rule    Rule
+	}{{l.callers, l.config.Caller}, {l.sounds, l.config.Sound}} {
+		for k, b := range m.buckets {
+			b.refill(m.rule, now)
+			if b.tokens >= float64(m.rule.Burst) {
+				delete(m.buckets, k)
+			}
+		}
+	}
+	for sound, last := range l.played {
+		if now.Sub(last) >= l.cooldown(sound) {
+			delete(l.played, sound)
+		}
+	}
+}
+
+// ParseCooldowns parses cooldowns of sounds written as "sound=duration"
+func ParseCooldowns(values []string) (map[string]time.Duration, error) {
+	cooldowns := make(map[string]time.Duration)
+	for _, v := range values {
+		parts := strings.SplitN(v, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("Invalid cooldown %q, it must be written as sound=duration", v)
+		}
+		d, err := time.ParseDuration(parts[1])
+		if err != nil {
+			return nil, errors.Wrapf(err, "Invalid cooldown of sound %v", parts[0])
+		}
+		cooldowns[parts[0]] = d
+	}
+	return cooldowns, nil
+}
@@ -0,0 +1,178 @@
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cron is a parsed cron expression
+type Cron struct {
+	minute, hour, dom, month, dow uint64
+	// domStar and dowStar are true when the day of month or the day of week
+	// is "*". When both are restricted, a day matching either of them matches.
+	domStar, dowStar bool
+}
+
+// field describes the range of the values of a field of a cron expression
+type field struct {
+	name     string
+	min, max int
+	names    map[string]int
+}
+
+var (
+	minutes = field{name: "minute", min: 0, max: 59}
+	hours   = field{name: "hour", min: 0, max: 23}
+	doms    = field{name: "day of month", min: 1, max: 31}
+	months  = field{name: "month", min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	// 7 is also sunday
+	dows = field{name: "day of week", min: 0, max: 7, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+var macros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// ParseCron parses a standard cron expression with five fields: minute, hour,
+// day of month, month and day of week. Fields accept *, lists, ranges, steps
+// and the three first letters of the english names of the months and days.
+// The macros @yearly, @monthly, @weekly, @daily and @hourly are also known.
+func ParseCron(expr string) (Cron, error) {
+	var c Cron
+	spec := strings.TrimSpace(expr)
+	if m, ok := macros[strings.ToLower(spec)]; ok {
+		spec = m
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return c, fmt.Errorf("Invalid cron expression %q, it must have 5 fields: minute hour day-of-month month day-of-week", expr)
+	}
+	var err error
+	for i, f := range []struct {
+		bits *uint64
+		field
+	}{{&c.minute, minutes}, {&c.hour, hours}, {&c.dom, doms}, {&c.month, months}, {&c.dow, dows}} {
+		if *f.bits, err = parseField(fields[i], f.field); err != nil {
+			return c, fmt.Errorf("Invalid cron expression %q: %v", expr, err)
+		}
+	}
+	// sunday can be written 0 or 7
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	c.domStar = fields[2] == "*" || fields[2] == "?"
+	c.dowStar = fields[4] == "*" || fields[4] == "?"
+	return c, nil
+}
+
+// parseField returns the set of values matched by a field as a bitset
+func parseField(s string, f field) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(s, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			step, err = strconv.Atoi(part[i+1:])
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step %q of %v", part[i+1:], f.name)
+			}
+			part = part[:i]
+		}
+		from, to := f.min, f.max
+		switch {
+		case part == "*" || part == "?":
+		case strings.Contains(part, "-"):
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			if from, err = parseValue(bounds[0], f); err != nil {
+				return 0, err
+			}
+			if to, err = parseValue(bounds[1], f); err != nil {
+				return 0, err
+			}
+			if from > to {
+				return 0, fmt.Errorf("invalid range %q of %v", part, f.name)
+			}
+		default:
+			v, err := parseValue(part, f)
+			if err != nil {
+				return 0, err
+			}
+			from = v
+			// a single value with a step starts a range, like 5/15
+			if step == 1 {
+				to = v
+			}
+		}
+		for v := from; v <= to; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func parseValue(s string, f field) (int, error) {
+	if v, ok := f.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("invalid %v %q, it must be between %d and %d", f.name, s, f.min, f.max)
+	}
+	return v, nil
+}
+
+func has(bits uint64, v int) bool {
+	return bits&(1<<uint(v)) != 0
+}
+
+func (c Cron) matchDay(t time.Time) bool {
+	dom := has(c.dom, t.Day())
+	dow := has(c.dow, int(t.Weekday()))
+	switch {
+	case c.domStar && c.dowStar:
+		return true
+	case c.domStar:
+		return dow
+	case c.dowStar:
+		return dom
+	}
+	return dom || dow
+}
+
+// Next returns the first time matching the expression strictly after t, in
+// the location of t. It returns the zero time if nothing matches in the next
+// five years, like on the 30th of February.
+func (c Cron) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case !has(c.month, int(t.Month())):
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		case !c.matchDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		case !has(c.hour, t.Hour()):
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+		case !has(c.minute, t.Minute()):
+			t = t.Truncate(time.Minute).Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
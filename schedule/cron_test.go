@@ -0,0 +1,136 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+// set returns the bitset of the values
+func set(values ...int) uint64 {
+	var bits uint64
+	for _, v := range values {
+		bits |= 1 << uint(v)
+	}
+	return bits
+}
+
+// span returns the bitset of the values from min to max
+func span(min, max int) uint64 {
+	var bits uint64
+	for v := min; v <= max; v++ {
+		bits |= 1 << uint(v)
+	}
+	return bits
+}
+
+func TestParseCron(t *testing.T) {
+	tests := []struct {
+		expr string
+		want Cron
+	}{
+		{"* * * * *", Cron{span(0, 59), span(0, 23), span(1, 31), span(1, 12), span(0, 7), true, true}},
+		{"*/15 * * * *", Cron{set(0, 15, 30, 45), span(0, 23), span(1, 31), span(1, 12), span(0, 7), true, true}},
+		{"5/20 * * * *", Cron{set(5, 25, 45), span(0, 23), span(1, 31), span(1, 12), span(0, 7), true, true}},
+		{"0,30 * * * *", Cron{set(0, 30), span(0, 23), span(1, 31), span(1, 12), span(0, 7), true, true}},
+		{"0 9 * * 1-5", Cron{set(0), set(9), span(1, 31), span(1, 12), span(1, 5), true, false}},
+		{"30 9 * * mon-fri", Cron{set(30), set(9), span(1, 31), span(1, 12), span(1, 5), true, false}},
+		{"0 8-18/2 * * *", Cron{set(0), set(8, 10, 12, 14, 16, 18), span(1, 31), span(1, 12), span(0, 7), true, true}},
+		{"0 0 29 feb ?", Cron{set(0), set(0), set(29), set(2), span(0, 7), false, true}},
+		{"0 0 13 * 5", Cron{set(0), set(0), set(13), span(1, 12), set(5), false, false}},
+		// sunday is 0 or 7
+		{"0 0 * * 7", Cron{set(0), set(0), span(1, 31), span(1, 12), set(0, 7), true, false}},
+		{"0 0 * * SUN", Cron{set(0), set(0), span(1, 31), span(1, 12), set(0), true, false}},
+		{"@daily", Cron{set(0), set(0), span(1, 31), span(1, 12), span(0, 7), true, true}},
+		{" @Yearly ", Cron{set(0), set(0), set(1), set(1), span(0, 7), false, true}},
+	}
+	for _, tt := range tests {
+		got, err := ParseCron(tt.expr)
+		if err != nil {
+			t.Errorf("%q: %v", tt.expr, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%q: got %+v, want %+v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestParseCronErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"* * * foo *",
+		"1- * * * *",
+		"@weekdays",
+	} {
+		if _, err := ParseCron(expr); err == nil {
+			t.Errorf("%q: parsed without error", expr)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	date := func(year int, month time.Month, day, hour, min int) time.Time {
+		return time.Date(year, month, day, hour, min, 0, 0, time.UTC)
+	}
+	// the 11th of March 2024 is a monday
+	tests := []struct {
+		expr string
+		from time.Time
+		want time.Time
+	}{
+		{"*/15 * * * *", date(2024, 3, 11, 9, 7), date(2024, 3, 11, 9, 15)},
+		{"*/15 * * * *", date(2024, 3, 11, 9, 45), date(2024, 3, 11, 10, 0)},
+		{"*/15 * * * *", date(2024, 12, 31, 23, 59), date(2025, 1, 1, 0, 0)},
+		// the next time is strictly after
+		{"0,30 * * * *", date(2024, 3, 11, 9, 0), date(2024, 3, 11, 9, 30)},
+		{"0,30 * * * *", date(2024, 3, 11, 9, 30).Add(30 * time.Second), date(2024, 3, 11, 10, 0)},
+		{"0 9 * * 1-5", date(2024, 3, 11, 8, 59), date(2024, 3, 11, 9, 0)},
+		{"0 9 * * 1-5", date(2024, 3, 15, 9, 0), date(2024, 3, 18, 9, 0)},
+		{"0 0 * * 7", date(2024, 3, 11, 0, 0), date(2024, 3, 17, 0, 0)},
+		{"0 12 1 jun *", date(2024, 7, 1, 0, 0), date(2025, 6, 1, 12, 0)},
+		{"0 0 29 2 *", date(2024, 2, 29, 0, 0), date(2028, 2, 29, 0, 0)},
+		{"0 0 29 2 *", date(2023, 3, 1, 0, 0), date(2024, 2, 29, 0, 0)},
+		// the day of month and the day of week are both restricted, a day
+		// matching either of them matches: the 13th or a friday
+		{"0 0 13 * 5", date(2024, 3, 11, 0, 0), date(2024, 3, 13, 0, 0)},
+		{"0 0 13 * 5", date(2024, 3, 13, 0, 0), date(2024, 3, 15, 0, 0)},
+		{"0 0 13 * 5", date(2024, 3, 29, 0, 0), date(2024, 4, 5, 0, 0)},
+		// only one of them is restricted, it alone is matched
+		{"0 0 13 * *", date(2024, 3, 13, 0, 0), date(2024, 4, 13, 0, 0)},
+		{"0 0 * * 5", date(2024, 3, 13, 0, 0), date(2024, 3, 15, 0, 0)},
+		// nothing matches
+		{"0 0 30 2 *", date(2024, 1, 1, 0, 0), time.Time{}},
+	}
+	for _, tt := range tests {
+		c, err := ParseCron(tt.expr)
+		if err != nil {
+			t.Fatalf("%q: %v", tt.expr, err)
+		}
+		if got := c.Next(tt.from); !got.Equal(tt.want) {
+			t.Errorf("%q after %v: got %v, want %v", tt.expr, tt.from, got, tt.want)
+		}
+	}
+}
+
+func TestCronNextLocation(t *testing.T) {
+	loc := time.FixedZone("UTC+2", 2*60*60)
+	c, err := ParseCron("30 9 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	from := time.Date(2024, 3, 11, 10, 0, 0, 0, loc)
+	want := time.Date(2024, 3, 12, 9, 30, 0, 0, loc)
+	if got := c.Next(from); !got.Equal(want) || got.Location() != loc {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
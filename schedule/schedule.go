@@ -0,0 +1,375 @@
+// Package schedule plays sounds and texts at given times, once or on the
+// recurrence of cron expressions. The schedules are kept in a json file so
+// they survive restarts.
+package schedule
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/twinj/uuid"
+)
+
+// maxDelay is how late a one-shot schedule missed while the server was down
+// is still played at startup
+const maxDelay = 5 * time.Minute
+
+// keepDone is how long a schedule that won't run anymore is kept, so the
+// result of its last run can be listed
+const keepDone = 24 * time.Hour
+
+var (
+	// ErrNotFound is returned when a schedule doesn't exist
+	ErrNotFound = errors.New("Schedule not found")
+	// ErrInvalid is returned when a schedule is malformed
+	ErrInvalid = errors.New("Invalid schedule")
+)
+
+// invalid explains why a schedule is invalid. Its cause is ErrInvalid.
+type invalid string
+
+func (e invalid) Error() string { return string(e) }
+func (e invalid) Cause() error  { return ErrInvalid }
+
+// Schedule plays a sound, or the sounds of a tag, or a text to speech at a
+// given time or on the recurrence of a cron expression
+type Schedule struct {
+	ID string `json:"id"`
+	// Cron is the cron expression of a recurring schedule
+	Cron string `json:"cron,omitempty"`
+	// At is the time of a one-shot schedule
+	At *time.Time `json:"at,omitempty"`
+	// Sound is the name of the sound or of the tag to play
+	Sound string `json:"sound,omitempty"`
+	// Text is the text to say
+	Text string `json:"text,omitempty"`
+	// Destination is the registered client playing the schedule. The
+	// server plays it if empty.
+	Destination string `json:"destination,omitempty"`
+	// Priority of the schedule in the queue of the server
+	Priority  string     `json:"priority,omitempty"`
+	Creator   string     `json:"creator,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	Next      *time.Time `json:"next,omitempty"`
+	LastRun   *time.Time `json:"last_run,omitempty"`
+	LastError string     `json:"last_error,omitempty"`
+
+	cron Cron
+}
+
+// Validate checks that the schedule has either a cron expression or a time,
+// and either a sound or a text
+func (s *Schedule) Validate() error {
+	switch {
+	case (s.Cron == "") == (s.At == nil):
+		return invalid("A schedule needs either a cron expression or a time")
+	case (s.Sound == "") == (s.Text == ""):
+		return invalid("A schedule needs either a sound or a text")
+	}
+	if s.Cron != "" {
+		c, err := ParseCron(s.Cron)
+		if err != nil {
+			return invalid(err.Error())
+		}
+		s.cron = c
+	}
+	return nil
+}
+
+// schedule computes the next run of the schedule after t. It returns false,
+// and clears Next, if the schedule won't run anymore.
+func (s *Schedule) schedule(t time.Time) bool {
+	if s.At != nil {
+		if s.LastRun != nil {
+			s.Next = nil
+			return false
+		}
+		s.Next = s.At
+		return true
+	}
+	next := s.cron.Next(t)
+	if next.IsZero() {
+		s.Next = nil
+		return false
+	}
+	s.Next = &next
+	return true
+}
+
+// expired tells if the schedule won't run anymore and its last run is older
+// than keepDone at t
+func (s *Schedule) expired(t time.Time) bool {
+	return s.Next == nil && (s.LastRun == nil || t.Sub(*s.LastRun) > keepDone)
+}
+
+// Runner plays the target of a schedule
+type Runner func(s Schedule) error
+
+// Scheduler runs the schedules when they are due
+type Scheduler struct {
+	fp   string
+	run  Runner
+	mu   sync.Mutex
+	m    map[string]*Schedule
+	wake chan struct{}
+}
+
+// New returns a scheduler running the schedules stored in the file at fp
+// with run. The scheduling loop is started right away. Recurring schedules
+// missed while the server was down are skipped, one-shot schedules are played
+// if they are late by less than 5 minutes. The schedules that won't run
+// anymore are kept for a day after their last run.
+func New(fp string, run Runner) (*Scheduler, error) {
+	s := &Scheduler{
+		fp:   fp,
+		run:  run,
+		m:    make(map[string]*Schedule),
+		wake: make(chan struct{}, 1),
+	}
+	data, err := ioutil.ReadFile(fp)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.Wrapf(err, "Failed to read schedules file %v", fp)
+	}
+	if err == nil {
+		var schedules []*Schedule
+		if err = json.Unmarshal(data, &schedules); err != nil {
+			return nil, errors.Wrapf(err, "Failed to decode schedules file %v", fp)
+		}
+		now := time.Now()
+		for _, sc := range schedules {
+			if err := sc.Validate(); err != nil {
+				logrus.WithError(err).WithField("id", sc.ID).Warn("Ignoring invalid schedule")
+				continue
+			}
+			if sc.At != nil && sc.LastRun == nil && now.Sub(*sc.At) > maxDelay {
+				logrus.WithFields(logrus.Fields{
+					"id": sc.ID,
+					"at": sc.At,
+				}).Warn("Dropping one-shot schedule missed while the server was down")
+				continue
+			}
+			if sc.schedule(now) || !sc.expired(now) {
+				s.m[sc.ID] = sc
+			}
+		}
+	}
+	go s.loop()
+	return s, nil
+}
+
+// save writes the schedules in the file. Caller must hold the lock.
+func (s *Scheduler) save() error {
+	schedules := s.list()
+	data, err := json.MarshalIndent(schedules, "", "  ")
+	if err != nil {
+		return errors.Wrapf(err, "Failed to encode schedules")
+	}
+	tmp := s.fp + ".tmp"
+	if err = ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return errors.Wrapf(err, "Failed to write schedules")
+	}
+	if err = os.Rename(tmp, s.fp); err != nil {
+		os.Remove(tmp)
+		return errors.Wrapf(err, "Failed to replace %v", s.fp)
+	}
+	return nil
+}
+
+// list returns the schedules in the order they will run, the ones that
+// won't run anymore last. Caller must hold the lock.
+func (s *Scheduler) list() []Schedule {
+	out := make([]Schedule, 0, len(s.m))
+	for _, sc := range s.m {
+		out = append(out, *sc)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i].Next, out[j].Next
+		switch {
+		case a == nil && b != nil:
+			return false
+		case a != nil && b == nil:
+			return true
+		case a != nil && !a.Equal(*b):
+			return a.Before(*b)
+		}
+		return out[i].ID < out[j].ID
+	})
+	return out
+}
+
+// purge drops the schedules expired at now. Caller must hold the lock.
+func (s *Scheduler) purge(now time.Time) {
+	for id, sc := range s.m {
+		if sc.expired(now) {
+			delete(s.m, id)
+		}
+	}
+}
+
+// List returns the schedules in the order they will run
+func (s *Scheduler) List() []Schedule {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.purge(time.Now())
+	return s.list()
+}
+
+// Add validates and stores a new schedule. Its ID, creation date and next
+// run are set by the scheduler.
+func (s *Scheduler) Add(sc Schedule) (Schedule, error) {
+	if err := sc.Validate(); err != nil {
+		return sc, err
+	}
+	now := time.Now()
+	if sc.At != nil && !sc.At.After(now) {
+		return sc, invalid("The time of the schedule is in the past")
+	}
+	sc.ID = uuid.NewV4().String()
+	sc.CreatedAt = now
+	sc.Next, sc.LastRun, sc.LastError = nil, nil, ""
+	if !sc.schedule(now) {
+		return sc, invalid(fmt.Sprintf("The cron expression %q never matches", sc.Cron))
+	}
+
+	s.mu.Lock()
+	s.m[sc.ID] = &sc
+	err := s.save()
+	s.mu.Unlock()
+	if err != nil {
+		return sc, err
+	}
+	s.notify()
+	return sc, nil
+}
+
+// Remove deletes a schedule
+func (s *Scheduler) Remove(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.m[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.m, id)
+	return s.save()
+}
+
+// RenameSound replaces the sound name by newName in the targets of the
+// schedules. It returns the number of schedules changed.
+func (s *Scheduler) RenameSound(name, newName string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var renamed []*Schedule
+	for _, sc := range s.m {
+		if sc.Sound == name {
+			sc.Sound = newName
+			renamed = append(renamed, sc)
+		}
+	}
+	if len(renamed) == 0 {
+		return 0, nil
+	}
+	if err := s.save(); err != nil {
+		for _, sc := range renamed {
+			sc.Sound = name
+		}
+		return 0, err
+	}
+	return len(renamed), nil
+}
+
+func (s *Scheduler) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// next returns the time of the next run, or the zero time if there is
+// nothing to run
+func (s *Scheduler) next() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var next time.Time
+	for _, sc := range s.m {
+		if sc.Next == nil {
+			continue
+		}
+		if next.IsZero() || sc.Next.Before(next) {
+			next = *sc.Next
+		}
+	}
+	return next
+}
+
+// due returns the schedules that must run at now, and reschedules them. The
+// schedules that won't run anymore are kept until their result is reported.
+func (s *Scheduler) due(now time.Time) []Schedule {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.purge(now)
+	var due []Schedule
+	for _, sc := range s.m {
+		if sc.Next == nil || sc.Next.After(now) {
+			continue
+		}
+		due = append(due, *sc)
+		sc.LastRun = &now
+		sc.schedule(now)
+	}
+	if len(due) > 0 {
+		if err := s.save(); err != nil {
+			logrus.WithError(err).Error("Failed to save schedules")
+		}
+	}
+	return due
+}
+
+// report records the result of the last run of a schedule
+func (s *Scheduler) report(id string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sc, ok := s.m[id]
+	if !ok {
+		return
+	}
+	sc.LastError = ""
+	if err != nil {
+		sc.LastError = err.Error()
+	}
+	if err := s.save(); err != nil {
+		logrus.WithError(err).Error("Failed to save schedules")
+	}
+}
+
+func (s *Scheduler) loop() {
+	timer := time.NewTimer(time.Hour)
+	for {
+		timer.Stop()
+		select {
+		case <-timer.C:
+		default:
+		}
+		if next := s.next(); !next.IsZero() {
+			timer.Reset(time.Until(next))
+		}
+		select {
+		case <-s.wake:
+			continue
+		case <-timer.C:
+		}
+		for _, sc := range s.due(time.Now()) {
+			err := s.run(sc)
+			if err != nil {
+				logrus.WithError(err).WithField("id", sc.ID).Error("Failed to run schedule")
+			}
+			s.report(sc.ID, err)
+		}
+	}
+}
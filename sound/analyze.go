@@ -0,0 +1,111 @@
+package sound
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"math"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/restanrm/bell/audio"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// maxGain limits the amplification of quiet sounds so they don't saturate
+const maxGain = 12.0
+
+// Gain returns the gain in dB to apply when the sound is played. The manual
+// volume of the sound is used if set, else the gain brings the sound to the
+// target loudness when the normalization is enabled.
+func (s Sound) Gain() float64 {
+	if s.Volume != nil {
+		return *s.Volume
+	}
+	if s.Loudness == nil || !viper.GetBool("loudness.normalize") {
+		return 0
+	}
+	return math.Min(viper.GetFloat64("loudness.target")-*s.Loudness, maxGain)
+}
+
+// Analyze describes the audio file at fp in s: its properties are parsed from
+// its headers and its loudness is measured. The properties are kept even if
+// the loudness can't be measured.
+func Analyze(m *audio.LoudnessMeter, s *Sound, fp string) error {
+	data, err := ioutil.ReadFile(fp)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(data)
+	s.Size = int64(len(data))
+	s.Hash = hex.EncodeToString(sum[:])
+	info, err := audio.Probe(data)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to parse audio headers of %v", s.Name)
+	}
+	s.Duration = math.Round(info.Duration.Seconds()*1000) / 1000
+	s.SampleRate, s.Channels = info.SampleRate, info.Channels
+
+	l, err := m.Loudness(fp)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to measure loudness of %v", s.Name)
+	}
+	l = math.Round(l*100) / 100
+	s.Loudness = &l
+	return nil
+}
+
+// Backfill analyzes the sounds of the library that have not been analyzed
+// yet, or every sound if force is true. It returns the number of updated
+// sounds. Sounds that can't be analyzed at all are skipped.
+func Backfill(vault Sounder, m *audio.LoudnessMeter, force bool) (int, error) {
+	updated := 0
+	for _, s := range vault.GetSounds() {
+		if s.Hash != "" && s.Loudness != nil && !force {
+			continue
+		}
+		old := s
+		err := analyzeContent(vault, m, &s)
+		if err != nil {
+			logrus.WithError(err).WithField("name", s.Name).Warn("Failed to analyze sound")
+			// the properties may have been parsed anyway
+			if s.Properties == old.Properties {
+				continue
+			}
+		}
+		if err = vault.UpdateSound(s); err != nil {
+			return updated, errors.Wrapf(err, "Failed to update sound %v", s.Name)
+		}
+		logrus.WithField("name", s.Name).Info("Sound analyzed")
+		updated++
+	}
+	return updated, nil
+}
+
+// analyzeContent analyzes a sound of the library. The content is retrieved
+// from the library as it may not be stored in a file. Sounds uploaded before
+// their upload time was recorded get the modification time of their file.
+func analyzeContent(vault Sounder, m *audio.LoudnessMeter, s *Sound) error {
+	if fi, err := os.Stat(s.FilePath); err == nil && s.UploadedAt == nil {
+		t := fi.ModTime()
+		s.UploadedAt = &t
+	}
+	content, err := vault.GetSound(s.Name)
+	if err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile("", "bell-analyze")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	_, err = f.Write(content)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return Analyze(m, s, f.Name())
+}
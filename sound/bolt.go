@@ -0,0 +1,603 @@
+package sound
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"github.com/restanrm/bell/player"
+	"github.com/sirupsen/logrus"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	soundsBucket = []byte("sounds")
+	blobsBucket  = []byte("blobs")
+	// sequencesBucket holds the sequences encoded in json by name
+	sequencesBucket = []byte("sequences")
+)
+
+// boltSounds is a Sounder storing the sounds description in a bolt database.
+// When blobs are enabled, the audio content is also stored in the database
+// and the files are only extracted in a cache directory to be played.
+type boltSounds struct {
+	db       *bolt.DB
+	blobs    bool
+	cacheDir string
+	trash    *trash
+}
+
+var _ Sounder = &boltSounds{}
+
+// NewBolt opens or creates the bolt database at the given path and returns a
+// sounder using it. If blobs is true, the audio files are stored in the
+// database instead of the sound directory.
+func NewBolt(path string, blobs bool) (*boltSounds, error) {
+	err := dirExist(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to find or create directory to store database")
+	}
+	db, err := bolt.Open(path, 0644, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to open bolt database %v", path)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, b := range [][]byte{soundsBucket, blobsBucket, sequencesBucket} {
+			if _, err := tx.CreateBucketIfNotExists(b); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, errors.Wrapf(err, "Failed to create buckets in bolt database")
+	}
+	return &boltSounds{
+		db:       db,
+		blobs:    blobs,
+		cacheDir: filepath.Join(filepath.Dir(path), "cache"),
+		trash:    newTrash(),
+	}, nil
+}
+
+// Close closes the underlying database
+func (b *boltSounds) Close() error {
+	return b.db.Close()
+}
+
+// Empty returns true if the database doesn't contain any sound
+func (b *boltSounds) Empty() bool {
+	empty := true
+	b.db.View(func(tx *bolt.Tx) error {
+		k, _ := tx.Bucket(soundsBucket).Cursor().First()
+		empty = k == nil
+		return nil
+	})
+	return empty
+}
+
+// Check verifies that the database can be read
+func (b *boltSounds) Check() error {
+	return b.db.View(func(tx *bolt.Tx) error {
+		if tx.Bucket(soundsBucket) == nil {
+			return errors.Errorf("Bucket %s of the sounds is missing", soundsBucket)
+		}
+		return nil
+	})
+}
+
+// ImportJSON imports the sounds described in a json store file, as written by
+// the in memory sounder, and the sequences stored next to it. Sounds and
+// sequences already present in the database are kept untouched. It returns
+// the number of imported sounds.
+func (b *boltSounds) ImportJSON(fp string) (int, error) {
+	ss, err := load(fp)
+	if err != nil {
+		return 0, errors.Wrapf(err, "Failed to load json store %v", fp)
+	}
+	seqs, err := loadSequences(filepath.Join(filepath.Dir(fp), "sequences.json"))
+	if err != nil && !os.IsNotExist(errors.Cause(err)) {
+		return 0, err
+	}
+	imported := 0
+	err = b.db.Update(func(tx *bolt.Tx) error {
+		for _, seq := range seqs {
+			if tx.Bucket(sequencesBucket).Get([]byte(seq.Name)) != nil {
+				continue
+			}
+			data, err := json.Marshal(seq)
+			if err != nil {
+				return errors.Wrapf(err, "Failed to encode sequence %v", seq.Name)
+			}
+			if err = tx.Bucket(sequencesBucket).Put([]byte(seq.Name), data); err != nil {
+				return errors.Wrapf(err, "Failed to import sequence %v", seq.Name)
+			}
+		}
+		bucket := tx.Bucket(soundsBucket)
+		for _, s := range ss {
+			if bucket.Get([]byte(s.Name)) != nil {
+				continue
+			}
+			if err := b.put(tx, s); err != nil {
+				return errors.Wrapf(err, "Failed to import sound %v", s.Name)
+			}
+			imported++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return imported, nil
+}
+
+// put stores the sound description, and its content if blobs are enabled
+func (b *boltSounds) put(tx *bolt.Tx, s Sound) error {
+	data, err := json.Marshal(s.record())
+	if err != nil {
+		return errors.Wrapf(err, "Failed to encode sound as json")
+	}
+	if b.blobs {
+		content, err := ioutil.ReadFile(s.FilePath)
+		if err != nil {
+			return errors.Wrapf(err, "Failed to read sound file")
+		}
+		if err = tx.Bucket(blobsBucket).Put([]byte(s.Name), content); err != nil {
+			return err
+		}
+	}
+	return tx.Bucket(soundsBucket).Put([]byte(s.Name), data)
+}
+
+func (b *boltSounds) get(tx *bolt.Tx, name string) (Sound, bool) {
+	data := tx.Bucket(soundsBucket).Get([]byte(name))
+	if data == nil {
+		return Sound{}, false
+	}
+	var r ssto
+	if err := json.Unmarshal(data, &r); err != nil {
+		logrus.WithError(err).WithField("name", name).Error("Failed to decode sound from database")
+		return Sound{}, false
+	}
+	return r.sound(), true
+}
+
+// CreateSound a new sound in the database. The file is already on the disk.
+// If blobs are enabled, the file is moved into the database.
+func (b *boltSounds) CreateSound(name, fp string, tags ...string) error {
+	return b.create(Sound{Name: name, FilePath: fp, Tags: tags})
+}
+
+// create stores the sound s with all its properties. Its file is already on
+// the disk.
+func (b *boltSounds) create(s Sound) error {
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		return b.put(tx, s)
+	})
+	if err != nil {
+		return errors.Wrapf(err, "Failed to save the sound in database")
+	}
+	if b.blobs {
+		b.uncache(s)
+		if err := os.Remove(s.FilePath); err != nil {
+			logrus.WithError(err).WithField("filepath", s.FilePath).Warn("Failed to remove file stored in database")
+		}
+	}
+	return nil
+}
+
+// UpdateSound a sound in the database
+func (b *boltSounds) UpdateSound(sound Sound) error {
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		old, ok := b.get(tx, sound.Name)
+		if !ok {
+			return ErrSoundNotFound
+		}
+		if sound.FilePath == "" {
+			sound.FilePath = old.FilePath
+		}
+		data, err := json.Marshal(sound.record())
+		if err != nil {
+			return errors.Wrapf(err, "Failed to encode sound as json")
+		}
+		return tx.Bucket(soundsBucket).Put([]byte(sound.Name), data)
+	})
+	if err != nil {
+		return errors.Wrapf(err, "Failed to update the sound in database")
+	}
+	return nil
+}
+
+// RenameSound changes the name of a sound. Its file is renamed after the new
+// name unless it is shared with other sounds.
+func (b *boltSounds) RenameSound(name, newName string) error {
+	var old, renamed Sound
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		var ok bool
+		old, ok = b.get(tx, name)
+		if !ok {
+			return ErrSoundNotFound
+		}
+		if _, ok := b.get(tx, newName); ok {
+			return ErrSoundAlreadyExist
+		}
+
+		renamed = old
+		renamed.Name = newName
+		blobs := tx.Bucket(blobsBucket)
+		if b.blobs {
+			renamed.FilePath = soundFile(newName, old.FilePath)
+			if err := blobs.Put([]byte(newName), blobs.Get([]byte(name))); err != nil {
+				return err
+			}
+			if err := blobs.Delete([]byte(name)); err != nil {
+				return err
+			}
+		} else {
+			var err error
+			renamed, err = renameFile(old, newName, b.list(tx))
+			if err != nil {
+				return err
+			}
+		}
+
+		data, err := json.Marshal(renamed.record())
+		if err != nil {
+			return errors.Wrapf(err, "Failed to encode sound as json")
+		}
+		if err = tx.Bucket(soundsBucket).Put([]byte(newName), data); err != nil {
+			return err
+		}
+		if err = tx.Bucket(soundsBucket).Delete([]byte(name)); err != nil {
+			return err
+		}
+		return renameSteps(tx.Bucket(sequencesBucket), name, newName)
+	})
+	if err != nil {
+		// the file is renamed before the transaction is committed
+		if !b.blobs && renamed.FilePath != "" {
+			undoRename(old, renamed)
+		}
+		return err
+	}
+	b.uncache(old)
+	return nil
+}
+
+// ReplaceSound replaces the audio content of a sound with the file at fp.
+// The file is moved in the sound directory, or in the database if blobs are
+// enabled.
+func (b *boltSounds) ReplaceSound(name, fp string) error {
+	var old Sound
+	// the file is replaced before the transaction is committed
+	done, undo := func() {}, func() {}
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		var ok bool
+		old, ok = b.get(tx, name)
+		if !ok {
+			return ErrSoundNotFound
+		}
+
+		replaced := old
+		if b.blobs {
+			replaced.FilePath = soundFile(name, fp)
+			content, err := ioutil.ReadFile(fp)
+			if err != nil {
+				return errors.Wrapf(err, "Failed to read sound file")
+			}
+			if err = tx.Bucket(blobsBucket).Put([]byte(name), content); err != nil {
+				return err
+			}
+		} else {
+			var err error
+			replaced, done, undo, err = replaceFile(old, fp, b.list(tx))
+			if err != nil {
+				return err
+			}
+		}
+
+		data, err := json.Marshal(replaced.record())
+		if err != nil {
+			return errors.Wrapf(err, "Failed to encode sound as json")
+		}
+		return tx.Bucket(soundsBucket).Put([]byte(name), data)
+	})
+	if err != nil {
+		undo()
+		return err
+	}
+	done()
+	if b.blobs {
+		b.uncache(old)
+		if err := os.Remove(fp); err != nil {
+			logrus.WithError(err).WithField("filepath", fp).Warn("Failed to remove file stored in database")
+		}
+	}
+	return nil
+}
+
+// DeleteSound remove sound from the database. Its content is moved to the
+// trash where it can be restored until the retention period expires.
+func (b *boltSounds) DeleteSound(name string) error {
+	var s Sound
+	var ok bool
+	b.db.View(func(tx *bolt.Tx) error {
+		s, ok = b.get(tx, name)
+		return nil
+	})
+	if !ok {
+		return ErrSoundNotFound
+	}
+	fp, err := b.file(s)
+	if err != nil {
+		return err
+	}
+	cancel, err := b.trash.put(s, fp)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to move sound to trash")
+	}
+
+	err = b.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket(blobsBucket).Delete([]byte(name)); err != nil {
+			return err
+		}
+		return tx.Bucket(soundsBucket).Delete([]byte(name))
+	})
+	if err != nil {
+		cancel()
+		return errors.Wrapf(err, "Failed to delete the sound from database")
+	}
+	if b.blobs {
+		b.uncache(s)
+	} else if !shared(s, b.GetSounds()) {
+		if err = os.Remove(s.FilePath); err != nil {
+			logrus.WithError(err).WithField("filepath", s.FilePath).Warn("Failed to remove sound file")
+		}
+	}
+	return nil
+}
+
+// RestoreSound put back in the database a sound from the trash
+func (b *boltSounds) RestoreSound(name string) error {
+	exists := false
+	b.db.View(func(tx *bolt.Tx) error {
+		_, exists = b.get(tx, name)
+		return nil
+	})
+	if exists {
+		return ErrSoundAlreadyExist
+	}
+	s, err := b.trash.take(name)
+	if err != nil {
+		return err
+	}
+	if err = b.create(s); err != nil {
+		b.trash.untake(s, b.GetSounds())
+		return err
+	}
+	return nil
+}
+
+// GetDeletedSounds returns the sounds of the trash
+func (b *boltSounds) GetDeletedSounds() []DeletedSound {
+	return b.trash.list()
+}
+
+// GetSequences returns the sequences sorted by name
+func (b *boltSounds) GetSequences() []Sequence {
+	out := []Sequence{}
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(sequencesBucket).ForEach(func(k, v []byte) error {
+			var seq Sequence
+			if err := json.Unmarshal(v, &seq); err != nil {
+				logrus.WithError(err).WithField("name", string(k)).Warn("Failed to decode sequence")
+				return nil
+			}
+			out = append(out, seq)
+			return nil
+		})
+	})
+	if err != nil {
+		logrus.WithError(err).Error("Failed to list sequences")
+	}
+	return out
+}
+
+// GetSequence returns a sequence
+func (b *boltSounds) GetSequence(name string) (Sequence, error) {
+	var seq Sequence
+	err := b.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(sequencesBucket).Get([]byte(name))
+		if data == nil {
+			return ErrSequenceNotFound
+		}
+		return json.Unmarshal(data, &seq)
+	})
+	return seq, err
+}
+
+// SaveSequence creates or replaces a sequence
+func (b *boltSounds) SaveSequence(seq Sequence) error {
+	data, err := json.Marshal(seq)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to encode sequence")
+	}
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(sequencesBucket).Put([]byte(seq.Name), data)
+	})
+}
+
+// DeleteSequence removes a sequence
+func (b *boltSounds) DeleteSequence(name string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(sequencesBucket)
+		if bucket.Get([]byte(name)) == nil {
+			return ErrSequenceNotFound
+		}
+		return bucket.Delete([]byte(name))
+	})
+}
+
+// PlaySound is playing a sound from the database. If no sound match the
+// name, a random sound with the tag of the same name is played.
+func (b *boltSounds) PlaySound(name string, p player.Player) error {
+	s, err := b.lookup(name)
+	if err != nil {
+		return err
+	}
+	fp, err := b.file(s)
+	if err != nil {
+		return err
+	}
+	return player.PlayWithGain(p, fp, s.Gain())
+}
+
+// PlaySoundByTag plays a random sound having the given tag
+func (b *boltSounds) PlaySoundByTag(tag string, p player.Player) error {
+	s, err := b.pickByTag(tag)
+	if err != nil {
+		return err
+	}
+	fp, err := b.file(s)
+	if err != nil {
+		return err
+	}
+	return player.PlayWithGain(p, fp, s.Gain())
+}
+
+// GetSound returns the content of a sound, or of a random sound having the
+// tag of the same name
+func (b *boltSounds) GetSound(name string) ([]byte, error) {
+	s, err := b.lookup(name)
+	if err != nil {
+		return nil, ErrSoundNotFound
+	}
+	if !b.blobs {
+		return ioutil.ReadFile(s.FilePath)
+	}
+	var content []byte
+	err = b.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(blobsBucket).Get([]byte(s.Name))
+		if data == nil {
+			return ErrSoundNotFound
+		}
+		content = append([]byte(nil), data...)
+		return nil
+	})
+	return content, err
+}
+
+// GetSounds return the list of sounds of the database, sorted by name
+func (b *boltSounds) GetSounds() []Sound {
+	var out []Sound
+	b.db.View(func(tx *bolt.Tx) error {
+		out = b.list(tx)
+		return nil
+	})
+	return out
+}
+
+func (b *boltSounds) list(tx *bolt.Tx) []Sound {
+	var out []Sound
+	tx.Bucket(soundsBucket).ForEach(func(k, v []byte) error {
+		var r ssto
+		if err := json.Unmarshal(v, &r); err != nil {
+			logrus.WithError(err).WithField("name", string(k)).Error("Failed to decode sound from database")
+			return nil
+		}
+		out = append(out, r.sound())
+		return nil
+	})
+	return out
+}
+
+func (b *boltSounds) lookup(name string) (Sound, error) {
+	var s Sound
+	var ok bool
+	b.db.View(func(tx *bolt.Tx) error {
+		s, ok = b.get(tx, name)
+		return nil
+	})
+	if ok {
+		return s, nil
+	}
+	return b.pickByTag(name)
+}
+
+func (b *boltSounds) pickByTag(tag string) (Sound, error) {
+	var playable []Sound
+	for _, s := range b.GetSounds() {
+		if contains(s.Tags, tag) {
+			playable = append(playable, s)
+		}
+	}
+	if len(playable) == 0 {
+		return Sound{}, ErrNoTagMatch(tag)
+	}
+	return playable[rand.Int()%len(playable)], nil
+}
+
+// file returns a path on disk holding the content of the sound. With blobs,
+// the content is extracted in the cache directory the first time.
+func (b *boltSounds) file(s Sound) (string, error) {
+	if !b.blobs {
+		return s.FilePath, nil
+	}
+	fp := filepath.Join(b.cacheDir, filepath.Base(s.FilePath))
+	if _, err := os.Stat(fp); err == nil {
+		return fp, nil
+	}
+	content, err := b.GetSound(s.Name)
+	if err != nil {
+		return "", errors.Wrapf(err, "Failed to read sound %v from database", s.Name)
+	}
+	if err = dirExist(fp); err != nil {
+		return "", err
+	}
+	if err = ioutil.WriteFile(fp, content, 0644); err != nil {
+		return "", errors.Wrapf(err, "Failed to extract sound %v in cache", s.Name)
+	}
+	return fp, nil
+}
+
+// uncache removes the extracted file of a sound
+func (b *boltSounds) uncache(s Sound) {
+	if !b.blobs {
+		return
+	}
+	os.Remove(filepath.Join(b.cacheDir, filepath.Base(s.FilePath)))
+}
+
+// renameSteps replaces the sound name by newName in the steps of the
+// sequences of the bucket
+func renameSteps(bucket *bolt.Bucket, name, newName string) error {
+	var renamed []Sequence
+	err := bucket.ForEach(func(k, v []byte) error {
+		var seq Sequence
+		if err := json.Unmarshal(v, &seq); err != nil {
+			logrus.WithError(err).WithField("name", string(k)).Warn("Failed to decode sequence")
+			return nil
+		}
+		if seq, ok := seq.renameSound(name, newName); ok {
+			renamed = append(renamed, seq)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, seq := range renamed {
+		data, err := json.Marshal(seq)
+		if err != nil {
+			return errors.Wrapf(err, "Failed to encode sequence")
+		}
+		if err = bucket.Put([]byte(seq.Name), data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package sound
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrTooLong is returned when a sound lasts more than the limit
+	ErrTooLong = errors.New("Sound is too long")
+	// ErrUnknownDuration is returned when the duration of a sound can't be
+	// compared to the limit
+	ErrUnknownDuration = errors.New("Duration of the sound is unknown")
+	// ErrLibraryFull is returned when a sound doesn't fit in the library
+	ErrLibraryFull = errors.New("Sounds library is full")
+	// ErrQuotaExceeded is returned when a sound exceeds the quota of its
+	// uploader
+	ErrQuotaExceeded = errors.New("Upload quota exceeded")
+)
+
+// Limits restrict the sounds that can be added to the library. A zero value
+// disables a limit.
+type Limits struct {
+	// MaxDuration is the maximum duration of a sound
+	MaxDuration time.Duration
+	// LibrarySize is the maximum size in bytes of all the sounds
+	LibrarySize int64
+	// Quota is the maximum size in bytes of the sounds of an uploader
+	Quota int64
+}
+
+// Check returns an error if the sound s can't be added to the library. The
+// properties of s must be known, a sound without duration is refused when
+// the duration is limited. A sound of the library with the same name is
+// considered replaced by s.
+func (l Limits) Check(library []Sound, s Sound) error {
+	if l.MaxDuration > 0 && s.Duration <= 0 {
+		return errors.Wrapf(ErrUnknownDuration, "It must be less than %v", l.MaxDuration)
+	}
+	if l.MaxDuration > 0 && s.Duration > l.MaxDuration.Seconds() {
+		return errors.Wrapf(ErrTooLong, "%.1fs is more than the limit of %v", s.Duration, l.MaxDuration)
+	}
+	var total, used int64
+	for _, ss := range library {
+		if ss.Name == s.Name {
+			continue
+		}
+		total += ss.Size
+		if ss.Uploader == s.Uploader {
+			used += ss.Size
+		}
+	}
+	if l.LibrarySize > 0 && total+s.Size > l.LibrarySize {
+		return errors.Wrapf(ErrLibraryFull, "%v left for a sound of %v", FormatSize(l.LibrarySize-total), FormatSize(s.Size))
+	}
+	if l.Quota > 0 && s.Uploader != "" && used+s.Size > l.Quota {
+		return errors.Wrapf(ErrQuotaExceeded, "%v left for a sound of %v", FormatSize(l.Quota-used), FormatSize(s.Size))
+	}
+	return nil
+}
+
+// FormatSize formats a size for humans
+func FormatSize(n int64) string {
+	if n < 0 {
+		n = 0
+	}
+	switch {
+	case n >= 1000*1000:
+		return fmt.Sprintf("%.1f MB", float64(n)/1000/1000)
+	case n >= 1000:
+		return fmt.Sprintf("%.1f kB", float64(n)/1000)
+	}
+	return fmt.Sprintf("%d B", n)
+}
@@ -42,6 +42,30 @@ func (l *loggingSound) UpdateSound(sound Sound) error {
 	return l.Sounder.UpdateSound(sound)
 }
 
+func (l *loggingSound) RenameSound(name, newName string) error {
+	defer func(begin time.Time) {
+		logrus.WithFields(logrus.Fields{
+			"method":  "RenameSound",
+			"name":    name,
+			"newName": newName,
+			"took":    time.Since(begin),
+		}).Info("sound service query")
+	}(time.Now())
+	return l.Sounder.RenameSound(name, newName)
+}
+
+func (l *loggingSound) ReplaceSound(name, filepath string) error {
+	defer func(begin time.Time) {
+		logrus.WithFields(logrus.Fields{
+			"method":   "ReplaceSound",
+			"name":     name,
+			"filepath": filepath,
+			"took":     time.Since(begin),
+		}).Info("sound service query")
+	}(time.Now())
+	return l.Sounder.ReplaceSound(name, filepath)
+}
+
 func (l *loggingSound) DeleteSound(name string) error {
 	defer func(begin time.Time) {
 		logrus.WithFields(logrus.Fields{
@@ -95,3 +119,54 @@ func (l *loggingSound) GetSounds() []Sound {
 	}(time.Now())
 	return l.Sounder.GetSounds()
 }
+
+func (l *loggingSound) RestoreSound(name string) error {
+	defer func(begin time.Time) {
+		logrus.WithFields(logrus.Fields{
+			"method": "RestoreSound",
+			"name":   name,
+			"took":   time.Since(begin),
+		}).Info("sound service query")
+	}(time.Now())
+	return l.Sounder.RestoreSound(name)
+}
+
+func (l *loggingSound) GetDeletedSounds() []DeletedSound {
+	defer func(begin time.Time) {
+		logrus.WithFields(logrus.Fields{
+			"method": "GetDeletedSounds",
+			"took":   time.Since(begin),
+		}).Info("sound service query")
+	}(time.Now())
+	return l.Sounder.GetDeletedSounds()
+}
+
+func (l *loggingSound) SaveSequence(seq Sequence) error {
+	defer func(begin time.Time) {
+		logrus.WithFields(logrus.Fields{
+			"method":   "SaveSequence",
+			"sequence": seq,
+			"took":     time.Since(begin),
+		}).Info("sound service query")
+	}(time.Now())
+	return l.Sounder.SaveSequence(seq)
+}
+
+func (l *loggingSound) DeleteSequence(name string) error {
+	defer func(begin time.Time) {
+		logrus.WithFields(logrus.Fields{
+			"method": "DeleteSequence",
+			"name":   name,
+			"took":   time.Since(begin),
+		}).Info("sound service query")
+	}(time.Now())
+	return l.Sounder.DeleteSequence(name)
+}
+
+// Check verifies the storage of the library, if it supports it
+func (l *loggingSound) Check() error {
+	if c, ok := l.Sounder.(Checker); ok {
+		return c.Check()
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package sound
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// MaxPause is the longest pause of a sequence
+const MaxPause = time.Minute
+
+// ErrSequenceNotFound is returned when a sequence doesn't exist
+var ErrSequenceNotFound = errors.New("Sequence not found")
+
+// Sequence is a named list of sounds, texts and pauses played in order
+type Sequence struct {
+	Name  string `json:"name"`
+	Steps []Step `json:"steps"`
+}
+
+// Step is an element of a sequence: a sound or a tag, a text to say or a
+// pause
+type Step struct {
+	Sound string `json:"sound,omitempty"`
+	Text  string `json:"text,omitempty"`
+	// Pause is a silence in seconds
+	Pause float64 `json:"pause,omitempty"`
+	// Gain is the gain in dB of the sound, set when the sequence is resolved
+	Gain float64 `json:"gain,omitempty"`
+}
+
+// ParseStep parses a step written as the name of a sound or a tag, as
+// "say:" followed by a text, or as "pause:" followed by a duration
+func ParseStep(s string) (Step, error) {
+	switch {
+	case strings.HasPrefix(s, "say:"):
+		return Step{Text: strings.TrimPrefix(s, "say:")}, nil
+	case strings.HasPrefix(s, "pause:"):
+		d, err := time.ParseDuration(strings.TrimPrefix(s, "pause:"))
+		if err != nil {
+			return Step{}, fmt.Errorf("Invalid pause %q, it must be a duration like 1.5s", s)
+		}
+		return Step{Pause: d.Seconds()}, nil
+	}
+	return Step{Sound: s}, nil
+}
+
+// String returns the step written as ParseStep reads it
+func (st Step) String() string {
+	switch {
+	case st.Text != "":
+		return "say:" + st.Text
+	case st.Pause != 0:
+		return "pause:" + st.PauseDuration().String()
+	}
+	return st.Sound
+}
+
+// PauseDuration returns the pause of the step as a duration
+func (st Step) PauseDuration() time.Duration {
+	return time.Duration(st.Pause * float64(time.Second))
+}
+
+// Validate checks that the sequence has steps, and that each step is either
+// a sound or a tag of the library, a text or a pause
+func (seq Sequence) Validate(vault Sounder) error {
+	if len(seq.Steps) == 0 {
+		return errors.New("A sequence needs at least one step")
+	}
+	sounds := vault.GetSounds()
+	for i, st := range seq.Steps {
+		kinds := 0
+		for _, set := range []bool{st.Sound != "", st.Text != "", st.Pause != 0} {
+			if set {
+				kinds++
+			}
+		}
+		switch {
+		case kinds != 1:
+			return errors.Errorf("Step %d must be either a sound, a text or a pause", i+1)
+		case st.Pause < 0 || st.PauseDuration() > MaxPause:
+			return errors.Errorf("Pause of step %d must be between 0 and %v", i+1, MaxPause)
+		case st.Sound != "" && !Exists(sounds, st.Sound):
+			return errors.Errorf("No sound or tag named %v at step %d", st.Sound, i+1)
+		}
+	}
+	return nil
+}
+
+// renameSound returns the sequence where the sound name is replaced by
+// newName in the steps, and false if no step plays name
+func (seq Sequence) renameSound(name, newName string) (Sequence, bool) {
+	renamed := false
+	steps := make([]Step, len(seq.Steps))
+	for i, st := range seq.Steps {
+		if st.Sound == name {
+			st.Sound = newName
+			renamed = true
+		}
+		steps[i] = st
+	}
+	seq.Steps = steps
+	return seq, renamed
+}
+
+// Exists returns true if name is a sound or a tag of the sounds
+func Exists(sounds []Sound, name string) bool {
+	for _, s := range sounds {
+		if s.Name == name || contains(s.Tags, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolve returns the sequence where the tags are replaced by a random sound
+// having them, as they would be played, with the gain of the sounds
+func (seq Sequence) Resolve(vault Sounder) (Sequence, error) {
+	sounds := vault.GetSounds()
+	out := Sequence{Name: seq.Name, Steps: make([]Step, len(seq.Steps))}
+	for i, st := range seq.Steps {
+		out.Steps[i] = st
+		if st.Sound == "" {
+			continue
+		}
+		s, err := pick(sounds, st.Sound)
+		if err != nil {
+			return out, err
+		}
+		out.Steps[i].Sound, out.Steps[i].Gain = s.Name, s.Gain()
+	}
+	return out, nil
+}
+
+// Pick returns the sound with the given name, or a random sound having the
+// tag of the same name, as it would be played
+func Pick(vault Sounder, name string) (Sound, error) {
+	return pick(vault.GetSounds(), name)
+}
+
+func pick(sounds []Sound, name string) (Sound, error) {
+	var playable []Sound
+	for _, s := range sounds {
+		if s.Name == name {
+			return s, nil
+		}
+		if contains(s.Tags, name) {
+			playable = append(playable, s)
+		}
+	}
+	if len(playable) == 0 {
+		return Sound{}, ErrNoTagMatch(name)
+	}
+	return playable[rand.Int()%len(playable)], nil
+}
@@ -0,0 +1,83 @@
+package sound
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SortKeys are the fields by which sounds can be sorted
+var SortKeys = []string{"name", "duration", "size", "sample_rate", "channels", "loudness", "uploaded_at", "uploader"}
+
+func compareFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func compareTime(a, b time.Time) int {
+	switch {
+	case a.Before(b):
+		return -1
+	case a.After(b):
+		return 1
+	}
+	return 0
+}
+
+// unknown values are sorted before the known ones
+func loudness(s Sound) float64 {
+	if s.Loudness == nil {
+		return math.Inf(-1)
+	}
+	return *s.Loudness
+}
+
+func uploadedAt(s Sound) time.Time {
+	if s.UploadedAt == nil {
+		return time.Time{}
+	}
+	return *s.UploadedAt
+}
+
+var comparators = map[string]func(a, b Sound) int{
+	"name":        func(a, b Sound) int { return strings.Compare(a.Name, b.Name) },
+	"duration":    func(a, b Sound) int { return compareFloat(a.Duration, b.Duration) },
+	"size":        func(a, b Sound) int { return compareFloat(float64(a.Size), float64(b.Size)) },
+	"sample_rate": func(a, b Sound) int { return compareFloat(float64(a.SampleRate), float64(b.SampleRate)) },
+	"channels":    func(a, b Sound) int { return compareFloat(float64(a.Channels), float64(b.Channels)) },
+	"loudness":    func(a, b Sound) int { return compareFloat(loudness(a), loudness(b)) },
+	"uploaded_at": func(a, b Sound) int { return compareTime(uploadedAt(a), uploadedAt(b)) },
+	"uploader":    func(a, b Sound) int { return strings.Compare(a.Uploader, b.Uploader) },
+}
+
+// Sort sorts the sounds by one of the SortKeys, prefixed with "-" for a
+// descending order. Sounds with equal keys are sorted by name.
+func Sort(sounds []Sound, by string) error {
+	desc := strings.HasPrefix(by, "-")
+	by = strings.TrimPrefix(by, "-")
+	if by == "" {
+		by = "name"
+	}
+	compare, ok := comparators[by]
+	if !ok {
+		return fmt.Errorf("Unknown sort key %q, please use one of %v", by, strings.Join(SortKeys, ", "))
+	}
+	sort.SliceStable(sounds, func(i, j int) bool {
+		c := compare(sounds[i], sounds[j])
+		if desc {
+			c = -c
+		}
+		if c == 0 {
+			return sounds[i].Name < sounds[j].Name
+		}
+		return c < 0
+	})
+	return nil
+}
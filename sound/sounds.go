@@ -1,5 +1,6 @@
 // Package sound describe what a sound service is and propose an
-// inMemory implematation of such service
+// inMemory implematation of such service, persisted in a json file, and an
+// implementation backed by a bolt database
 package sound
 
 import (
@@ -11,6 +12,7 @@ import (
 	"path/filepath"
 	"sort"
 	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/restanrm/bell/player"
@@ -22,23 +24,61 @@ import (
 type Sounder interface {
 	CreateSound(name, filepath string, tags ...string) error
 	UpdateSound(sound Sound) error
+	RenameSound(name, newName string) error
+	ReplaceSound(name, filepath string) error
 	DeleteSound(name string) error
 	PlaySound(name string, player player.Player) error
 	PlaySoundByTag(tag string, player player.Player) error
 	GetSound(name string) ([]byte, error)
 	GetSounds() []Sound
+	RestoreSound(name string) error
+	GetDeletedSounds() []DeletedSound
+	GetSequences() []Sequence
+	GetSequence(name string) (Sequence, error)
+	SaveSequence(seq Sequence) error
+	DeleteSequence(name string) error
+}
+
+// Checker is implemented by the libraries able to verify their storage
+type Checker interface {
+	Check() error
 }
 
 // Sound is the struct to represent a sound
 type Sound struct {
 	Name     string   `json:"name"`
-	filePath string   `json:"file_name"`
+	FilePath string   `json:"-"`
 	Tags     []string `json:"tags,omitempty"`
+	// Loudness is the integrated loudness of the sound in LUFS
+	Loudness *float64 `json:"loudness,omitempty"`
+	// Volume is a manual gain in dB overriding the loudness normalization
+	Volume *float64 `json:"volume,omitempty"`
+	Properties
+}
+
+// Properties describes the audio content of a sound and its upload
+type Properties struct {
+	// Duration is the length of the sound in seconds
+	Duration   float64 `json:"duration,omitempty"`
+	SampleRate int     `json:"sample_rate,omitempty"`
+	Channels   int     `json:"channels,omitempty"`
+	// Size is the size of the audio file in bytes
+	Size int64 `json:"size,omitempty"`
+	// Hash is the sha256 of the audio file
+	Hash       string     `json:"hash,omitempty"`
+	UploadedAt *time.Time `json:"uploaded_at,omitempty"`
+	Uploader   string     `json:"uploader,omitempty"`
 }
 
 type inMemorySounds struct {
 	configFile string
+	backups    int
 	m          map[string]Sound
+	sequences  map[string]Sequence
+	trash      *trash
+	// loadErr is the error of the loading of the store, if it couldn't be
+	// recovered
+	loadErr error
 	sync.RWMutex
 }
 
@@ -49,8 +89,10 @@ var (
 	ErrSoundNotFound     = errors.New("Sound not found")
 )
 
-// New create a new instance of a sounder
-func New(filepath string) *inMemorySounds {
+// New create a new instance of a sounder. The configuration file is saved
+// with the given number of backup generations. If it can't be loaded, the
+// sounds are recovered from the most recent valid backup.
+func New(filepath string, backups int) *inMemorySounds {
 	err := dirExist(filepath)
 	if err != nil {
 		logrus.Fatal(errors.Wrapf(err, "Failed to find or create directory to store configuration file"))
@@ -58,18 +100,42 @@ func New(filepath string) *inMemorySounds {
 	}
 	ims := &inMemorySounds{
 		configFile: filepath,
+		backups:    backups,
 		m:          make(map[string]Sound),
+		sequences:  make(map[string]Sequence),
+		trash:      newTrash(),
+	}
+	seqs, err := loadSequences(ims.sequencesFile())
+	if err != nil && !os.IsNotExist(errors.Cause(err)) {
+		logrus.WithError(err).Warn("Failed to load the sequences")
+	}
+	for _, seq := range seqs {
+		ims.sequences[seq.Name] = seq
 	}
-	ss, err := load(filepath)
+	ss, from, err := recoverStore(filepath, backups)
 	if err != nil {
 		logrus.WithFields(logrus.Fields{
 			"error": err,
 		}).Warn("An error happened when loading sounds database")
-	} else {
-		ims.Lock()
-		defer ims.Unlock()
-		for _, sound := range ss {
-			ims.m[sound.Name] = sound
+		if !os.IsNotExist(errors.Cause(err)) {
+			ims.loadErr = err
+		}
+		return ims
+	}
+
+	ims.Lock()
+	defer ims.Unlock()
+	for _, sound := range ss {
+		ims.m[sound.Name] = sound
+	}
+	if from != filepath {
+		logrus.WithFields(logrus.Fields{
+			"file":   filepath,
+			"from":   from,
+			"sounds": len(ss),
+		}).Warn("Sounds database recovered from backup")
+		if err = ims.save(); err != nil {
+			logrus.WithError(err).Error("Failed to save the recovered sounds database")
 		}
 	}
 	return ims
@@ -96,15 +162,13 @@ type ssto struct {
 	Name     string   `json:"name"`
 	FileName string   `json:"file_name"`
 	Tags     []string `json:"tags"`
+	Loudness *float64 `json:"loudness,omitempty"`
+	Volume   *float64 `json:"volume,omitempty"`
+	Properties
 }
 
 func load(fp string) ([]Sound, error) {
-	fd, err := os.Open(fp)
-	if err != nil {
-		return nil, err
-	}
-
-	data, err := ioutil.ReadAll(fd)
+	data, err := ioutil.ReadFile(fp)
 	if err != nil {
 		return nil, err
 	}
@@ -117,19 +181,42 @@ func load(fp string) ([]Sound, error) {
 
 	var output []Sound
 	for _, s := range ss {
-		output = append(output, Sound{
-			Name:     s.Name,
-			filePath: filepath.Join(viper.GetString("soundDir"), s.FileName),
-			Tags:     s.Tags,
-		})
+		output = append(output, s.sound())
 	}
 	return output, nil
 }
 
+// record returns the representation of the sound as it is stored
+func (s Sound) record() ssto {
+	return ssto{
+		Name:       s.Name,
+		FileName:   filepath.Base(s.FilePath),
+		Tags:       s.Tags,
+		Loudness:   s.Loudness,
+		Volume:     s.Volume,
+		Properties: s.Properties,
+	}
+}
+
+// sound returns the sound described by the stored record
+func (r ssto) sound() Sound {
+	return Sound{
+		Name:       r.Name,
+		FilePath:   filepath.Join(viper.GetString("soundDir"), r.FileName),
+		Tags:       r.Tags,
+		Loudness:   r.Loudness,
+		Volume:     r.Volume,
+		Properties: r.Properties,
+	}
+}
+
 // Load some sounds into collection
 func Load(file string) Sounder {
 	sounds := &inMemorySounds{
-		m: make(map[string]Sound),
+		configFile: file,
+		m:          make(map[string]Sound),
+		sequences:  make(map[string]Sequence),
+		trash:      newTrash(),
 	}
 	sounds.Lock()
 	defer sounds.Unlock()
@@ -137,33 +224,41 @@ func Load(file string) Sounder {
 	return sounds
 }
 
-func (s inMemorySounds) save() error {
-	var ss []ssto
-	for k, v := range s.m {
-		ss = append(ss, ssto{Name: k, FileName: filepath.Base(v.filePath), Tags: v.Tags})
+// Check returns the error of the loading of the store, if it failed and no
+// backup could be recovered
+func (s *inMemorySounds) Check() error {
+	if s.loadErr != nil {
+		return errors.Wrapf(s.loadErr, "Failed to load the store %v", s.configFile)
 	}
+	return nil
+}
 
-	f, err := os.OpenFile(s.configFile, os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		return errors.Wrapf(err, "Failed to open configuration file to write new content")
+func (s *inMemorySounds) save() error {
+	var ss []ssto
+	for _, v := range s.m {
+		ss = append(ss, v.record())
 	}
-	defer f.Close()
+	sort.Slice(ss, func(i, j int) bool { return ss[i].Name < ss[j].Name })
 
-	err = json.NewEncoder(f).Encode(ss)
+	data, err := json.Marshal(ss)
 	if err != nil {
 		return errors.Wrapf(err, "Failed to encode store as json struct")
 	}
+	err = writeAtomic(s.configFile, data, s.backups)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to write new content of the configuration file")
+	}
 	return nil
 }
 
 // CreateSound a new sound in a collections. The file is already on the disk
-func (s inMemorySounds) CreateSound(name, filepath string, tags ...string) error {
+func (s *inMemorySounds) CreateSound(name, filepath string, tags ...string) error {
 	s.Lock()
 	defer s.Unlock()
 
 	ss := Sound{
 		Name:     name,
-		filePath: filepath,
+		FilePath: filepath,
 		Tags:     tags,
 	}
 	s.m[name] = ss
@@ -176,9 +271,16 @@ func (s inMemorySounds) CreateSound(name, filepath string, tags ...string) error
 }
 
 // UpdateSound a sound in a collection
-func (s inMemorySounds) UpdateSound(sound Sound) error {
+func (s *inMemorySounds) UpdateSound(sound Sound) error {
 	s.Lock()
 	defer s.Unlock()
+	old, ok := s.m[sound.Name]
+	if !ok {
+		return ErrSoundNotFound
+	}
+	if sound.FilePath == "" {
+		sound.FilePath = old.FilePath
+	}
 	s.m[sound.Name] = sound
 	err := s.save()
 	if err != nil {
@@ -187,43 +289,262 @@ func (s inMemorySounds) UpdateSound(sound Sound) error {
 	return nil
 }
 
-// DeleteSound remove sound from a collection
-func (s inMemorySounds) DeleteSound(name string) error {
+// RenameSound changes the name of a sound. Its file is renamed after the new
+// name unless it is shared with other sounds.
+func (s *inMemorySounds) RenameSound(name, newName string) error {
 	s.Lock()
 	defer s.Unlock()
-	if _, ok := s.m[name]; !ok {
+	ss, ok := s.m[name]
+	if !ok {
 		return ErrSoundNotFound
 	}
+	if _, ok := s.m[newName]; ok {
+		return ErrSoundAlreadyExist
+	}
+	renamed, err := renameFile(ss, newName, s.list())
+	if err != nil {
+		return err
+	}
 	delete(s.m, name)
+	s.m[newName] = renamed
 
+	// the steps of the sequences follow the sound
+	previous := make(map[string]Sequence)
+	for _, seq := range s.sequences {
+		if seq, ok := seq.renameSound(name, newName); ok {
+			previous[seq.Name] = s.sequences[seq.Name]
+			s.sequences[seq.Name] = seq
+		}
+	}
+	undo := func() {
+		for n, seq := range previous {
+			s.sequences[n] = seq
+		}
+		delete(s.m, newName)
+		s.m[name] = ss
+		undoRename(ss, renamed)
+	}
+
+	err = s.save()
+	if err != nil {
+		undo()
+		return errors.Wrapf(err, "Failed to save the current state of the sound library")
+	}
+	if len(previous) > 0 {
+		if err = s.saveSequences(); err != nil {
+			undo()
+			if serr := s.save(); serr != nil {
+				logrus.WithError(serr).Error("Failed to restore the state of the sound library")
+			}
+			return errors.Wrapf(err, "Failed to save the sequences")
+		}
+	}
 	return nil
 }
 
-// PlaySound is playing a sound from a sound collection
-func (s inMemorySounds) PlaySound(name string, player player.Player) error {
-	s.RLock()
-	defer s.RUnlock()
+// ReplaceSound replaces the audio content of a sound with the file at fp.
+// The file is moved in the sound directory.
+func (s *inMemorySounds) ReplaceSound(name, fp string) error {
+	s.Lock()
+	defer s.Unlock()
+	ss, ok := s.m[name]
+	if !ok {
+		return ErrSoundNotFound
+	}
+	replaced, done, undo, err := replaceFile(ss, fp, s.list())
+	if err != nil {
+		return err
+	}
+	s.m[name] = replaced
+
+	err = s.save()
+	if err != nil {
+		s.m[name] = ss
+		undo()
+		return errors.Wrapf(err, "Failed to save the current state of the sound library")
+	}
+	done()
+	return nil
+}
+
+// DeleteSound remove sound from a collection. Its file is moved to the trash
+// where it can be restored until the retention period expires.
+func (s *inMemorySounds) DeleteSound(name string) error {
+	s.Lock()
+	defer s.Unlock()
 	ss, ok := s.m[name]
 	if !ok {
-		return s.PlaySoundByTag(name, player)
+		return ErrSoundNotFound
+	}
+	cancel, err := s.trash.put(ss, ss.FilePath)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to move sound to trash")
+	}
+	delete(s.m, name)
+
+	err = s.save()
+	if err != nil {
+		s.m[name] = ss
+		cancel()
+		return errors.Wrapf(err, "Failed to save the current state of the sound library")
+	}
+	if !shared(ss, s.list()) {
+		if err = os.Remove(ss.FilePath); err != nil {
+			logrus.WithError(err).WithField("filepath", ss.FilePath).Warn("Failed to remove sound file")
+		}
 	}
-	go func() {
-		player.PlayFilepath(ss.filePath)
-	}()
 	return nil
 }
 
-func (s inMemorySounds) PlaySoundByTag(tag string, player player.Player) error {
+// RestoreSound put back in the collection a sound from the trash
+func (s *inMemorySounds) RestoreSound(name string) error {
+	s.Lock()
+	defer s.Unlock()
+	if _, ok := s.m[name]; ok {
+		return ErrSoundAlreadyExist
+	}
+	ss, err := s.trash.take(name)
+	if err != nil {
+		return err
+	}
+	s.m[name] = ss
+
+	err = s.save()
+	if err != nil {
+		delete(s.m, name)
+		s.trash.untake(ss, s.list())
+		return errors.Wrapf(err, "Failed to save the current state of the sound library")
+	}
+	return nil
+}
+
+// GetDeletedSounds returns the sounds of the trash
+func (s *inMemorySounds) GetDeletedSounds() []DeletedSound {
+	return s.trash.list()
+}
+
+// sequencesFile returns the path of the file of the sequences, next to the
+// store file
+func (s *inMemorySounds) sequencesFile() string {
+	return filepath.Join(filepath.Dir(s.configFile), "sequences.json")
+}
+
+func loadSequences(fp string) ([]Sequence, error) {
+	data, err := ioutil.ReadFile(fp)
+	if err != nil {
+		return nil, err
+	}
+	var seqs []Sequence
+	if err = json.Unmarshal(data, &seqs); err != nil {
+		return nil, errors.Wrapf(err, "Failed to decode sequences file %v", fp)
+	}
+	return seqs, nil
+}
+
+// saveSequences writes the sequences. Caller must hold the lock.
+func (s *inMemorySounds) saveSequences() error {
+	data, err := json.Marshal(s.listSequences())
+	if err != nil {
+		return errors.Wrapf(err, "Failed to encode sequences as json")
+	}
+	return writeAtomic(s.sequencesFile(), data, s.backups)
+}
+
+// listSequences returns the sequences sorted by name. Caller must hold the
+// lock.
+func (s *inMemorySounds) listSequences() []Sequence {
+	out := make([]Sequence, 0, len(s.sequences))
+	for _, seq := range s.sequences {
+		out = append(out, seq)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// GetSequences returns the sequences sorted by name
+func (s *inMemorySounds) GetSequences() []Sequence {
 	s.RLock()
 	defer s.RUnlock()
-	contains := func(list []string, el string) bool {
-		for _, a := range list {
-			if a == el {
-				return true
-			}
+	return s.listSequences()
+}
+
+// GetSequence returns a sequence
+func (s *inMemorySounds) GetSequence(name string) (Sequence, error) {
+	s.RLock()
+	defer s.RUnlock()
+	seq, ok := s.sequences[name]
+	if !ok {
+		return seq, ErrSequenceNotFound
+	}
+	return seq, nil
+}
+
+// SaveSequence creates or replaces a sequence
+func (s *inMemorySounds) SaveSequence(seq Sequence) error {
+	s.Lock()
+	defer s.Unlock()
+	old, existed := s.sequences[seq.Name]
+	s.sequences[seq.Name] = seq
+	if err := s.saveSequences(); err != nil {
+		if existed {
+			s.sequences[seq.Name] = old
+		} else {
+			delete(s.sequences, seq.Name)
+		}
+		return errors.Wrapf(err, "Failed to save the sequences")
+	}
+	return nil
+}
+
+// DeleteSequence removes a sequence
+func (s *inMemorySounds) DeleteSequence(name string) error {
+	s.Lock()
+	defer s.Unlock()
+	seq, ok := s.sequences[name]
+	if !ok {
+		return ErrSequenceNotFound
+	}
+	delete(s.sequences, name)
+	if err := s.saveSequences(); err != nil {
+		s.sequences[name] = seq
+		return errors.Wrapf(err, "Failed to save the sequences")
+	}
+	return nil
+}
+
+// PlaySound is playing a sound from a sound collection. If no sound match the
+// name, a random sound with the tag of the same name is played.
+// The player is called synchronously, it is up to the player to queue the
+// sound if the call must not block.
+func (s *inMemorySounds) PlaySound(name string, p player.Player) error {
+	s.RLock()
+	ss, ok := s.m[name]
+	if !ok {
+		var err error
+		ss, err = s.pickByTag(name)
+		if err != nil {
+			s.RUnlock()
+			return err
 		}
-		return false
 	}
+	s.RUnlock()
+	return player.PlayWithGain(p, ss.FilePath, ss.Gain())
+}
+
+// PlaySoundByTag plays a random sound having the given tag
+func (s *inMemorySounds) PlaySoundByTag(tag string, p player.Player) error {
+	s.RLock()
+	ss, err := s.pickByTag(tag)
+	s.RUnlock()
+	if err != nil {
+		return err
+	}
+	return player.PlayWithGain(p, ss.FilePath, ss.Gain())
+}
+
+// pickByTag returns a random sound having the given tag. Caller must hold the
+// lock.
+func (s *inMemorySounds) pickByTag(tag string) (Sound, error) {
 	// build list of playable
 	var playable []Sound
 	for _, v := range s.m {
@@ -232,15 +553,29 @@ func (s inMemorySounds) PlaySoundByTag(tag string, player player.Player) error {
 		}
 	}
 	if len(playable) == 0 {
-		return ErrNoTagMatch(tag)
+		return Sound{}, ErrNoTagMatch(tag)
+	}
+	return playable[rand.Int()%len(playable)], nil
+}
+
+func contains(list []string, el string) bool {
+	for _, a := range list {
+		if a == el {
+			return true
+		}
 	}
-	return s.PlaySound(playable[rand.Int()%len(playable)].Name, player)
+	return false
 }
 
 // GetSounds return a list of sounds for inMemoryImplementation of the service
-func (s inMemorySounds) GetSounds() []Sound {
+func (s *inMemorySounds) GetSounds() []Sound {
 	s.RLock()
 	defer s.RUnlock()
+	return s.list()
+}
+
+// list returns the sounds sorted by name. Caller must hold the lock.
+func (s *inMemorySounds) list() []Sound {
 	var out []Sound
 	for _, v := range s.m {
 		out = append(out, v)
@@ -249,36 +584,16 @@ func (s inMemorySounds) GetSounds() []Sound {
 	return out
 }
 
-func (s inMemorySounds) GetSound(name string) (ret []byte, err error) {
+func (s *inMemorySounds) GetSound(name string) (ret []byte, err error) {
 	s.RLock()
-	defer s.RUnlock()
 	ss, ok := s.m[name]
 	if !ok {
-		return s.getSoundByTag(name)
-	}
-	return ioutil.ReadFile(ss.filePath)
-}
-
-func (s inMemorySounds) getSoundByTag(tag string) (ret []byte, err error) {
-	s.RLock()
-	defer s.RUnlock()
-	contains := func(list []string, el string) bool {
-		for _, a := range list {
-			if a == el {
-				return true
-			}
-		}
-		return false
-	}
-	// build list of playable
-	var playable []Sound
-	for _, v := range s.m {
-		if contains(v.Tags, tag) {
-			playable = append(playable, v)
+		ss, err = s.pickByTag(name)
+		if err != nil {
+			s.RUnlock()
+			return nil, ErrSoundNotFound
 		}
 	}
-	if len(playable) == 0 {
-		return nil, ErrSoundNotFound
-	}
-	return ioutil.ReadFile(playable[rand.Int()%len(playable)].filePath)
+	s.RUnlock()
+	return ioutil.ReadFile(ss.FilePath)
 }
@@ -0,0 +1,237 @@
+package sound
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// backupName returns the name of the nth backup generation of a store file
+func backupName(fp string, n int) string {
+	return fmt.Sprintf("%v.bak.%d", fp, n)
+}
+
+// writeAtomic replaces the content of the file fp with data. The content is
+// written in a temporary file which is synced then renamed over fp, so fp
+// always holds either the old or the new content. Before the replacement, the
+// previous content is kept in the given number of rotating backups.
+func writeAtomic(fp string, data []byte, backups int) error {
+	dir := filepath.Dir(fp)
+	tmp, err := os.OpenFile(fp+".tmp", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to create temporary file")
+	}
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return errors.Wrapf(err, "Failed to write temporary file")
+	}
+
+	if backups > 0 {
+		if err = rotate(fp, backups); err != nil {
+			logrus.WithError(err).WithField("file", fp).Warn("Failed to rotate backups of the store")
+		}
+	}
+
+	if err = os.Rename(tmp.Name(), fp); err != nil {
+		os.Remove(tmp.Name())
+		return errors.Wrapf(err, "Failed to replace %v", fp)
+	}
+	return syncDir(dir)
+}
+
+// rotate shifts the backup generations of fp and keeps the current content of
+// fp as first generation. fp is left in place.
+func rotate(fp string, backups int) error {
+	if _, err := os.Stat(fp); os.IsNotExist(err) {
+		return nil
+	}
+	os.Remove(backupName(fp, backups))
+	for i := backups - 1; i >= 1; i-- {
+		err := os.Rename(backupName(fp, i), backupName(fp, i+1))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return copyFile(fp, backupName(fp, 1))
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(out, in); err == nil {
+		err = out.Sync()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// syncDir flushes the directory entries so a rename survives a crash
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	if err = d.Sync(); err != nil {
+		return errors.Wrapf(err, "Failed to sync directory %v", dir)
+	}
+	return nil
+}
+
+// recoverStore loads the store file fp. If it's missing or corrupted, the
+// backup generations are tried from the most recent one. It returns the
+// sounds and the file they have been loaded from. A corrupted store file is
+// kept aside with a ".corrupt-<timestamp>" suffix, like
+// store.json.corrupt-20191104-153012.
+func recoverStore(fp string, backups int) ([]Sound, string, error) {
+	ss, err := load(fp)
+	if err == nil {
+		return ss, fp, nil
+	}
+	if os.IsNotExist(errors.Cause(err)) {
+		// nothing to recover if the store has never been written
+		if _, berr := os.Stat(backupName(fp, 1)); os.IsNotExist(berr) {
+			return nil, "", err
+		}
+	} else {
+		corrupt := fmt.Sprintf("%v.corrupt-%v", fp, time.Now().Format("20060102-150405"))
+		if rerr := os.Rename(fp, corrupt); rerr == nil {
+			logrus.WithFields(logrus.Fields{
+				"file":  fp,
+				"moved": corrupt,
+			}).WithError(err).Warn("Store file is corrupted, it has been moved aside")
+		}
+	}
+
+	for i := 1; i <= backups; i++ {
+		bak := backupName(fp, i)
+		ss, berr := load(bak)
+		if berr != nil {
+			if !os.IsNotExist(errors.Cause(berr)) {
+				logrus.WithError(berr).WithField("file", bak).Warn("Backup of the store is not valid")
+			}
+			continue
+		}
+		return ss, bak, nil
+	}
+	return nil, "", errors.Wrapf(err, "No valid backup of the store found")
+}
+
+// soundFile returns the path where the file of the named sound is stored in
+// the sound directory. The extension of fp is kept.
+func soundFile(name, fp string) string {
+	ext := filepath.Ext(fp)
+	if ext == "" {
+		ext = ".mp3"
+	}
+	return filepath.Join(viper.GetString("soundDir"), name+ext)
+}
+
+// renameFile renames the file of the sound s after newName and returns the
+// renamed sound. The file is left untouched if it is shared with other sounds
+// of the library.
+func renameFile(s Sound, newName string, sounds []Sound) (Sound, error) {
+	renamed := s
+	renamed.Name = newName
+	if shared(s, sounds) {
+		return renamed, nil
+	}
+	fp := soundFile(newName, s.FilePath)
+	if _, err := os.Stat(fp); err == nil {
+		return Sound{}, errors.Errorf("File %v already exists", fp)
+	}
+	if err := os.Rename(s.FilePath, fp); err != nil {
+		return Sound{}, errors.Wrapf(err, "Failed to rename sound file")
+	}
+	renamed.FilePath = fp
+	return renamed, nil
+}
+
+// undoRename puts back the file of the sound s renamed by renameFile
+func undoRename(s, renamed Sound) {
+	if renamed.FilePath == s.FilePath {
+		return
+	}
+	if err := os.Rename(renamed.FilePath, s.FilePath); err != nil {
+		logrus.WithError(err).WithField("filepath", renamed.FilePath).Error("Failed to rename back sound file")
+	}
+}
+
+// replaceFile moves fp in the sound directory as the file of the sound s and
+// returns the updated sound. The previous file is kept until the library is
+// saved: done removes it, unless it is shared with other sounds, and undo
+// puts it back and moves the new file back to fp.
+func replaceFile(s Sound, fp string, sounds []Sound) (replaced Sound, done, undo func(), err error) {
+	replaced = s
+	replaced.FilePath = soundFile(s.Name, fp)
+	isShared := shared(s, sounds)
+	if isShared && replaced.FilePath == s.FilePath {
+		return Sound{}, nil, nil, errors.Errorf("File %v is shared with other sounds", s.FilePath)
+	}
+	if err := dirExist(replaced.FilePath); err != nil {
+		return Sound{}, nil, nil, err
+	}
+	// the new file takes the place of the previous one, which is set aside
+	previous := ""
+	if replaced.FilePath == s.FilePath {
+		previous = s.FilePath + ".previous"
+		if err := os.Rename(s.FilePath, previous); err != nil {
+			if !os.IsNotExist(err) {
+				return Sound{}, nil, nil, errors.Wrapf(err, "Failed to keep previous sound file")
+			}
+			previous = ""
+		}
+	}
+	if err := os.Rename(fp, replaced.FilePath); err != nil {
+		if previous != "" {
+			os.Rename(previous, s.FilePath)
+		}
+		return Sound{}, nil, nil, errors.Wrapf(err, "Failed to move new sound file")
+	}
+	done = func() {
+		old := previous
+		if old == "" && replaced.FilePath != s.FilePath && !isShared {
+			old = s.FilePath
+		}
+		if old == "" {
+			return
+		}
+		if err := os.Remove(old); err != nil {
+			logrus.WithError(err).WithField("filepath", old).Warn("Failed to remove previous sound file")
+		}
+	}
+	undo = func() {
+		if err := os.Rename(replaced.FilePath, fp); err != nil {
+			logrus.WithError(err).WithField("filepath", replaced.FilePath).Error("Failed to move back new sound file")
+		}
+		if previous == "" {
+			return
+		}
+		if err := os.Rename(previous, s.FilePath); err != nil {
+			logrus.WithError(err).WithField("filepath", previous).Error("Failed to restore previous sound file")
+		}
+	}
+	return replaced, done, undo, nil
+}
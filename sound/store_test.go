@@ -0,0 +1,199 @@
+package sound
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	bolt "go.etcd.io/bbolt"
+)
+
+// soundDir creates a sound directory for the test and returns the data
+// directory containing it, along with the trash
+func soundDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "bell-sound")
+	if err != nil {
+		t.Fatal(err)
+	}
+	viper.Set("soundDir", filepath.Join(dir, "sounds"))
+	viper.Set("trashDir", filepath.Join(dir, "trash"))
+	viper.Set("trash.retention", time.Hour)
+	if err := os.Mkdir(filepath.Join(dir, "sounds"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// writeSound writes a sound file of the sound directory and returns its path
+func writeSound(t *testing.T, name, content string) string {
+	fp := filepath.Join(viper.GetString("soundDir"), name)
+	if err := ioutil.WriteFile(fp, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return fp
+}
+
+func checkFile(t *testing.T, fp, content string) {
+	t.Helper()
+	data, err := ioutil.ReadFile(fp)
+	if err != nil {
+		t.Errorf("%v: %v", fp, err)
+		return
+	}
+	if string(data) != content {
+		t.Errorf("%v contains %q, want %q", fp, data, content)
+	}
+}
+
+func checkNoFile(t *testing.T, fp string) {
+	t.Helper()
+	if _, err := os.Stat(fp); !os.IsNotExist(err) {
+		t.Errorf("%v exists", fp)
+	}
+}
+
+func checkNames(t *testing.T, vault Sounder, names ...string) {
+	t.Helper()
+	sounds := vault.GetSounds()
+	if len(sounds) != len(names) {
+		t.Fatalf("got %d sounds, want %v", len(sounds), names)
+	}
+	for i, s := range sounds {
+		if s.Name != names[i] {
+			t.Errorf("sound %d is %v, want %v", i, s.Name, names[i])
+		}
+	}
+}
+
+func TestJSONStoreSaveFailure(t *testing.T) {
+	dir := soundDir(t)
+	defer os.RemoveAll(dir)
+	store := filepath.Join(dir, "store.json")
+	s := New(store, 0)
+	a := writeSound(t, "a.mp3", "a")
+	if err := s.CreateSound("a", a); err != nil {
+		t.Fatal(err)
+	}
+
+	// the store can't be written while its temporary file is a directory
+	blocker := store + ".tmp"
+	if err := os.Mkdir(blocker, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RenameSound("a", "b"); err == nil {
+		t.Fatal("the rename should fail")
+	}
+	checkNames(t, s, "a")
+	checkFile(t, a, "a")
+	checkNoFile(t, filepath.Join(viper.GetString("soundDir"), "b.mp3"))
+
+	upload := filepath.Join(viper.GetString("soundDir"), "a-upload.mp3")
+	writeSound(t, "a-upload.mp3", "new")
+	if err := s.ReplaceSound("a", upload); err == nil {
+		t.Fatal("the replacement should fail")
+	}
+	checkFile(t, a, "a")
+	checkFile(t, upload, "new")
+
+	os.Remove(blocker)
+	if err := s.ReplaceSound("a", upload); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, a, "new")
+	checkNoFile(t, upload)
+	checkNoFile(t, a+".previous")
+
+	// the store on disk matches the library
+	checkNames(t, New(store, 0), "a")
+}
+
+func TestBoltRenameFailure(t *testing.T) {
+	dir := soundDir(t)
+	defer os.RemoveAll(dir)
+	b, err := NewBolt(filepath.Join(dir, "bell.db"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	a := writeSound(t, "a.mp3", "a")
+	if err := b.CreateSound("a", a); err != nil {
+		t.Fatal(err)
+	}
+
+	// a sequence without name can't be saved, which aborts the transaction
+	err = b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(sequencesBucket).Put([]byte("broken"), []byte(`{"name":"","steps":[{"sound":"a"}]}`))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.RenameSound("a", "b"); err == nil {
+		t.Fatal("the rename should fail")
+	}
+	checkNames(t, b, "a")
+	checkFile(t, a, "a")
+	checkNoFile(t, filepath.Join(viper.GetString("soundDir"), "b.mp3"))
+}
+
+func TestBoltRestoreKeepsProperties(t *testing.T) {
+	for _, blobs := range []bool{false, true} {
+		dir := soundDir(t)
+		b, err := NewBolt(filepath.Join(dir, "bell.db"), blobs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := b.CreateSound("a", writeSound(t, "a.mp3", "a"), "tag"); err != nil {
+			t.Fatal(err)
+		}
+		loudness, volume := -18.5, -3.0
+		uploadedAt := time.Date(2024, 3, 11, 9, 30, 0, 0, time.UTC)
+		want := Sound{
+			Name:     "a",
+			Tags:     []string{"tag"},
+			Loudness: &loudness,
+			Volume:   &volume,
+			Properties: Properties{
+				Duration:   1.5,
+				SampleRate: 44100,
+				Channels:   2,
+				Size:       1,
+				Hash:       "ca978112ca1bbdcafac231b39a23dc4da786eff8147c4e72b9807785afee48bb",
+				UploadedAt: &uploadedAt,
+				Uploader:   "alice",
+			},
+		}
+		if err := b.UpdateSound(want); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := b.DeleteSound("a"); err != nil {
+			t.Fatal(err)
+		}
+		if err := b.RestoreSound("a"); err != nil {
+			t.Fatal(err)
+		}
+		got := b.GetSounds()
+		if len(got) != 1 {
+			t.Fatalf("blobs %v: got %d sounds, want 1", blobs, len(got))
+		}
+		s := got[0]
+		if s.Name != want.Name || len(s.Tags) != 1 || s.Tags[0] != "tag" ||
+			s.Loudness == nil || *s.Loudness != loudness || s.Volume == nil || *s.Volume != volume ||
+			s.Properties.UploadedAt == nil || !s.Properties.UploadedAt.Equal(uploadedAt) {
+			t.Errorf("blobs %v: restored %+v, want %+v", blobs, s, want)
+		}
+		s.Properties.UploadedAt, want.Properties.UploadedAt = nil, nil
+		if s.Properties != want.Properties {
+			t.Errorf("blobs %v: restored properties %+v, want %+v", blobs, s.Properties, want.Properties)
+		}
+		content, err := b.GetSound("a")
+		if err != nil || string(content) != "a" {
+			t.Errorf("blobs %v: restored content %q, %v", blobs, content, err)
+		}
+		b.Close()
+		os.RemoveAll(dir)
+	}
+}
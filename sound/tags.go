@@ -0,0 +1,119 @@
+package sound
+
+import (
+	"github.com/pkg/errors"
+)
+
+// Tags returns the tags of the library with the number of sounds having them
+func Tags(s Sounder) map[string]int {
+	tags := make(map[string]int)
+	for _, ss := range s.GetSounds() {
+		for _, t := range ss.Tags {
+			tags[t]++
+		}
+	}
+	return tags
+}
+
+// SoundsWithTag returns the sounds having the given tag
+func SoundsWithTag(s Sounder, tag string) []Sound {
+	var out []Sound
+	for _, ss := range s.GetSounds() {
+		if contains(ss.Tags, tag) {
+			out = append(out, ss)
+		}
+	}
+	return out
+}
+
+// AddTag adds the tag to the named sounds. It returns the number of sounds
+// that have been updated.
+func AddTag(s Sounder, tag string, names ...string) (int, error) {
+	sounds := make(map[string]Sound)
+	for _, ss := range s.GetSounds() {
+		sounds[ss.Name] = ss
+	}
+	// check every sound before updating anything
+	for _, name := range names {
+		if _, ok := sounds[name]; !ok {
+			return 0, errors.Wrapf(ErrSoundNotFound, "%v", name)
+		}
+	}
+	return updateTags(s, names, sounds, func(tags []string) []string {
+		if contains(tags, tag) {
+			return tags
+		}
+		return append(append([]string{}, tags...), tag)
+	})
+}
+
+// RenameTag replaces the tag old with new on every sound having it. It
+// returns the number of sounds that have been updated.
+func RenameTag(s Sounder, old, new string) (int, error) {
+	return editTag(s, old, func(tags []string) []string {
+		var out []string
+		for _, t := range tags {
+			if t == old {
+				t = new
+			}
+			if !contains(out, t) {
+				out = append(out, t)
+			}
+		}
+		return out
+	})
+}
+
+// DeleteTag removes the tag from every sound having it. It returns the number
+// of sounds that have been updated.
+func DeleteTag(s Sounder, tag string) (int, error) {
+	return editTag(s, tag, func(tags []string) []string {
+		var out []string
+		for _, t := range tags {
+			if t != tag {
+				out = append(out, t)
+			}
+		}
+		return out
+	})
+}
+
+// editTag applies edit on the tags of every sound having the tag
+func editTag(s Sounder, tag string, edit func([]string) []string) (int, error) {
+	sounds := make(map[string]Sound)
+	var names []string
+	for _, ss := range SoundsWithTag(s, tag) {
+		sounds[ss.Name] = ss
+		names = append(names, ss.Name)
+	}
+	return updateTags(s, names, sounds, edit)
+}
+
+func updateTags(s Sounder, names []string, sounds map[string]Sound, edit func([]string) []string) (int, error) {
+	updated := 0
+	for _, name := range names {
+		ss := sounds[name]
+		tags := edit(ss.Tags)
+		if equal(tags, ss.Tags) {
+			continue
+		}
+		ss.Tags = tags
+		if err := s.UpdateSound(ss); err != nil {
+			return updated, errors.Wrapf(err, "Failed to update tags of %v", name)
+		}
+		updated++
+	}
+	return updated, nil
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,214 @@
+package sound
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// DeletedSound is a sound waiting in the trash
+type DeletedSound struct {
+	Sound
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+// trashed is the stored representation of a deleted sound
+type trashed struct {
+	ssto
+	TrashFile string    `json:"trash_file"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+// trash keeps deleted sounds for a retention period so they can be restored.
+// The audio files are copied in the trash directory and described in an
+// index file.
+type trash struct {
+	dir       string
+	retention time.Duration
+	mu        sync.Mutex
+	m         map[string]trashed
+}
+
+// newTrash returns the trash configured by the trashDir and trash.retention
+// settings
+func newTrash() *trash {
+	t := &trash{
+		dir:       viper.GetString("trashDir"),
+		retention: viper.GetDuration("trash.retention"),
+		m:         make(map[string]trashed),
+	}
+	data, err := ioutil.ReadFile(t.index())
+	if err != nil && !os.IsNotExist(err) {
+		logrus.WithError(err).Warn("Failed to read trash index")
+	}
+	if err == nil {
+		var ts []trashed
+		if err = json.Unmarshal(data, &ts); err != nil {
+			logrus.WithError(err).Warn("Failed to decode trash index")
+		}
+		for _, d := range ts {
+			t.m[d.Name] = d
+		}
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.purge()
+	return t
+}
+
+func (t *trash) index() string {
+	return filepath.Join(t.dir, "trash.json")
+}
+
+// save writes the index. Caller must hold the lock.
+func (t *trash) save() error {
+	var ts []trashed
+	for _, d := range t.m {
+		ts = append(ts, d)
+	}
+	sort.Slice(ts, func(i, j int) bool { return ts[i].Name < ts[j].Name })
+	data, err := json.Marshal(ts)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to encode trash index")
+	}
+	return writeAtomic(t.index(), data, 0)
+}
+
+// purge removes the sounds deleted for longer than the retention period.
+// Caller must hold the lock.
+func (t *trash) purge() {
+	purged := false
+	for name, d := range t.m {
+		if time.Since(d.DeletedAt) < t.retention {
+			continue
+		}
+		err := os.Remove(filepath.Join(t.dir, d.TrashFile))
+		if err != nil && !os.IsNotExist(err) {
+			logrus.WithError(err).WithField("name", name).Warn("Failed to remove file from trash")
+			continue
+		}
+		delete(t.m, name)
+		purged = true
+		logrus.WithField("name", name).Info("Sound purged from trash")
+	}
+	if purged {
+		if err := t.save(); err != nil {
+			logrus.WithError(err).Error("Failed to save trash index")
+		}
+	}
+}
+
+// put copies the file at fp in the trash as the content of the deleted sound
+// s. A sound previously deleted with the same name is replaced. The returned
+// function takes the sound back out of the trash, it must be called when the
+// deletion fails.
+func (t *trash) put(s Sound, fp string) (func(), error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.purge()
+
+	name := fmt.Sprintf("%d-%v", time.Now().UnixNano(), filepath.Base(s.FilePath))
+	if err := dirExist(filepath.Join(t.dir, name)); err != nil {
+		return nil, err
+	}
+	if err := copyFile(fp, filepath.Join(t.dir, name)); err != nil {
+		return nil, errors.Wrapf(err, "Failed to copy sound file into trash")
+	}
+	old, replaced := t.m[s.Name]
+	t.m[s.Name] = trashed{ssto: s.record(), TrashFile: name, DeletedAt: time.Now()}
+	if err := t.save(); err != nil {
+		if replaced {
+			t.m[s.Name] = old
+		} else {
+			delete(t.m, s.Name)
+		}
+		os.Remove(filepath.Join(t.dir, name))
+		return nil, err
+	}
+	if replaced {
+		os.Remove(filepath.Join(t.dir, old.TrashFile))
+	}
+	cancel := func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if d, ok := t.m[s.Name]; !ok || d.TrashFile != name {
+			return
+		}
+		delete(t.m, s.Name)
+		os.Remove(filepath.Join(t.dir, name))
+		if err := t.save(); err != nil {
+			logrus.WithError(err).Error("Failed to save trash index")
+		}
+	}
+	return cancel, nil
+}
+
+// take moves the content of a deleted sound back to the sound directory and
+// removes it from the trash
+func (t *trash) take(name string) (Sound, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.purge()
+
+	d, ok := t.m[name]
+	if !ok {
+		return Sound{}, ErrSoundNotFound
+	}
+	s := d.sound()
+	if err := dirExist(s.FilePath); err != nil {
+		return Sound{}, err
+	}
+	if err := os.Rename(filepath.Join(t.dir, d.TrashFile), s.FilePath); err != nil {
+		return Sound{}, errors.Wrapf(err, "Failed to move sound file out of trash")
+	}
+	delete(t.m, name)
+	if err := t.save(); err != nil {
+		logrus.WithError(err).Error("Failed to save trash index")
+	}
+	return s, nil
+}
+
+// untake puts back in the trash a sound taken out of it that couldn't be
+// restored. Its file is removed from the sound directory unless it is shared
+// with the other sounds.
+func (t *trash) untake(s Sound, sounds []Sound) {
+	if _, err := t.put(s, s.FilePath); err != nil {
+		logrus.WithError(err).WithField("name", s.Name).Error("Failed to put sound back into trash")
+		return
+	}
+	if !shared(s, sounds) {
+		os.Remove(s.FilePath)
+	}
+}
+
+// list returns the deleted sounds, most recently deleted first
+func (t *trash) list() []DeletedSound {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.purge()
+	var out []DeletedSound
+	for _, d := range t.m {
+		out = append(out, DeletedSound{Sound: d.sound(), DeletedAt: d.DeletedAt})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].DeletedAt.After(out[j].DeletedAt) })
+	return out
+}
+
+// shared returns true if another sound than s uses the same file
+func shared(s Sound, sounds []Sound) bool {
+	for _, o := range sounds {
+		if o.Name != s.Name && o.FilePath == s.FilePath {
+			return true
+		}
+	}
+	return false
+}
@@ -9,6 +9,7 @@ import (
 	"path/filepath"
 
 	"github.com/pkg/errors"
+	"github.com/restanrm/bell/metrics"
 	"github.com/restanrm/bell/player"
 	"github.com/restanrm/golang-tts"
 	"github.com/sirupsen/logrus"
@@ -37,6 +38,15 @@ func NewTTS(flite bool, accessKey, secretKey string) *tts {
 	return &tts{polly: polly, flite: flite}
 }
 
+// CheckPolly verifies the polly credentials by transforming a short text
+func (t *tts) CheckPolly() error {
+	_, err := t.polly.Speech("ok")
+	if err != nil {
+		return errors.Wrapf(err, "Failed to query polly")
+	}
+	return nil
+}
+
 func dirExist(filename string) error {
 	dir := filepath.Dir(filename)
 	_, err := os.Stat(dir)
@@ -128,6 +138,7 @@ func (t *tts) getSayFilename(text string) (string, error) {
 	// cached section
 	// if polly file exist, play it
 	if exist(pollyFilename) {
+		metrics.TTSCache.WithLabelValues("hit").Inc()
 		return pollyFilename, nil
 	}
 	// if flite file exist
@@ -135,29 +146,35 @@ func (t *tts) getSayFilename(text string) (string, error) {
 		// if flite it disabled
 		if !t.flite {
 			// try to create pollyfile
-			err := t.createAudioPolly(text, pollyFilename)
+			err := t.generate("polly", t.createAudioPolly, text, pollyFilename)
 			if err != nil {
 				// if fail, play flitefile
+				metrics.TTSCache.WithLabelValues("hit").Inc()
+				metrics.TTSPollyFallbacks.Inc()
 				return fliteFilename, nil
 			}
 			// play new pollyfile
+			metrics.TTSCache.WithLabelValues("miss").Inc()
 			return pollyFilename, nil
 		}
 		// flite is enabled and file exist, play it
+		metrics.TTSCache.WithLabelValues("hit").Inc()
 		return fliteFilename, nil
 	}
 
 	// no cache, creation of the file
+	metrics.TTSCache.WithLabelValues("miss").Inc()
 	if t.flite {
-		err = t.createAudioFlite(text, fliteFilename)
+		err = t.generate("flite", t.createAudioFlite, text, fliteFilename)
 		if err != nil {
 			return "", errors.Wrapf(err, "Failed to create any sound")
 		}
 		return fliteFilename, nil
 	} else {
-		err = t.createAudioPolly(text, pollyFilename)
+		err = t.generate("polly", t.createAudioPolly, text, pollyFilename)
 		if err != nil {
-			err = t.createAudioFlite(text, fliteFilename)
+			metrics.TTSPollyFallbacks.Inc()
+			err = t.generate("flite", t.createAudioFlite, text, fliteFilename)
 			if err != nil {
 				return "", errors.Wrapf(err, "Failed to create any sound")
 			}
@@ -167,6 +184,18 @@ func (t *tts) getSayFilename(text string) (string, error) {
 	}
 }
 
+// generate creates the audiofile of the text with create, and counts the
+// generations of the engine
+func (t *tts) generate(engine string, create func(text, filename string) error, text, filename string) error {
+	err := create(text, filename)
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	metrics.TTSGenerations.WithLabelValues(engine, result).Inc()
+	return err
+}
+
 // Say create a tempfile based on the choosen technology of TTS and order the player to
 // play it on speaker
 func (t *tts) Say(text string, p player.Player) error {
@@ -174,7 +203,10 @@ func (t *tts) Say(text string, p player.Player) error {
 	if err != nil {
 		return errors.Wrapf(err, "Failed to retrieve sound file")
 	}
-	p.PlayFilepath(filepath)
+	err = p.PlayFilepath(filepath)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to play sound file")
+	}
 	return nil
 }
 
@@ -0,0 +1,163 @@
+// Package volume keeps the volume and the mute switch of the server and of
+// the registered clients. The settings are kept in a json file so they
+// survive restarts.
+package volume
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// ErrInvalid is returned when a volume isn't between 0 and 100
+var ErrInvalid = errors.New("Volume must be between 0 and 100")
+
+// Default are the settings of the destinations never changed
+var Default = Settings{Volume: 100}
+
+// Settings are the volume and the mute switch of a destination
+type Settings struct {
+	// Volume is in percent of the volume of the sounds
+	Volume int `json:"volume"`
+	// Muted destinations refuse the plays
+	Muted bool `json:"muted"`
+}
+
+// Validate checks the volume is between 0 and 100
+func (s Settings) Validate() error {
+	if s.Volume < 0 || s.Volume > 100 {
+		return ErrInvalid
+	}
+	return nil
+}
+
+// Controls keeps the settings of the destinations. The destinations without
+// settings are at their default ones.
+type Controls struct {
+	fp       string
+	defaults map[string]Settings
+	watchers []func(destination string, s Settings)
+
+	mu       sync.Mutex
+	settings map[string]Settings
+}
+
+// Load returns the controls stored in the file at fp. The file is created on
+// the first change.
+func Load(fp string) (*Controls, error) {
+	c := &Controls{
+		fp:       fp,
+		defaults: make(map[string]Settings),
+		settings: make(map[string]Settings),
+	}
+	data, err := ioutil.ReadFile(fp)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to read volume file %v", fp)
+	}
+	if err = json.Unmarshal(data, &c.settings); err != nil {
+		return nil, errors.Wrapf(err, "Failed to decode volume file %v", fp)
+	}
+	for dest, s := range c.settings {
+		if err := s.Validate(); err != nil {
+			return nil, errors.Wrapf(err, "Invalid volume of destination %v", dest)
+		}
+	}
+	return c, nil
+}
+
+// SetDefault changes the settings of a destination until they are set. It
+// must be called before the controls are used.
+func (c *Controls) SetDefault(destination string, s Settings) error {
+	if err := s.Validate(); err != nil {
+		return err
+	}
+	c.defaults[destination] = s
+	return nil
+}
+
+// Watch registers a function called with the new settings of a destination
+// when they change. It must be called before the controls are used.
+func (c *Controls) Watch(fn func(destination string, s Settings)) {
+	c.watchers = append(c.watchers, fn)
+}
+
+// Get returns the settings of a destination
+func (c *Controls) Get(destination string) Settings {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if s, ok := c.settings[destination]; ok {
+		return s
+	}
+	if s, ok := c.defaults[destination]; ok {
+		return s
+	}
+	return Default
+}
+
+// List returns the settings of the destinations that have some, or a
+// default
+func (c *Controls) List() map[string]Settings {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := make(map[string]Settings, len(c.settings))
+	for dest, s := range c.defaults {
+		out[dest] = s
+	}
+	for dest, s := range c.settings {
+		out[dest] = s
+	}
+	return out
+}
+
+// Muted tells if a destination refuses the plays
+func (c *Controls) Muted(destination string) bool {
+	return c.Get(destination).Muted
+}
+
+// Set changes the settings of a destination. They are saved before the
+// watchers are notified.
+func (c *Controls) Set(destination string, s Settings) error {
+	if err := s.Validate(); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	old, ok := c.settings[destination]
+	c.settings[destination] = s
+	if err := c.save(); err != nil {
+		if ok {
+			c.settings[destination] = old
+		} else {
+			delete(c.settings, destination)
+		}
+		c.mu.Unlock()
+		return err
+	}
+	c.mu.Unlock()
+	for _, fn := range c.watchers {
+		fn(destination, s)
+	}
+	return nil
+}
+
+// save writes the settings in the file. Caller must hold the lock.
+func (c *Controls) save() error {
+	data, err := json.MarshalIndent(c.settings, "", "  ")
+	if err != nil {
+		return errors.Wrapf(err, "Failed to encode volumes")
+	}
+	tmp := c.fp + ".tmp"
+	if err = ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return errors.Wrapf(err, "Failed to write volumes")
+	}
+	if err = os.Rename(tmp, c.fp); err != nil {
+		os.Remove(tmp)
+		return errors.Wrapf(err, "Failed to replace %v", c.fp)
+	}
+	return nil
+}